@@ -0,0 +1,85 @@
+package dalle
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
+)
+
+const (
+	BandColorsImage      = "image"
+	BandColorsSeries     = "series"
+	BandColorsAttributes = "attributes"
+)
+
+// bandColorSource normalizes a requested band color source as it is
+// recorded and compared: trimmed, lowercased, and image when empty.
+func bandColorSource(source string) string {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if source == "" {
+		return BandColorsImage
+	}
+	return source
+}
+
+// bandPalette lists the hex colors the annotation band may be drawn in: none
+// (the image decides), every color the series allows, or the dress's
+// color1..3.
+func (engine *Engine) bandPalette(build promptBuild, source string) ([]string, error) {
+	switch bandColorSource(source) {
+	case BandColorsImage:
+		return nil, nil
+	case BandColorsSeries:
+		ctx, err := engine.seriesContext(build.metadata.Series.Name)
+		if err != nil {
+			return nil, err
+		}
+		return hexColors(ctx.Databases["colors"]), nil
+	case BandColorsAttributes:
+		return dressColors(build.dress), nil
+	default:
+		return nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown band color source %q (want image, series or attributes)", source))
+	}
+}
+
+func dressColors(dress *model.DalleDress) []string {
+	if dress == nil {
+		return nil
+	}
+	colors := []string{}
+	for which := 1; which <= 3; which++ {
+		colors = append(colors, hexColors([]string{dress.Color(true, which)})...)
+	}
+	return colors
+}
+
+// hexColors extracts the #rrggbb fields from color database rows.
+func hexColors(rows []string) []string {
+	colors := []string{}
+	for _, row := range rows {
+		for _, field := range strings.Split(row, ",") {
+			field = strings.TrimSpace(field)
+			if len(field) == 7 && strings.HasPrefix(field, "#") {
+				colors = append(colors, strings.ToLower(field))
+			}
+		}
+	}
+	return colors
+}
+
+// decodeImageFile reads and decodes the image at path.
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
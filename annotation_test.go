@@ -0,0 +1,128 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+)
+
+// midToneImages writes a uniform mid-gray PNG for every generated image, the
+// tone on which heuristic caption colors used to fail.
+func midToneImages(request imageRequest) (imageResult, error) {
+	if err := os.MkdirAll(filepath.Dir(request.generatedPath), 0o750); err != nil {
+		return imageResult{}, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{R: 0x77, G: 0x77, B: 0x77, A: 0xFF}}, image.Point{}, draw.Src)
+	file, err := os.Create(request.generatedPath)
+	if err != nil {
+		return imageResult{}, err
+	}
+	if err := png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return imageResult{}, err
+	}
+	if err := file.Close(); err != nil {
+		return imageResult{}, err
+	}
+	result := imageResult{generatedPath: request.generatedPath}
+	if request.annotate {
+		if err := annotate.AnnotateFile(request.generatedPath, request.annotatedPath, request.annotation); err != nil {
+			return imageResult{}, err
+		}
+		colors, err := annotate.FileColors(request.generatedPath, request.annotation)
+		if err != nil {
+			return imageResult{}, err
+		}
+		result.annotatedPath, result.colors = request.annotatedPath, &colors
+	}
+	return result, nil
+}
+
+func TestEngineGenerateRecordsAnnotationColors(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var received annotate.Options
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		received = request.annotation
+		return midToneImages(request)
+	}
+	result, err := engine.Generate(GenerateRequest{
+		Input:      "Person Tour Coordinates",
+		Image:      true,
+		Annotate:   true,
+		Contrast:   annotate.ContrastAAA,
+		BandColors: BandColorsAttributes,
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if want := dressColorsOf(result.Metadata); !reflect.DeepEqual(received.Palette, want) || len(want) == 0 {
+		t.Fatalf("palette %v, want the selected colors %v", received.Palette, want)
+	}
+	annotation := result.Metadata.Annotation
+	if annotation == nil || annotation.Colors == nil {
+		t.Fatalf("colors not recorded: %#v", annotation)
+	}
+	colors := annotation.Colors
+	if colors.Level != annotate.ContrastAAA || colors.ContrastRatio < 7 || colors.Source != annotate.ColorSourcePalette || annotation.BandColors != BandColorsAttributes {
+		t.Fatalf("unexpected recorded colors: %+v", colors)
+	}
+	cached, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true, Contrast: "aaa", BandColors: " Attributes "})
+	if err != nil || !cached.Metadata.Status.CacheHit {
+		t.Fatalf("expected the same band colors spelled differently to be cached, got %v", err)
+	}
+
+	_, err = engine.Generate(GenerateRequest{Input: "Other", Image: true, Annotate: true, BandColors: "rainbow"})
+	if ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an unknown band color source to be rejected, got %v", err)
+	}
+	_, err = engine.Generate(GenerateRequest{Input: "Other", Image: true, Annotate: true, Contrast: "A"})
+	if ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an unknown contrast level to be rejected, got %v", err)
+	}
+}
+
+func dressColorsOf(metadata ImageMetadata) []string {
+	rows := []string{}
+	for _, record := range metadata.SelectedRecords {
+		switch record.Attribute {
+		case "color1", "color2", "color3":
+			rows = append(rows, record.Record)
+		}
+	}
+	return hexColors(rows)
+}
+
+func TestHexColors(t *testing.T) {
+	got := hexColors([]string{"aliceblue,#F0F8FF", "none", "v0.1.0,azure,#f0ffff", "#abc"})
+	if want := []string{"#f0f8ff", "#f0ffff"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hexColors = %v, want %v", got, want)
+	}
+}
+
+func TestEngineReannotatesOnlyGeneratedArtifacts(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for path, want := range map[string]ErrorCode{
+		filepath.Join(engine.DataDir(), "output", "series", "generated", "seed.png"): "",
+		filepath.Join(engine.DataDir(), "output", "series", "images", "seed.png"):    ErrInvalidInput,
+		filepath.Join(t.TempDir(), "output", "series", "generated", "seed.png"):      ErrInvalidInput,
+	} {
+		metadata := ImageMetadata{Artifacts: ArtifactSet{Generated: path}}
+		if _, err := engine.generatedArtifact(metadata); ErrorCodeOf(err) != want {
+			t.Errorf("generatedArtifact(%s) = %v, want %q", path, err, want)
+		}
+	}
+}
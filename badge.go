@@ -0,0 +1,221 @@
+package dalle
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
+)
+
+// DefaultBadgeTemplate renders the series name and, when known, the edition
+// number, e.g. "five-tone-postal-protozoa #42 / 500".
+const DefaultBadgeTemplate = `{{.Series}}{{if .Edition}} #{{.Edition}}{{if .EditionSize}} / {{.EditionSize}}{{end}}{{end}}`
+
+// BadgeConfig describes the mark stamped on annotated images. Template is a
+// text/template evaluated against BadgeData (DefaultBadgeTemplate when
+// empty). Logo names a PNG in the badges folder of the data directory.
+// Corner, Opacity and Scale are as for annotate.BadgeOptions.
+type BadgeConfig struct {
+	Template    string  `json:"template,omitempty"`
+	Logo        string  `json:"logo,omitempty"`
+	Corner      string  `json:"corner,omitempty"`
+	Opacity     float64 `json:"opacity,omitempty"`
+	Scale       float64 `json:"scale,omitempty"`
+	EditionSize int     `json:"editionSize,omitempty"`
+}
+
+// BadgeData is what a badge template sees: every DalleDress field (such as
+// {{.Series}} or {{.TitlePrompt}}), the image metadata as {{.Metadata}} and
+// the edition numbers.
+type BadgeData struct {
+	*model.DalleDress
+	Metadata    ImageMetadata
+	Edition     int
+	EditionSize int
+}
+
+// MetadataBadge records the badge drawn on the annotated artifact.
+type MetadataBadge struct {
+	Text        string  `json:"text"`
+	Template    string  `json:"template,omitempty"`
+	Logo        string  `json:"logo,omitempty"`
+	Corner      string  `json:"corner"`
+	Opacity     float64 `json:"opacity,omitempty"`
+	Scale       float64 `json:"scale,omitempty"`
+	Edition     int     `json:"edition,omitempty"`
+	EditionSize int     `json:"editionSize,omitempty"`
+}
+
+// Merge returns config with every field set in override replacing the
+// corresponding field of config.
+func (config BadgeConfig) Merge(override BadgeConfig) BadgeConfig {
+	if override.Template != "" {
+		config.Template = override.Template
+	}
+	if override.Logo != "" {
+		config.Logo = override.Logo
+	}
+	if override.Corner != "" {
+		config.Corner = override.Corner
+	}
+	if override.Opacity != 0 {
+		config.Opacity = override.Opacity
+	}
+	if override.Scale != 0 {
+		config.Scale = override.Scale
+	}
+	if override.EditionSize != 0 {
+		config.EditionSize = override.EditionSize
+	}
+	return config
+}
+
+// Validate reports a configuration that can never render.
+func (config BadgeConfig) Validate() error {
+	if err := annotate.ValidateCorner(config.Corner); err != nil {
+		return NewError(ErrInvalidInput, err.Error())
+	}
+	if config.Opacity < 0 || config.Opacity > 1 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("badge opacity %g is outside 0-1", config.Opacity))
+	}
+	if config.Scale < 0 || config.Scale > 0.5 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("badge scale %g is outside 0-0.5", config.Scale))
+	}
+	if config.EditionSize < 0 {
+		return NewError(ErrInvalidInput, "badge edition size must not be negative")
+	}
+	if _, err := config.template(); err != nil {
+		return err
+	}
+	if config.Logo != "" {
+		if _, err := badgeAssetPath("", config.Logo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (config BadgeConfig) template() (*template.Template, error) {
+	text := config.Template
+	if text == "" {
+		text = DefaultBadgeTemplate
+	}
+	parsed, err := template.New("badge").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, WrapError(ErrInvalidInput, "parse badge template", err)
+	}
+	return parsed, nil
+}
+
+// badgeAssetPath joins a logo name onto the badges folder, refusing names
+// that would leave it or that are not PNG files.
+func badgeAssetPath(dataDir, name string) (string, error) {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(os.PathSeparator)) {
+		return "", NewError(ErrInvalidInput, fmt.Sprintf("badge logo %q must be inside the badges folder", name))
+	}
+	if strings.ToLower(filepath.Ext(clean)) != ".png" {
+		return "", NewError(ErrInvalidInput, fmt.Sprintf("badge logo %q is not a PNG file", name))
+	}
+	return filepath.Join(dataDir, "badges", clean), nil
+}
+
+// badgeConfig combines the series badge with the request's. It is nil when
+// neither asks for a badge.
+func badgeConfig(series Series, request GenerateRequest) (*BadgeConfig, error) {
+	if series.Badge == nil && request.Badge == nil {
+		return nil, nil
+	}
+	config := BadgeConfig{}
+	if series.Badge != nil {
+		config = *series.Badge
+	}
+	if request.Badge != nil {
+		config = config.Merge(*request.Badge)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// applyBadge stamps the badge onto the annotated image in place. Empty
+// placeholder artifacts (written when no image provider key is set) are left
+// alone and get no badge.
+func (engine *Engine) applyBadge(path string, config BadgeConfig, data BadgeData, font annotate.Options) (*MetadataBadge, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, WrapError(ErrArtifactMissing, "read annotated image", err)
+	} else if info.Size() == 0 {
+		return nil, nil
+	}
+	tmpl, err := config.template()
+	if err != nil {
+		return nil, err
+	}
+	data.EditionSize = config.EditionSize
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, data); err != nil {
+		return nil, WrapError(ErrInvalidInput, "render badge template", err)
+	}
+	options := annotate.BadgeOptions{
+		Text:    strings.TrimSpace(text.String()),
+		Corner:  config.Corner,
+		Opacity: config.Opacity,
+		Scale:   config.Scale,
+		Font:    font.Font,
+		FontDir: font.FontDir,
+	}
+	if config.Logo != "" {
+		logoPath, err := badgeAssetPath(engine.dataDir, config.Logo)
+		if err != nil {
+			return nil, err
+		}
+		if options.Logo, err = decodePNG(logoPath); err != nil {
+			return nil, WrapError(ErrArtifactMissing, "read badge logo", err)
+		}
+	}
+	annotated, err := decodePNG(path)
+	if err != nil {
+		return nil, WrapError(ErrArtifactMissing, "read annotated image", err)
+	}
+	badged, err := annotate.DrawBadge(annotated, options)
+	if err != nil {
+		return nil, WrapError(ErrInvalidInput, "draw badge", err)
+	}
+	if err := writePNG(path, badged); err != nil {
+		return nil, WrapError(ErrArtifactMissing, "write badged image", err)
+	}
+	corner := config.Corner
+	if corner == "" {
+		corner = annotate.CornerBottomRight
+	}
+	return &MetadataBadge{
+		Text:        options.Text,
+		Template:    config.Template,
+		Logo:        config.Logo,
+		Corner:      corner,
+		Opacity:     config.Opacity,
+		Scale:       config.Scale,
+		Edition:     data.Edition,
+		EditionSize: data.EditionSize,
+	}, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
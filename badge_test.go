@@ -0,0 +1,186 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// annotatedMidTones writes the mid-gray image to both the generated and the
+// annotated paths, standing in for a real annotator.
+func annotatedMidTones(request imageRequest) (imageResult, error) {
+	result, err := midToneImages(request)
+	if err != nil {
+		return result, err
+	}
+	contents, err := os.ReadFile(request.generatedPath)
+	if err != nil {
+		return result, err
+	}
+	if err := os.MkdirAll(filepath.Dir(request.annotatedPath), 0o750); err != nil {
+		return result, err
+	}
+	return result, os.WriteFile(request.annotatedPath, contents, 0o600)
+}
+
+func TestEngineGenerateDrawsBadge(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	requests := 0
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		requests++
+		return annotatedMidTones(request)
+	}
+	request := GenerateRequest{
+		Input:    "Person Tour Coordinates",
+		Image:    true,
+		Annotate: true,
+		Edition:  42,
+		Badge:    &BadgeConfig{Template: "#{{.Edition}} / {{.EditionSize}}", Corner: "top-left", EditionSize: 500},
+	}
+	result, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	badge := result.Metadata.Annotation.Badge
+	if badge == nil || badge.Text != "#42 / 500" || badge.Corner != "top-left" || badge.Edition != 42 || badge.EditionSize != 500 {
+		t.Fatalf("unexpected badge record: %+v", badge)
+	}
+	annotated, err := decodePNG(result.AnnotatedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := color.RGBA{R: 0x77, G: 0x77, B: 0x77, A: 0xFF}
+	if got := color.RGBAModel.Convert(annotated.At(5, 2)); got == gray {
+		t.Fatal("expected the badge in the top left corner")
+	}
+	if got := color.RGBAModel.Convert(annotated.At(30, 30)); got != gray {
+		t.Fatalf("bottom right corner changed to %v", got)
+	}
+
+	cached, err := engine.Generate(request)
+	if err != nil || !cached.Metadata.Status.CacheHit {
+		t.Fatalf("expected the badged image to be cached, got %v", err)
+	}
+	request.Edition = 43
+	again, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if again.Metadata.Status.CacheHit || again.Metadata.Annotation.Badge.Text != "#43 / 500" {
+		t.Fatalf("expected a new edition to redraw the badge: %+v", again.Metadata.Annotation.Badge)
+	}
+	request.Edition = 0
+	request.Badge.Corner = "bottom-left"
+	moved, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if badge := moved.Metadata.Annotation.Badge; moved.Metadata.Status.CacheHit || badge.Corner != "bottom-left" || badge.Text != "#43 / 500" {
+		t.Fatalf("expected a moved badge to be redrawn with its edition: %+v", badge)
+	}
+	if requests != 1 {
+		t.Fatalf("expected badges to be redrawn without a new image, got %d image requests", requests)
+	}
+}
+
+func TestEngineGenerateFollowsSeriesBadge(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	writeBadgedSeries(t, dataDir, "first")
+	request := GenerateRequest{Input: "Person Tour Coordinates", Series: "badged", Image: true, Annotate: true}
+	result, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if badge := result.Metadata.Annotation.Badge; badge == nil || badge.Text != "first" {
+		t.Fatalf("unexpected badge record: %+v", badge)
+	}
+	writeBadgedSeries(t, dataDir, "second")
+	result, err = engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if badge := result.Metadata.Annotation.Badge; result.Metadata.Status.CacheHit || badge == nil || badge.Text != "second" {
+		t.Fatalf("expected a changed series badge to be redrawn: %+v", badge)
+	}
+}
+
+// writeBadgedSeries writes the user series "badged", whose badge template is
+// the given text.
+func writeBadgedSeries(t *testing.T, dataDir, text string) {
+	t.Helper()
+	series := Series{Suffix: "badged", Badge: &BadgeConfig{Template: text}}
+	if err := os.MkdirAll(filepath.Join(dataDir, "user-series"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "user-series", "badged.json"), []byte(series.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngineGenerateBadgeLogo(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+
+	_, err = engine.Generate(GenerateRequest{Input: "logo", Image: true, Annotate: true, Badge: &BadgeConfig{Logo: "mark.png"}})
+	if ErrorCodeOf(err) != ErrArtifactMissing {
+		t.Fatalf("expected a missing logo to be reported, got %v", err)
+	}
+
+	logo := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(logo, logo.Bounds(), &image.Uniform{color.RGBA{R: 0xFF, A: 0xFF}}, image.Point{}, draw.Src)
+	if err := os.MkdirAll(filepath.Join(dataDir, "badges"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dataDir, "badges", "mark.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, logo); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+	result, err := engine.Generate(GenerateRequest{Input: "logo", Image: true, Annotate: true, Badge: &BadgeConfig{Logo: "mark.png"}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if badge := result.Metadata.Annotation.Badge; badge == nil || badge.Logo != "mark.png" || badge.Text == "" {
+		t.Fatalf("unexpected badge record: %+v", badge)
+	}
+}
+
+func TestBadgeConfigValidate(t *testing.T) {
+	valid := BadgeConfig{Template: DefaultBadgeTemplate, Logo: "logos/mark.png", Corner: "top-right", Opacity: 0.5, Scale: 0.1}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for name, config := range map[string]BadgeConfig{
+		"corner":   {Corner: "middle"},
+		"opacity":  {Opacity: 1.5},
+		"scale":    {Scale: 0.75},
+		"template": {Template: "{{.Series"},
+		"escape":   {Logo: "../secret.png"},
+		"absolute": {Logo: "/etc/mark.png"},
+		"format":   {Logo: "mark.svg"},
+	} {
+		if err := config.Validate(); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
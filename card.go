@@ -0,0 +1,216 @@
+package dalle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
+)
+
+// DefaultCardTemplate is the poker-proportioned card used when the data
+// directory has no cards/default.json: the title over the generated image, a
+// type line, the emotion, occupation and art style as stats, the flavor text
+// and a series footer.
+const DefaultCardTemplate = `{
+  "width": 750,
+  "height": 1050,
+  "background": "#1c1b22",
+  "font": {"family": "go"},
+  "elements": [
+    {"type": "rect", "x": 24, "y": 24, "width": 702, "height": 1002, "fill": "#efe6cf", "radius": 28},
+    {"type": "rect", "x": 48, "y": 48, "width": 654, "height": 64, "fill": "#2e3a59", "radius": 12},
+    {"type": "text", "x": 64, "y": 52, "width": 622, "height": 56, "text": "{{.TitlePrompt}}", "color": "#f6f1e3", "align": "left", "size": 34, "weight": "bold"},
+    {"type": "image", "x": 48, "y": 128, "width": 654, "height": 520, "image": "generated", "fit": "cover", "stroke": "#2e3a59", "strokeWidth": 6},
+    {"type": "rect", "x": 48, "y": 664, "width": 654, "height": 44, "fill": "#d8cba8", "radius": 8},
+    {"type": "text", "x": 64, "y": 668, "width": 622, "height": 36, "text": "{{.Noun true}}{{with .Occupation true}} · {{.}}{{end}}", "color": "#1c1b22", "align": "left", "size": 24, "weight": "bold"},
+    {"type": "rect", "x": 48, "y": 724, "width": 654, "height": 150, "fill": "#f8f3e6", "stroke": "#2e3a59", "strokeWidth": 2, "radius": 8},
+    {"type": "text", "x": 68, "y": 734, "width": 614, "height": 40, "text": "Emotion: {{.Emotion true}}", "color": "#1c1b22", "align": "left", "size": 24},
+    {"type": "text", "x": 68, "y": 778, "width": 614, "height": 40, "text": "Occupation: {{with .Occupation true}}{{.}}{{else}}none{{end}}", "color": "#1c1b22", "align": "left", "size": 24},
+    {"type": "text", "x": 68, "y": 822, "width": 614, "height": 40, "text": "Style: {{.ArtStyle true 1}}", "color": "#1c1b22", "align": "left", "size": 24},
+    {"type": "text", "x": 64, "y": 886, "width": 622, "height": 86, "text": "{{.Flavor}}", "color": "#4a4338", "size": 22},
+    {"type": "text", "x": 48, "y": 980, "width": 400, "height": 30, "text": "{{.Series}}", "color": "#2e3a59", "align": "left", "size": 20, "weight": "bold"},
+    {"type": "text", "x": 450, "y": 980, "width": 252, "height": 30, "text": "#{{short .Metadata.ImageID}}", "color": "#2e3a59", "align": "right", "size": 20}
+  ]
+}`
+
+var cardTemplateName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// CardData is what the text of a card template sees: every DalleDress field
+// and method (such as {{.TitlePrompt}} or {{.Emotion true}}), the image
+// metadata as {{.Metadata}} and the flavor text, the first sentence of the
+// enhanced prompt (or the terse prompt when the image was not enhanced).
+// The short function trims an image ID to the first twelve digits of its
+// hash.
+type CardData struct {
+	*model.DalleDress
+	Metadata ImageMetadata
+	Flavor   string
+}
+
+// CardOptions picks the template, a JSON annotate.CardLayout in the cards
+// folder of the data directory (default when empty), and where to write the
+// card (output/<series>/cards/<filename>.png when empty).
+type CardOptions struct {
+	Template string
+	Out      string
+}
+
+type CardResult struct {
+	ImageID  string `json:"imageId"`
+	Template string `json:"template"`
+	Path     string `json:"path"`
+}
+
+// RenderCard draws the image as a collectible card.
+func (engine *Engine) RenderCard(id string, options CardOptions) (CardResult, error) {
+	if engine == nil {
+		return CardResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	name := cardName(options.Template)
+	layout, err := engine.loadCardLayout(name)
+	if err != nil {
+		return CardResult{}, err
+	}
+	record, err := engine.GetImage(id)
+	if err != nil {
+		return CardResult{}, err
+	}
+	metadata := record.Metadata
+	card, filename, err := engine.renderCard(metadata, layout)
+	if err != nil {
+		return CardResult{}, err
+	}
+	out := strings.TrimSpace(options.Out)
+	if out == "" {
+		out = filepath.Join(engine.dataDir, "output", safePathPart(metadata.Series.Name), "cards", filename+".png")
+	}
+	if hasLeadingTilde(out) {
+		return CardResult{}, NewError(ErrInvalidInput, "card path must not start with '~'")
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(engine.dataDir, out)
+	}
+	out = filepath.Clean(out)
+	if err := os.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+		return CardResult{}, WrapError(ErrMetadataInvalid, "create card directory", err)
+	}
+	if err := writePNG(out, card); err != nil {
+		return CardResult{}, WrapError(ErrMetadataInvalid, "write card", err)
+	}
+	return CardResult{ImageID: metadata.ImageID, Template: name, Path: out}, nil
+}
+
+func cardName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// loadCardLayout reads cards/<name>.json from the data directory. Without
+// one, the default template is DefaultCardTemplate.
+func (engine *Engine) loadCardLayout(name string) (annotate.CardLayout, error) {
+	if !cardTemplateName.MatchString(name) {
+		return annotate.CardLayout{}, NewError(ErrInvalidInput, fmt.Sprintf("card template %q must be lowercase letters, digits, dashes and underscores", name))
+	}
+	data, err := os.ReadFile(filepath.Join(engine.dataDir, "cards", name+".json"))
+	switch {
+	case os.IsNotExist(err) && name == "default":
+		data = []byte(DefaultCardTemplate)
+	case os.IsNotExist(err):
+		return annotate.CardLayout{}, NewError(ErrInvalidInput, fmt.Sprintf("card template %q not found in %s", name, filepath.Join(engine.dataDir, "cards")))
+	case err != nil:
+		return annotate.CardLayout{}, WrapError(ErrInvalidInput, "read card template", err)
+	}
+	layout := annotate.CardLayout{}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return annotate.CardLayout{}, WrapError(ErrInvalidInput, "parse card template "+name, err)
+	}
+	if err := layout.Validate(); err != nil {
+		return annotate.CardLayout{}, WrapError(ErrInvalidInput, "card template "+name, err)
+	}
+	return layout, nil
+}
+
+// renderCard binds layout to the image and draws it. It also returns the
+// image's file name.
+func (engine *Engine) renderCard(metadata ImageMetadata, layout annotate.CardLayout) (image.Image, string, error) {
+	dress := dressFromMetadata(metadata)
+	data := CardData{DalleDress: dress, Metadata: metadata, Flavor: flavorText(metadata.Prompts)}
+	funcs := template.FuncMap{"short": shortImageID}
+	for i := range layout.Elements {
+		element := &layout.Elements[i]
+		if element.Type != annotate.CardText || !strings.Contains(element.Text, "{{") {
+			continue
+		}
+		parsed, err := template.New("card").Funcs(funcs).Option("missingkey=error").Parse(element.Text)
+		if err != nil {
+			return nil, "", WrapError(ErrInvalidInput, fmt.Sprintf("parse card element %d", i+1), err)
+		}
+		var text bytes.Buffer
+		if err := parsed.Execute(&text, data); err != nil {
+			return nil, "", WrapError(ErrInvalidInput, fmt.Sprintf("execute card element %d", i+1), err)
+		}
+		element.Text = text.String()
+	}
+
+	images := map[string]image.Image{}
+	for _, artifact := range []NamedArtifact{{Name: ArtifactGenerated, Path: metadata.Artifacts.Generated}, {Name: ArtifactAnnotated, Path: metadata.Artifacts.Annotated}} {
+		if !cardUses(layout, artifact.Name) {
+			continue
+		}
+		if strings.TrimSpace(artifact.Path) == "" {
+			return nil, "", NewError(ErrArtifactMissing, "image has no "+artifact.Name+" artifact for the card")
+		}
+		img, err := decodeImageFile(artifact.Path)
+		if err != nil {
+			return nil, "", WrapError(ErrArtifactMissing, "read "+artifact.Name+" artifact", err)
+		}
+		images[artifact.Name] = img
+	}
+	card, err := annotate.RenderCard(layout, images, filepath.Join(engine.dataDir, "fonts"))
+	if err != nil {
+		return nil, "", WrapError(ErrInvalidInput, "render card", err)
+	}
+	return card, dress.FileName + variantSuffix(metadata), nil
+}
+
+func shortImageID(id string) string {
+	if _, hash, ok := strings.Cut(id, ":"); ok {
+		id = hash
+	}
+	return id[:min(len(id), 12)]
+}
+
+func cardUses(layout annotate.CardLayout, name string) bool {
+	for _, element := range layout.Elements {
+		if element.Type == annotate.CardImage && element.Image == name {
+			return true
+		}
+	}
+	return false
+}
+
+// flavorText is the first sentence of the enhanced prompt, or of the terse
+// prompt when there is none.
+func flavorText(prompts PromptSet) string {
+	text := strings.Join(strings.Fields(prompts.EnhancedPrompt), " ")
+	if text == "" {
+		text = strings.Join(strings.Fields(prompts.TersePrompt), " ")
+	}
+	for i := 0; i < len(text); i++ {
+		if strings.ContainsRune(".!?", rune(text[i])) && (i+1 == len(text) || text[i+1] == ' ') {
+			return text[:i+1]
+		}
+	}
+	return text
+}
@@ -0,0 +1,141 @@
+package dalle
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineRenderCard(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	id := result.Metadata.ImageID
+	card, err := engine.RenderCard(id, CardOptions{})
+	if err != nil {
+		t.Fatalf("RenderCard: %v", err)
+	}
+	if card.Template != "default" || filepath.Base(filepath.Dir(card.Path)) != "cards" {
+		t.Fatalf("unexpected card %+v", card)
+	}
+	img, err := decodeImageFile(card.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 750 || img.Bounds().Dy() != 1050 {
+		t.Fatalf("unexpected card size %v", img.Bounds())
+	}
+
+	// A template in the data directory binds dress and metadata fields.
+	cards := filepath.Join(engine.DataDir(), "cards")
+	if err := os.MkdirAll(cards, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	layout := `{"width": 100, "height": 80, "background": "#ff0000", "elements": [
+		{"type": "image", "x": 0, "y": 0, "width": 100, "height": 40, "image": "generated"},
+		{"type": "text", "x": 0, "y": 40, "width": 100, "height": 40, "text": "{{.Emotion true}} {{.Metadata.Seed}} {{short .Metadata.ImageID}}"}
+	]}`
+	if err := os.WriteFile(filepath.Join(cards, "mini.json"), []byte(layout), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "mini.png")
+	if card, err = engine.RenderCard(id, CardOptions{Template: "mini", Out: out}); err != nil || card.Path != out {
+		t.Fatalf("expected the mini card at %s, got %+v, %v", out, card, err)
+	}
+	if img, err = decodeImageFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(50, 60)).(color.RGBA); got.R != 0xFF || got.G != 0 {
+		t.Fatalf("expected the red background behind the text, got %v", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(50, 20)).(color.RGBA); got.R == 0xFF && got.G == 0 {
+		t.Fatal("expected the image over the background")
+	}
+
+	exported, err := engine.ExportImage(id, ExportImageOptions{Card: true, CardTemplate: "mini"})
+	if err != nil || filepath.Base(exported.Card) != "card.png" {
+		t.Fatalf("expected an exported card, got %+v, %v", exported, err)
+	}
+
+	for name, content := range map[string]string{
+		"broken":  `{"width": 100`,
+		"missing": `{"width": 10, "height": 10, "elements": [{"type": "text", "width": 10, "height": 10, "text": "{{.NoSuchField}}"}]}`,
+		"nosize":  `{"elements": []}`,
+	} {
+		if err := os.WriteFile(filepath.Join(cards, name+".json"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.RenderCard(id, CardOptions{Template: name}); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("%s: expected invalid input, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"absent", "../escape"} {
+		if _, err := engine.RenderCard(id, CardOptions{Template: name}); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("%s: expected invalid input, got %v", name, err)
+		}
+	}
+}
+
+func TestFlavorText(t *testing.T) {
+	for _, test := range []struct {
+		prompts PromptSet
+		want    string
+	}{
+		{PromptSet{EnhancedPrompt: "A calm octopus.  It waves.", TersePrompt: "terse"}, "A calm octopus."},
+		{PromptSet{TersePrompt: "An anxious 3.5 inch robot"}, "An anxious 3.5 inch robot"},
+		{PromptSet{}, ""},
+	} {
+		if got := flavorText(test.prompts); got != test.want {
+			t.Errorf("flavorText(%+v) = %q, want %q", test.prompts, got, test.want)
+		}
+	}
+}
+
+func TestEngineRenderCardBindsStoredRecords(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir, Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	writeBadgedSeries(t, dataDir, "")
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Series: "badged", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	build, err := engine.buildPromptMetadata(GenerateRequest{Input: "Person Tour Coordinates", Series: "badged"})
+	if err != nil {
+		t.Fatalf("buildPromptMetadata: %v", err)
+	}
+	metadata := result.Metadata
+	dress := dressFromMetadata(metadata)
+	if dress.Noun(true) != build.dress.Noun(true) || dress.Emotion(false) != build.dress.Emotion(false) || dress.ArtStyle(true, 1) != build.dress.ArtStyle(true, 1) || dress.TitlePrompt != build.dress.TitlePrompt {
+		t.Fatalf("expected the stored dress to match the built one")
+	}
+	if name := dress.FileName + variantSuffix(metadata) + ".png"; name != filepath.Base(metadata.Artifacts.Generated) {
+		t.Fatalf("expected the stored file name, got %s", name)
+	}
+	for i := range metadata.SelectedRecords {
+		if metadata.SelectedRecords[i].Attribute == "noun" {
+			metadata.SelectedRecords[i].Record = "zebracorn,stored"
+		}
+	}
+	if got := dressFromMetadata(metadata).Noun(true); got != "zebracorn" {
+		t.Fatalf("expected the stored noun, got %q", got)
+	}
+
+	// The card no longer depends on the series that made the image.
+	if err := os.Remove(filepath.Join(dataDir, "user-series", "badged.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.RenderCard(metadata.ImageID, CardOptions{}); err != nil {
+		t.Fatalf("RenderCard: %v", err)
+	}
+}
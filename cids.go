@@ -0,0 +1,180 @@
+package dalle
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/ipfs"
+)
+
+// CAROptions selects the images of a series to package for IPFS, as for
+// TokenExportOptions. Out is the CAR file (output/<series>/tokens.car when
+// empty).
+type CAROptions struct {
+	Series      string
+	IDs         []string
+	Out         string
+	Start       int
+	ExternalURL string
+	Artifact    string
+	Name        string
+}
+
+// CARToken is one token in a CAR file: the CIDs of its image and of its
+// metadata JSON.
+type CARToken struct {
+	TokenID  int    `json:"tokenId"`
+	ImageID  string `json:"imageId"`
+	Image    string `json:"image"`
+	Metadata string `json:"metadata"`
+}
+
+// CARResult describes a packaged series. Root is the CID of the directory
+// holding the token metadata, contract.json and images/; BaseURI is the
+// contract base URI that serves it. Images is the CID of images/.
+type CARResult struct {
+	Path     string     `json:"path"`
+	Root     string     `json:"root"`
+	BaseURI  string     `json:"baseUri"`
+	Images   string     `json:"images"`
+	Contract string     `json:"contract"`
+	Tokens   []CARToken `json:"tokens"`
+	Blocks   int        `json:"blocks"`
+	Size     int64      `json:"size"`
+	Skipped  []string   `json:"skipped,omitempty"`
+}
+
+// artifactCIDs returns the IPFS CID (CIDv1, as `ipfs add --cid-version=1`
+// reports it) of every artifact on disk, by artifact name. It is nil when
+// there are none.
+func artifactCIDs(set ArtifactSet) (map[string]string, error) {
+	cids := map[string]string{}
+	for _, artifact := range set.Named() {
+		data, err := os.ReadFile(artifact.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, WrapError(ErrArtifactMissing, "read "+artifact.Name+" artifact", err)
+		}
+		cids[artifact.Name] = ipfs.File(data).CID.String()
+	}
+	if len(cids) == 0 {
+		return nil, nil
+	}
+	return cids, nil
+}
+
+// dressCID is the CID recorded as DalleDress.IPFSHash: the annotated image
+// when there is one, else the generated image.
+func dressCID(cids map[string]string) string {
+	if cid := cids[ArtifactAnnotated]; cid != "" {
+		return cid
+	}
+	return cids[ArtifactGenerated]
+}
+
+// PackageCAR writes the token export of a series (see ExportTokens) as a
+// CARv1 file, computed offline and ready to upload to a pinning service.
+// Token images are addressed as ipfs://<images CID>/<tokenId>.png, and the
+// contract base URI is ipfs://<root CID>/.
+func (engine *Engine) PackageCAR(options CAROptions) (CARResult, error) {
+	if engine == nil {
+		return CARResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	plan, err := engine.planTokens(TokenExportOptions{
+		Series:      options.Series,
+		IDs:         options.IDs,
+		Start:       options.Start,
+		ExternalURL: options.ExternalURL,
+		Artifact:    options.Artifact,
+		Name:        options.Name,
+	})
+	if err != nil {
+		return CARResult{}, err
+	}
+	path := strings.TrimSpace(options.Out)
+	if path == "" {
+		path = filepath.Join(engine.dataDir, "output", safePathPart(plan.series), "tokens.car")
+	}
+	if hasLeadingTilde(path) {
+		return CARResult{}, NewError(ErrInvalidInput, "CAR path must not start with '~'")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(engine.dataDir, path)
+	}
+	path = filepath.Clean(path)
+
+	images := []ipfs.Entry{}
+	result := CARResult{Path: path, Tokens: []CARToken{}, Skipped: plan.skipped}
+	for _, token := range plan.tokens {
+		data, err := os.ReadFile(token.source)
+		if err != nil {
+			return CARResult{}, WrapError(ErrArtifactMissing, "read token image", err)
+		}
+		node := ipfs.File(data)
+		images = append(images, ipfs.Entry{Name: token.imageName(), Node: node})
+		result.Tokens = append(result.Tokens, CARToken{TokenID: token.id, ImageID: token.metadata.ImageID, Image: node.CID.String()})
+	}
+	imagesDir, err := ipfs.Directory(images)
+	if err != nil {
+		return CARResult{}, WrapError(ErrInvalidInput, "build images directory", err)
+	}
+	imageBaseURI := "ipfs://" + imagesDir.CID.String() + "/"
+
+	entries := []ipfs.Entry{{Name: "images", Node: imagesDir}}
+	for i, token := range plan.tokens {
+		encoded, err := encodeTokenJSON(plan.token(token, imageBaseURI))
+		if err != nil {
+			return CARResult{}, err
+		}
+		node := ipfs.File(encoded)
+		entries = append(entries, ipfs.Entry{Name: strconv.Itoa(token.id), Node: node})
+		result.Tokens[i].Metadata = node.CID.String()
+	}
+	encoded, err := encodeTokenJSON(plan.collection(imageBaseURI))
+	if err != nil {
+		return CARResult{}, err
+	}
+	contract := ipfs.File(encoded)
+	entries = append(entries, ipfs.Entry{Name: "contract.json", Node: contract})
+	root, err := ipfs.Directory(entries)
+	if err != nil {
+		return CARResult{}, WrapError(ErrInvalidInput, "build token directory", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return CARResult{}, WrapError(ErrMetadataInvalid, "create CAR directory", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return CARResult{}, WrapError(ErrMetadataInvalid, "create CAR file", err)
+	}
+	if err := ipfs.WriteCAR(file, []ipfs.CID{root.CID}, root.Blocks); err != nil {
+		_ = file.Close()
+		return CARResult{}, WrapError(ErrMetadataInvalid, "write CAR file", err)
+	}
+	if err := file.Close(); err != nil {
+		return CARResult{}, WrapError(ErrMetadataInvalid, "write CAR file", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return CARResult{}, WrapError(ErrMetadataInvalid, "inspect CAR file", err)
+	}
+	unique := map[ipfs.CID]bool{}
+	for _, block := range root.Blocks {
+		unique[block.CID] = true
+	}
+	result.Root = root.CID.String()
+	result.BaseURI = "ipfs://" + result.Root + "/"
+	result.Images = imagesDir.CID.String()
+	result.Contract = contract.CID.String()
+	result.Blocks = len(unique)
+	if err := plan.numbering.save(); err != nil {
+		return CARResult{}, err
+	}
+	result.Size = info.Size()
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package dalle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/ipfs"
+)
+
+func TestGenerateRecordsArtifactCIDs(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	result, err := engine.Generate(GenerateRequest{Input: "alpha", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for name, path := range map[string]string{ArtifactGenerated: result.Metadata.Artifacts.Generated, ArtifactAnnotated: result.Metadata.Artifacts.Annotated} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ipfs.File(data).CID.String(); result.Metadata.CIDs[name] != want {
+			t.Fatalf("%s CID %q, want %q", name, result.Metadata.CIDs[name], want)
+		}
+	}
+	if dressCID(result.Metadata.CIDs) != result.Metadata.CIDs[ArtifactAnnotated] {
+		t.Fatalf("dress CID should be the annotated image")
+	}
+	stored, err := engine.GetImage(result.Metadata.ImageID)
+	if err != nil {
+		t.Fatalf("GetImage: %v", err)
+	}
+	if stored.Metadata.CIDs[ArtifactGenerated] != result.Metadata.CIDs[ArtifactGenerated] {
+		t.Fatalf("CIDs not persisted: %+v", stored.Metadata.CIDs)
+	}
+}
+
+func TestEnginePackageCAR(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	first, err := engine.Generate(GenerateRequest{Input: "alpha", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := engine.Generate(GenerateRequest{Input: "bravo", Image: true}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	result, err := engine.PackageCAR(CAROptions{Series: first.Series})
+	if err != nil {
+		t.Fatalf("PackageCAR: %v", err)
+	}
+	if filepath.Base(result.Path) != "tokens.car" || len(result.Tokens) != 2 || result.BaseURI != "ipfs://"+result.Root+"/" {
+		t.Fatalf("unexpected package %+v", result)
+	}
+	if result.Tokens[0].Image != first.Metadata.CIDs[ArtifactAnnotated] {
+		t.Fatalf("token image CID %q, want the annotated CID %q", result.Tokens[0].Image, first.Metadata.CIDs[ArtifactAnnotated])
+	}
+
+	file, err := os.Open(result.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	roots, blocks, err := ipfs.ReadCAR(file)
+	if err != nil {
+		t.Fatalf("ReadCAR: %v", err)
+	}
+	if len(roots) != 1 || roots[0].String() != result.Root || len(blocks) != result.Blocks {
+		t.Fatalf("unexpected CAR roots %v with %d blocks", roots, len(blocks))
+	}
+	found := map[string]bool{}
+	for _, block := range blocks {
+		found[block.CID.String()] = true
+		if block.CID.String() == result.Tokens[0].Metadata && !strings.Contains(string(block.Data), `"image": "ipfs://`+result.Images+`/1.png"`) {
+			t.Fatalf("token metadata should point at the images directory: %s", block.Data)
+		}
+	}
+	for _, cid := range []string{result.Images, result.Contract, result.Tokens[0].Metadata, result.Tokens[1].Image} {
+		if !found[cid] {
+			t.Fatalf("CAR is missing block %s", cid)
+		}
+	}
+
+	if _, err := engine.PackageCAR(CAROptions{Series: first.Series, Out: "~/tokens.car"}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected a tilde path to be rejected, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	dalle "github.com/TrueBlocks/trueblocks-dalle/v6"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
 )
 
 type cliConfig struct {
@@ -121,12 +122,27 @@ func dispatch(engine *dalle.Engine, args []string, config cliConfig) error {
 		return runPreview(engine, args[1:], config.stdout)
 	case "generate":
 		return runGenerate(engine, args[1:], config.stdout)
+	case "storyboard":
+		return runStoryboard(engine, args[1:], config.stdout)
+	case "import":
+		return runImport(engine, args[1:], config.stdout)
 	case "images":
 		return runImages(engine, args[1:], config.stdout)
 	case "series":
 		return runSeries(engine, args[1:], config)
+	case "export":
+		return runExport(engine, args[1:], config.stdout)
 	case "databases":
 		return runDatabases(engine, args[1:], config.stdout)
+	case "keys":
+		if len(args) < 2 || args[1] != "create" {
+			return fmt.Errorf("keys subcommand must be create")
+		}
+		key, err := engine.CreateSigningKey()
+		if err != nil {
+			return err
+		}
+		return writeJSON(config.stdout, key)
 	case "validate":
 		if err := engine.Validate(); err != nil {
 			return err
@@ -166,31 +182,179 @@ func parseGenerateRequest(name string, args []string) (dalle.GenerateRequest, er
 	flags.SetOutput(io.Discard)
 	request := dalle.GenerateRequest{}
 	flags.StringVar(&request.Input, "input", "", "source input")
+	flags.StringVar(&request.InputKind, "input-kind", "", "input kind")
 	flags.StringVar(&request.Seed, "seed", "", "seed")
 	flags.StringVar(&request.Series, "series", "", "series")
 	flags.StringVar(&request.Recipe, "recipe", "", "recipe")
+	flags.StringVar(&request.SeedScheme, "seed-scheme", "", "seed scheme")
 	flags.BoolVar(&request.Enhance, "enhance", false, "enhance prompt")
 	flags.BoolVar(&request.Image, "image", false, "generate image")
 	flags.BoolVar(&request.Annotate, "annotate", false, "annotate generated image")
 	flags.BoolVar(&request.Force, "force", false, "ignore compatible cached metadata")
+	flags.BoolVar(&request.Sign, "sign", false, "sign the image with the data dir signing key")
+	flags.IntVar(&request.DuplicateThreshold, "warn-duplicates", 0, "list existing images within this many bits")
+	flags.StringVar(&request.Layout, "layout", "", "annotation layout")
+	flags.BoolVar(&request.Title, "title", false, "add the title block to the annotation")
+	flags.StringVar(&request.Contrast, "contrast", "", "WCAG contrast level for the caption")
+	flags.StringVar(&request.BandColors, "band-colors", "", "where the annotation band color comes from")
+	flags.IntVar(&request.Edition, "edition", 0, "edition number for the badge")
+	badge := dalle.BadgeConfig{}
+	flags.StringVar(&badge.Template, "badge", "", "badge text template")
+	flags.StringVar(&badge.Logo, "badge-logo", "", "badge logo PNG in the data dir badges folder")
+	flags.StringVar(&badge.Corner, "badge-corner", "", "badge corner")
+	flags.Float64Var(&badge.Opacity, "badge-opacity", 0, "badge opacity")
+	flags.Float64Var(&badge.Scale, "badge-scale", 0, "badge height as a share of the image height")
+	flags.IntVar(&badge.EditionSize, "edition-size", 0, "edition size for the badge")
+	overrides := keyValueFlag{}
+	flags.Var(overrides, "override", "pin an attribute as name=key or name=row")
+	font := annotate.FontOptions{}
+	flags.StringVar(&font.Family, "font-family", "", "annotation font family")
+	flags.StringVar(&font.File, "font-file", "", "annotation font file in the data dir fonts folder")
+	flags.StringVar(&font.Weight, "font-weight", "", "annotation font weight")
+	flags.Float64Var(&font.MinSize, "font-min", 0, "smallest annotation font size")
+	flags.Float64Var(&font.MaxSize, "font-max", 0, "largest annotation font size")
+	flags.Float64Var(&font.SizeScale, "font-scale", 0, "annotation font size scale")
+	flags.Float64Var(&font.LineSpacing, "line-spacing", 0, "annotation line spacing")
 	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
-		"input":    true,
-		"seed":     true,
-		"series":   true,
-		"recipe":   true,
-		"enhance":  false,
-		"image":    false,
-		"annotate": false,
-		"force":    false,
+		"font-family":     true,
+		"font-file":       true,
+		"font-weight":     true,
+		"font-min":        true,
+		"font-max":        true,
+		"font-scale":      true,
+		"line-spacing":    true,
+		"input":           true,
+		"seed":            true,
+		"series":          true,
+		"recipe":          true,
+		"seed-scheme":     true,
+		"input-kind":      true,
+		"enhance":         false,
+		"image":           false,
+		"annotate":        false,
+		"force":           false,
+		"sign":            false,
+		"warn-duplicates": true,
+		"layout":          true,
+		"title":           false,
+		"contrast":        true,
+		"band-colors":     true,
+		"edition":         true,
+		"badge":           true,
+		"badge-logo":      true,
+		"badge-corner":    true,
+		"badge-opacity":   true,
+		"badge-scale":     true,
+		"edition-size":    true,
+		"override":        true,
 	})); err != nil {
 		return dalle.GenerateRequest{}, err
 	}
+	if len(overrides) > 0 {
+		request.Overrides = overrides
+	}
+	if font != (annotate.FontOptions{}) {
+		request.Font = &font
+	}
+	if badge != (dalle.BadgeConfig{}) {
+		request.Badge = &badge
+	}
 	if request.Input == "" && flags.NArg() > 0 {
 		request.Input = strings.Join(flags.Args(), " ")
 	}
 	return request, nil
 }
 
+func runStoryboard(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("storyboard", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	request := dalle.StoryboardRequest{}
+	flags.StringVar(&request.Input, "input", "", "source input")
+	flags.StringVar(&request.InputKind, "input-kind", "", "input kind")
+	flags.StringVar(&request.Seed, "seed", "", "seed")
+	flags.StringVar(&request.Series, "series", "", "series")
+	flags.StringVar(&request.Recipe, "recipe", "", "recipe")
+	flags.StringVar(&request.SeedScheme, "seed-scheme", "", "seed scheme")
+	flags.IntVar(&request.Panels, "panels", dalle.DefaultStoryboardPanels, "number of panels")
+	fixed := stringListFlag{}
+	flags.Var(&fixed, "fixed", "attribute held across panels")
+	overrides := keyValueFlag{}
+	flags.Var(overrides, "override", "pin an attribute as name=key or name=row")
+	flags.StringVar(&request.Composite, "composite", "", "strip or grid")
+	flags.BoolVar(&request.Preview, "preview", false, "build prompts only")
+	flags.BoolVar(&request.Enhance, "enhance", false, "enhance prompts")
+	flags.BoolVar(&request.Image, "image", false, "generate images")
+	flags.BoolVar(&request.Annotate, "annotate", false, "annotate images")
+	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
+		"input":       true,
+		"seed":        true,
+		"series":      true,
+		"recipe":      true,
+		"seed-scheme": true,
+		"input-kind":  true,
+		"panels":      true,
+		"fixed":       true,
+		"override":    true,
+		"composite":   true,
+		"preview":     false,
+		"enhance":     false,
+		"image":       false,
+		"annotate":    false,
+	})); err != nil {
+		return err
+	}
+	if len(overrides) > 0 {
+		request.Overrides = overrides
+	}
+	request.Fixed = fixed
+	if request.Input == "" && flags.NArg() > 0 {
+		request.Input = strings.Join(flags.Args(), " ")
+	}
+	result, err := engine.Storyboard(request)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
+func runImport(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	request := dalle.ImportRequest{}
+	flags.StringVar(&request.Format, "format", "", "csv, txt or json")
+	flags.StringVar(&request.Manifest, "manifest", "", "manifest path")
+	flags.StringVar(&request.Series, "series", "", "series")
+	flags.StringVar(&request.SeedScheme, "seed-scheme", "", "seed scheme")
+	flags.IntVar(&request.Limit, "limit", 0, "maximum addresses")
+	flags.BoolVar(&request.Preview, "preview", false, "build prompts only")
+	flags.BoolVar(&request.Enhance, "enhance", false, "enhance prompts")
+	flags.BoolVar(&request.Image, "image", false, "generate images")
+	flags.BoolVar(&request.Annotate, "annotate", false, "annotate images")
+	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
+		"format":      true,
+		"manifest":    true,
+		"series":      true,
+		"seed-scheme": true,
+		"limit":       true,
+		"preview":     false,
+		"enhance":     false,
+		"image":       false,
+		"annotate":    false,
+	})); err != nil {
+		return err
+	}
+	path, err := requiredArg("import", flags.Args(), "address list file")
+	if err != nil {
+		return err
+	}
+	request.Path = path
+	result, err := engine.ImportAddresses(request)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
 func runImages(engine *dalle.Engine, args []string, stdout io.Writer) error {
 	if len(args) == 0 {
 		return fmt.Errorf("images subcommand is required")
@@ -240,11 +404,171 @@ func runImages(engine *dalle.Engine, args []string, stdout io.Writer) error {
 			return err
 		}
 		return writeJSON(stdout, result)
+	case "variations":
+		return runImagesVariations(engine, args[1:], stdout)
+	case "card":
+		return runImagesCard(engine, args[1:], stdout)
+	case "sheet":
+		return runImagesSheet(engine, args[1:], stdout)
+	case "inspect":
+		path, err := requiredArg("images inspect", args[1:], "PNG path")
+		if err != nil {
+			return err
+		}
+		inspection, err := engine.InspectImage(path)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, inspection)
+	case "sign":
+		id, err := requiredArg("images sign", args[1:], "image ID")
+		if err != nil {
+			return err
+		}
+		manifest, err := engine.SignImage(id)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, manifest)
+	case "verify":
+		target, err := requiredArg("images verify", args[1:], "image ID or PNG path")
+		if err != nil {
+			return err
+		}
+		verification, err := engine.VerifyImage(target)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, verification)
+	case "verify-all":
+		flags := flag.NewFlagSet("images verify-all", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		filter := dalle.VerifyImagesFilter{}
+		flags.StringVar(&filter.Series, "series", "", "series filter")
+		flags.BoolVar(&filter.MarkIncomplete, "mark-incomplete", false, "mark damaged records incomplete")
+		if err := flags.Parse(reorderFlagArgs(args[1:], map[string]bool{"series": true, "mark-incomplete": false})); err != nil {
+			return err
+		}
+		report, err := engine.VerifyImages(filter)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, report)
+	case "duplicates":
+		flags := flag.NewFlagSet("images duplicates", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		filter := dalle.DuplicatesFilter{}
+		series := stringListFlag{}
+		flags.Var(&series, "series", "series to compare (repeatable)")
+		flags.IntVar(&filter.Threshold, "threshold", dalle.DefaultDuplicateThreshold, "largest Hamming distance of a near-duplicate")
+		flags.StringVar(&filter.Hash, "hash", dalle.HashKindPHash, "phash or dhash")
+		if err := flags.Parse(reorderFlagArgs(args[1:], map[string]bool{"series": true, "threshold": true, "hash": true})); err != nil {
+			return err
+		}
+		filter.Series = series
+		report, err := engine.FindDuplicates(filter)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, report)
 	default:
 		return fmt.Errorf("unknown images subcommand %q", args[0])
 	}
 }
 
+func runImagesVariations(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("images variations", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	request := dalle.VariationsRequest{}
+	flags.IntVar(&request.Count, "count", dalle.DefaultVariationCount, "number of variants")
+	flags.StringVar(&request.Mode, "mode", dalle.VariationModeStep, "step or reseed")
+	attributes := stringListFlag{}
+	flags.Var(&attributes, "attribute", "attribute to vary")
+	flags.BoolVar(&request.Preview, "preview", false, "build prompts only")
+	flags.BoolVar(&request.Enhance, "enhance", false, "enhance prompts")
+	flags.BoolVar(&request.Image, "image", false, "generate images")
+	flags.BoolVar(&request.Annotate, "annotate", false, "annotate images")
+	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
+		"count":     true,
+		"mode":      true,
+		"attribute": true,
+		"preview":   false,
+		"enhance":   false,
+		"image":     false,
+		"annotate":  false,
+	})); err != nil {
+		return err
+	}
+	id, err := requiredArg("images variations", flags.Args(), "image ID")
+	if err != nil {
+		return err
+	}
+	request.ID = id
+	request.Attributes = attributes
+	result, err := engine.Variations(request)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
+func runImagesCard(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("images card", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	options := dalle.CardOptions{}
+	flags.StringVar(&options.Template, "template", "", "card template")
+	flags.StringVar(&options.Out, "out", "", "card path")
+	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{"template": true, "out": true})); err != nil {
+		return err
+	}
+	id, err := requiredArg("images card", flags.Args(), "image ID")
+	if err != nil {
+		return err
+	}
+	result, err := engine.RenderCard(id, options)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
+func runImagesSheet(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("images sheet", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	request := dalle.SheetRequest{}
+	series := stringListFlag{}
+	ids := stringListFlag{}
+	flags.Var(&series, "series", "series to include")
+	flags.Var(&ids, "id", "image to include")
+	flags.IntVar(&request.Latest, "latest", 0, "only the N most recent images")
+	flags.IntVar(&request.Columns, "columns", dalle.DefaultSheetColumns, "grid columns")
+	flags.IntVar(&request.CellSize, "cell", dalle.DefaultSheetCellSize, "cell size in pixels")
+	flags.StringVar(&request.Caption, "caption", dalle.SheetCaptionTitle, "title, terse or none")
+	flags.StringVar(&request.Sort, "sort", dalle.SheetSortInput, "input, series, title or newest")
+	flags.BoolVar(&request.Compare, "compare", false, "one column per series")
+	flags.StringVar(&request.Out, "out", "", "sheet path")
+	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
+		"series":  true,
+		"id":      true,
+		"latest":  true,
+		"columns": true,
+		"cell":    true,
+		"caption": true,
+		"sort":    true,
+		"out":     true,
+		"compare": false,
+	})); err != nil {
+		return err
+	}
+	request.Series = series
+	request.IDs = append(ids, flags.Args()...)
+	result, err := engine.ImageSheet(request)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
 func runImagesExport(engine *dalle.Engine, args []string, stdout io.Writer) error {
 	flags := flag.NewFlagSet("images export", flag.ContinueOnError)
 	flags.SetOutput(io.Discard)
@@ -256,14 +580,20 @@ func runImagesExport(engine *dalle.Engine, args []string, stdout io.Writer) erro
 	flags.BoolVar(&options.IncludeTerse, "terse", false, "export terse prompt")
 	flags.BoolVar(&options.IncludeEnhanced, "enhanced", false, "export enhanced prompt")
 	flags.BoolVar(&options.IncludeTechnical, "technical", false, "export technical prompt")
+	flags.StringVar(&options.Profile, "profile", "", "render a print-ready PNG with an export profile")
+	flags.BoolVar(&options.Card, "card", false, "render the image as a card")
+	flags.StringVar(&options.CardTemplate, "card-template", "", "card template")
 	if err := flags.Parse(reorderFlagArgs(args, map[string]bool{
-		"dir":       true,
-		"prompt":    false,
-		"data":      false,
-		"title":     false,
-		"terse":     false,
-		"enhanced":  false,
-		"technical": false,
+		"dir":           true,
+		"profile":       true,
+		"card-template": true,
+		"card":          false,
+		"prompt":        false,
+		"data":          false,
+		"title":         false,
+		"terse":         false,
+		"enhanced":      false,
+		"technical":     false,
 	})); err != nil {
 		return err
 	}
@@ -278,6 +608,93 @@ func runImagesExport(engine *dalle.Engine, args []string, stdout io.Writer) erro
 	return writeJSON(stdout, result)
 }
 
+func runExport(engine *dalle.Engine, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("export subcommand is required")
+	}
+	switch args[0] {
+	case "gallery":
+		flags := flag.NewFlagSet("export gallery", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		options := dalle.GalleryOptions{}
+		flags.StringVar(&options.Series, "series", "", "series to publish")
+		flags.StringVar(&options.Out, "out", "", "gallery directory")
+		flags.BoolVar(&options.Link, "link", false, "symlink assets instead of copying them")
+		if err := flags.Parse(reorderFlagArgs(args[1:], map[string]bool{"series": true, "out": true, "link": false})); err != nil {
+			return err
+		}
+		result, err := engine.ExportGallery(options)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, result)
+	case "tokens":
+		flags := flag.NewFlagSet("export tokens", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		options := dalle.TokenExportOptions{}
+		ids := stringListFlag{}
+		flags.StringVar(&options.Series, "series", "", "series to publish")
+		flags.Var(&ids, "id", "image to publish")
+		flags.StringVar(&options.Out, "out", "", "token directory")
+		flags.IntVar(&options.Start, "start", 0, "first token id of a new series")
+		flags.StringVar(&options.BaseURI, "base-uri", "", "contract base URI")
+		flags.StringVar(&options.ImageBaseURI, "image-base-uri", "", "token image base URI")
+		flags.StringVar(&options.ExternalURL, "external-url", "", "external link")
+		flags.StringVar(&options.Artifact, "artifact", dalle.ArtifactAnnotated, "annotated or generated")
+		flags.StringVar(&options.Name, "name", dalle.DefaultCollectionName, "collection name")
+		if err := flags.Parse(reorderFlagArgs(args[1:], map[string]bool{
+			"series":         true,
+			"id":             true,
+			"out":            true,
+			"start":          true,
+			"base-uri":       true,
+			"image-base-uri": true,
+			"external-url":   true,
+			"artifact":       true,
+			"name":           true,
+		})); err != nil {
+			return err
+		}
+		options.IDs = ids
+		result, err := engine.ExportTokens(options)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, result)
+	case "car":
+		flags := flag.NewFlagSet("export car", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		options := dalle.CAROptions{}
+		ids := stringListFlag{}
+		flags.StringVar(&options.Series, "series", "", "series to package")
+		flags.Var(&ids, "id", "image to package")
+		flags.StringVar(&options.Out, "out", "", "CAR file")
+		flags.IntVar(&options.Start, "start", 0, "first token id of a new series")
+		flags.StringVar(&options.ExternalURL, "external-url", "", "external link")
+		flags.StringVar(&options.Artifact, "artifact", dalle.ArtifactAnnotated, "annotated or generated")
+		flags.StringVar(&options.Name, "name", dalle.DefaultCollectionName, "collection name")
+		if err := flags.Parse(reorderFlagArgs(args[1:], map[string]bool{
+			"series":       true,
+			"id":           true,
+			"out":          true,
+			"start":        true,
+			"external-url": true,
+			"artifact":     true,
+			"name":         true,
+		})); err != nil {
+			return err
+		}
+		options.IDs = ids
+		result, err := engine.PackageCAR(options)
+		if err != nil {
+			return err
+		}
+		return writeJSON(stdout, result)
+	default:
+		return fmt.Errorf("unknown export subcommand %q", args[0])
+	}
+}
+
 func runSeries(engine *dalle.Engine, args []string, config cliConfig) error {
 	if len(args) == 0 {
 		return fmt.Errorf("series subcommand is required")
@@ -441,6 +858,38 @@ func runDatabases(engine *dalle.Engine, args []string, stdout io.Writer) error {
 	}
 }
 
+// keyValueFlag collects repeated name=value flags into a map.
+type keyValueFlag map[string]string
+
+func (values keyValueFlag) String() string {
+	parts := make([]string, 0, len(values))
+	for name, value := range values {
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (values keyValueFlag) Set(text string) error {
+	name, value, found := strings.Cut(text, "=")
+	if !found || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", text)
+	}
+	values[strings.TrimSpace(name)] = value
+	return nil
+}
+
+// stringListFlag collects a repeated flag into a list.
+type stringListFlag []string
+
+func (values *stringListFlag) String() string {
+	return strings.Join(*values, ",")
+}
+
+func (values *stringListFlag) Set(text string) error {
+	*values = append(*values, strings.TrimSpace(text))
+	return nil
+}
+
 func requiredArg(command string, args []string, name string) (string, error) {
 	if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
 		return "", fmt.Errorf("%s requires %s", command, name)
@@ -484,11 +933,43 @@ Usage:
 Commands:
   preview [flags] [input]                 build prompts without generating an image
   generate [flags] [input]                build prompts and generate artifacts
+  storyboard [flags] [input]              build a linked set of panels
+  import [flags] <file>                   generate for every address in a list
   images list [--series <name>]           list generated image records
-  images show <id>                        show one image record
+  images show <id>                        show one image record, including its
+                                          palette and color compliance score
   images export [flags] <id>              export image artifacts and prompts
   images delete <id>                      delete an image record
   images regenerate <id>                  regenerate an image
+  images variations [flags] <id>          vary one attribute at a time
+  images card [--template <name>] [--out <path>] <id>
+                                          render the image as a trading card
+                                          from a JSON layout in the cards
+                                          folder of the data directory
+  images sheet [flags] [id...]            compose images into a contact sheet
+  images inspect <png>                    read the provenance embedded in a PNG
+  images sign <id>                        write a signed manifest for an image
+  images verify <id|png>                  check an image against its signed manifest
+  images verify-all [--series <name>] [--mark-incomplete]
+                                          re-hash artifacts and report missing,
+                                          empty or changed files; marked
+                                          records are generated again
+  images duplicates [--series <name>]... [--threshold <bits>] [--hash <phash|dhash>]
+                                          cluster near-duplicate images by
+                                          perceptual hash (default 8 bits)
+  export gallery --series <name> [--out <dir>] [--link]
+                                          write a static HTML gallery with a
+                                          page per image and index.json;
+                                          assets are copied (or symlinked
+                                          with --link) so the site needs no
+                                          network (default dir:
+                                          output/<series>/gallery)
+  export tokens --series <name> [flags]   write ERC-721 token metadata for
+                                          contracts/dalle.sol
+  export car --series <name> [flags]      package the token export as a CARv1
+                                          file for an IPFS pinning service;
+                                          prints the root CID to use as the
+                                          contract base URI
   series list [flags]                     list series
   series show <name>                      show one series
   series save [flags] [suffix]            create or update a series
@@ -498,23 +979,164 @@ Commands:
   databases list                          list embedded database archives
   databases show <version>                show one database archive
   databases records [--limit <n>] <name>  list records from a database
+  keys create                             create the manifest signing key
   validate                                validate the engine configuration
   help                                    show this help screen
 
 Preview and generate flags:
   --input <text>    source input (may also be given as positional arguments)
+  --input-kind <kind>
+                    text, address, ens, tx or block (default: addresses
+                    with a valid checksum and transaction hashes are
+                    detected, anything else is text); addresses and hashes
+                    are lowercased, ENS names resolved through ens.json in
+                    the data directory
   --seed <text>     seed
   --series <name>   series
   --recipe <name>   recipe
+  --seed-scheme <name[@version]>
+                    seed scheme: sha256 (default), keccak256, address,
+                    hkdf-sha256
   --enhance         enhance the prompt
   --image           generate an image (generate only)
   --annotate        annotate the generated image (generate only)
   --force           ignore compatible cached metadata
+  --sign            write a signed manifest with the data dir signing key
+                    (see keys create); signed images are re-signed whenever
+                    they are generated again
+  --warn-duplicates <bits>
+                    list existing images whose perceptual hash is within
+                    <bits> of the new one (generate only)
+  --layout <bottom-band|top-band|overlay|side-panel|polaroid|card>
+                    annotation layout (default bottom-band)
+  --title           draw the title prompt above the caption
+  --contrast <AA|AAA>
+                    WCAG contrast the caption must meet (default AA)
+  --band-colors <image|series|attributes>
+                    take the band color from the image (default), the
+                    series colors or the selected color1..3
+  --badge <template>
+                    stamp a badge on the annotated image; the text/template
+                    sees the dress fields, .Metadata, .Edition and
+                    .EditionSize (default "{{.Series}} #{{.Edition}} /
+                    {{.EditionSize}}", parts left out when zero)
+  --badge-logo <file.png>
+                    logo drawn before the badge text, from the badges folder
+                    of the data directory
+  --badge-corner <top-left|top-right|bottom-left|bottom-right>
+                    badge corner (default bottom-right)
+  --badge-opacity <0-1>
+                    badge opacity (default 0.8)
+  --badge-scale <x> badge height as a share of the image height (default
+                    0.06)
+  --edition <n>, --edition-size <n>
+                    edition number and run size for the badge
+  --font-family <go|gomono|system|name>
+                    annotation font; other names are looked up as TTF/OTF
+                    files in the fonts folder of the data directory
+  --font-file <file>
+                    annotation font file in the fonts folder
+  --font-weight <regular|medium|bold>
+  --font-min <pt>, --font-max <pt>
+                    bounds for the fitted annotation font size (default
+                    1/96 and 1/16 of the image width)
+  --font-scale <x>  multiply the annotation font size bounds
+  --line-spacing <x>
+                    annotation line spacing (default 1.5)
+  --override <name=key|row>
+                    pin an attribute to a database key or filtered row index
+                    (repeatable), e.g. --override noun=octopus
+
+Storyboard flags:
+  --input --input-kind --seed --series --recipe --seed-scheme --override
+                    as for preview
+  --panels <n>      number of panels, 6-12 (default 6)
+  --fixed <name>    attribute held across panels (repeatable; default all but
+                    action, place, viewpoint and composition)
+  --composite <strip|grid>
+                    also render the panels into one image (requires --image)
+  --preview --enhance --image --annotate
+                    as for generate
+
+Import flags:
+  --format <csv|txt|json>
+                    address list format (default: from extension or content)
+  --manifest <path> address to image id manifest (default:
+                    output/<series>/imports/<file>.json in the data directory)
+  --series --seed-scheme --enhance --image --annotate
+                    as for generate
+  --limit <n>       import at most n addresses
+  --preview         build prompts and metadata only, no images
 
 Images export flags:
   --dir <path>      export directory
   --prompt --data --title --terse --enhanced --technical
                     select which prompts to export
+  --profile <name>  also render <name>.png for print: print-a4-300dpi,
+                    square-4k or poster-18x24 (size, margin, bleed,
+                    caption and DPI)
+  --card            also render card.png (see images card)
+  --card-template <name>
+                    card layout, cards/<name>.json in the data directory
+                    (default: cards/default.json, else the built-in card)
+
+Images sheet flags:
+  --series <name>   include the images of a series (repeatable; default all)
+  --id <id>         include one image (repeatable; ids may also be given as
+                    arguments)
+  --latest <n>      only the n most recently written images
+  --columns <n>     grid columns, 1-32 (default 4)
+  --cell <px>       cell size, 32-2048 (default 256)
+  --caption <title|terse|none>
+                    caption under each cell (default title)
+  --sort <input|series|title|newest>
+                    cell order (default input)
+  --compare         one column per --series (at least two) and one row per
+                    input, to see what each series does with the same input;
+                    --id picks the inputs
+  --out <path>      sheet path (default output/<series>/sheets/ or
+                    output/sheets/ in the data directory)
+
+Images variations flags:
+  --count <n>       number of variants (default 6)
+  --mode <mode>     step (next/previous row) or reseed (default step)
+  --attribute <name>
+                    attribute to vary (repeatable; default all)
+  --preview         build prompts and metadata only, no images
+  --enhance --image --annotate
+                    as for generate
+
+Export tokens flags:
+  --id <id>         publish one image (repeatable; default the whole series)
+  --out <path>      token directory (default output/<series>/tokens); each
+                    token is written as <dir>/<tokenId>, its image as
+                    images/<tokenId>.png, and the collection as
+                    contract.json
+  --start <n>       first token id of a series never exported before
+                    (default 1, the contract's first mint); an image keeps
+                    its token id in every later export (see
+                    output/<series>/tokens.json) and new images take the
+                    next free ids
+  --base-uri <uri>  contract base URI (default
+                    http://192.34.63.136:8080/dalle/<series>/)
+  --image-base-uri <uri>
+                    where the token images are served (default
+                    <base-uri>images/)
+  --external-url <url>
+                    external link for the tokens and collection
+  --artifact <annotated|generated>
+                    image to publish (default annotated)
+  --name <name>     collection name (default DalleDressV1)
+
+Export car flags:
+  --id <id>         package one image (repeatable; default the whole series)
+  --out <path>      CAR file (default output/<series>/tokens.car)
+  --start <n>       first token id of a new series, as for export tokens
+  --external-url <url>
+                    external link for the tokens and collection
+  --artifact <annotated|generated>
+                    image to package (default annotated)
+  --name <name>     collection name (default DalleDressV1)
 
 Series list flags:
   --include-hidden  include hidden series
@@ -206,3 +206,66 @@ func TestRunImagesShowMissing(t *testing.T) {
 		t.Fatalf("expected artifact missing error, got %s", stderr.String())
 	}
 }
+
+func TestRunPreviewWithOverride(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exit := run([]string{"--data-dir", filepath.Join(t.TempDir(), "dalle-data"), "preview", "--override", "emotion=0", "Person Tour Coordinates"}, testConfig(t, &stdout, &stderr))
+	if exit != 0 {
+		t.Fatalf("expected exit 0, got %d: %s", exit, stderr.String())
+	}
+	var result dalle.GenerateResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("decode result: %v\n%s", err, stdout.String())
+	}
+	if result.Metadata.Input != "Person Tour Coordinates" || result.Metadata.Overrides["emotion"] != "0" {
+		t.Fatalf("expected override in metadata: %#v", result.Metadata)
+	}
+}
+
+func TestRunImagesVariationsPreview(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "dalle-data")
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	if exit := run([]string{"--data-dir", dataDir, "preview", "Person Tour Coordinates"}, testConfig(t, &stdout, &stderr)); exit != 0 {
+		t.Fatalf("preview exit %d: %s", exit, stderr.String())
+	}
+	var parent dalle.GenerateResult
+	if err := json.Unmarshal(stdout.Bytes(), &parent); err != nil {
+		t.Fatalf("decode parent: %v", err)
+	}
+
+	stdout.Reset()
+	exit := run([]string{"--data-dir", dataDir, "images", "variations", "--preview", "--count", "2", "--attribute", "noun", parent.Metadata.ImageID}, testConfig(t, &stdout, &stderr))
+	if exit != 0 {
+		t.Fatalf("expected exit 0, got %d: %s", exit, stderr.String())
+	}
+	var result dalle.VariationsResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("decode result: %v\n%s", err, stdout.String())
+	}
+	if result.ParentImageID != parent.Metadata.ImageID || len(result.Variants) != 2 {
+		t.Fatalf("unexpected variations result: %#v", result)
+	}
+	for _, variant := range result.Variants {
+		if variant.Metadata.Lineage == nil || variant.Metadata.Lineage.Attribute != "noun" || variant.GeneratedPath != "" {
+			t.Fatalf("unexpected variant: %#v", variant.Metadata)
+		}
+	}
+}
+
+func TestRunStoryboardPreview(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exit := run([]string{"--data-dir", filepath.Join(t.TempDir(), "dalle-data"), "storyboard", "--preview", "--panels", "6", "--fixed", "action", "Person Tour Coordinates"}, testConfig(t, &stdout, &stderr))
+	if exit != 0 {
+		t.Fatalf("expected exit 0, got %d: %s", exit, stderr.String())
+	}
+	var result dalle.StoryboardResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("decode result: %v\n%s", err, stdout.String())
+	}
+	if result.StoryboardID == "" || len(result.Panels) != 6 || len(result.Fixed) != 1 || result.Fixed[0] != "action" {
+		t.Fatalf("unexpected storyboard result: %#v", result)
+	}
+}
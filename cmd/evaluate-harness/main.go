@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	dalle "github.com/TrueBlocks/trueblocks-dalle/v6"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/palette"
 )
 
 type testRecord struct {
@@ -73,12 +77,14 @@ type config struct {
 }
 
 type metadata struct {
-	Input           string            `json:"input"`
-	Seed            string            `json:"seed"`
-	Series          metadataSeries    `json:"series"`
-	Recipe          metadataRecipe    `json:"recipe"`
-	SelectedRecords []selectedRecord  `json:"selectedRecords"`
-	Prompts         prompts           `json:"prompts"`
+	Input           string                 `json:"input"`
+	Seed            string                 `json:"seed"`
+	Series          metadataSeries         `json:"series"`
+	Recipe          metadataRecipe         `json:"recipe"`
+	Overrides       map[string]string      `json:"overrides"`
+	SelectedRecords []selectedRecord       `json:"selectedRecords"`
+	Prompts         prompts                `json:"prompts"`
+	Palette         *dalle.MetadataPalette `json:"palette"`
 }
 
 type metadataSeries struct {
@@ -227,6 +233,10 @@ func evaluate(cfg config, records []testRecord) error {
 		if err != nil {
 			return err
 		}
+		colors := meta.Palette
+		if colors == nil && imageRel != "" {
+			colors = annotatedPalette(filepath.Join(outDir, imageRel), selected)
+		}
 
 		results = append(results, recordResult{
 			series:        rec.series,
@@ -236,6 +246,7 @@ func evaluate(cfg config, records []testRecord) error {
 			selected:      selected,
 			prompts:       prompts,
 			checks:        checks,
+			palette:       colors,
 			imageRelative: imageRel,
 		})
 	}
@@ -257,6 +268,7 @@ type recordResult struct {
 	selected      map[string]string
 	prompts       prompts
 	checks        map[string]bool
+	palette       *dalle.MetadataPalette
 	imageRelative string
 }
 
@@ -288,6 +300,7 @@ func regenerateRecord(engine *dalle.Engine, sourceDir string, rec testRecord, wi
 		Series:    meta.Series.Name,
 		Recipe:    meta.Recipe.Name,
 		Backstyle: backstyle,
+		Overrides: meta.Overrides,
 		Enhance:   strings.TrimSpace(meta.Prompts.EnhancedPrompt) != "",
 		Image:     withImage,
 		Annotate:  withImage,
@@ -409,6 +422,65 @@ func copyImage(sourceDir, series, id, imagesDir, outDir string) (string, error)
 	return rel, nil
 }
 
+// annotatedPalette scores the annotated image of a record written before
+// palettes were recorded. The annotation band is part of the image, so the
+// score is only a guide.
+func annotatedPalette(path string, selected map[string]string) *dalle.MetadataPalette {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil
+	}
+	recorded := &dalle.MetadataPalette{Colors: palette.Extract(img, palette.DefaultColors)}
+	for _, attr := range []string{"color1", "color2", "color3"} {
+		for part := range strings.SplitSeq(selected[attr], ",") {
+			if p := strings.TrimSpace(part); strings.HasPrefix(p, "#") {
+				recorded.Targets = append(recorded.Targets, strings.ToLower(p))
+			}
+		}
+	}
+	recorded.Compliance = palette.Score(recorded.Colors, recorded.Targets, 0)
+	return recorded
+}
+
+func writePalette(b *strings.Builder, recorded *dalle.MetadataPalette) {
+	fmt.Fprintf(b, "### Color Compliance\n\n")
+	if recorded == nil {
+		fmt.Fprintf(b, "N/A\n\n")
+		return
+	}
+	swatches := make([]string, 0, len(recorded.Colors))
+	for _, swatch := range recorded.Colors {
+		swatches = append(swatches, fmt.Sprintf("`%s` %.0f%%", swatch.Hex, swatch.Share*100))
+	}
+	fmt.Fprintf(b, "**Palette:** %s  \n", strings.Join(swatches, ", "))
+	compliance := recorded.Compliance
+	if compliance == nil {
+		fmt.Fprintf(b, "**Score:** N/A (no target colors)\n\n")
+		return
+	}
+	limit := "none"
+	if compliance.Limit > 0 {
+		limit = fmt.Sprintf("%d", compliance.Limit)
+	}
+	fmt.Fprintf(b, "**Score:** %.1f/100 (on-palette %.0f%%, %d/%d targets, %d distinct colors, limit %s)\n\n",
+		compliance.Score, compliance.OnPalette*100, compliance.TargetsPresent, len(compliance.Targets), compliance.DistinctColors, limit)
+	fmt.Fprintf(b, "| Target | Closest | Distance | Present |\n")
+	fmt.Fprintf(b, "|---|---|---|---|\n")
+	for _, target := range compliance.Targets {
+		mark := "❌"
+		if target.Present {
+			mark = "✅"
+		}
+		fmt.Fprintf(b, "| `%s` | `%s` | %.3f | %s |\n", target.Hex, target.Closest, target.Distance, mark)
+	}
+	fmt.Fprintf(b, "\n")
+}
+
 func writeScoringSheet(results []recordResult, sourceLabel, outPath string) error {
 	var b strings.Builder
 	fmt.Fprintf(&b, "# Dalle Prompt-Image Alignment Scoring Sheet\n\n")
@@ -452,6 +524,8 @@ func writeScoringSheet(results []recordResult, sourceLabel, outPath string) erro
 		}
 		fmt.Fprintf(&b, "| **Total** | **%d/%d** | |\n\n", present, len(attributeNames))
 
+		writePalette(&b, r.palette)
+
 		fmt.Fprintf(&b, "### Prompts\n\n")
 		fmt.Fprintf(&b, "**Basic:**\n")
 		fmt.Fprintf(&b, "```\n%s\n```\n\n", r.prompts.Prompt)
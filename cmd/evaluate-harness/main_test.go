@@ -1,6 +1,10 @@
 package main
 
 import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
@@ -74,6 +78,9 @@ func TestRunProducesScoringSheet(t *testing.T) {
 	if !strings.Contains(got, "N/A") {
 		t.Errorf("missing N/A placeholder for empty enhanced prompt")
 	}
+	if !strings.Contains(got, "### Color Compliance\n\nN/A") {
+		t.Errorf("missing N/A placeholder for an undecodable image's palette")
+	}
 }
 
 func TestRunSingleRecord(t *testing.T) {
@@ -160,3 +167,30 @@ func TestAttributePresent(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotatedPaletteScoresArchivedImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotated.png")
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{R: 0xFF, G: 0x63, B: 0x47, A: 0xFF}}, image.Point{}, draw.Src)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	recorded := annotatedPalette(path, map[string]string{"color1": "tomato,#FF6347", "color2": "none"})
+	if recorded == nil || recorded.Compliance == nil || recorded.Compliance.Score != 100 {
+		t.Fatalf("expected a full score for an all-tomato image, got %+v", recorded)
+	}
+	var b strings.Builder
+	writePalette(&b, recorded)
+	if got := b.String(); !strings.Contains(got, "**Score:** 100.0/100") || !strings.Contains(got, "| `#ff6347` | `#ff6347` |") {
+		t.Errorf("unexpected palette section:\n%s", got)
+	}
+	if annotatedPalette(filepath.Join(t.TempDir(), "missing.png"), nil) != nil {
+		t.Error("expected no palette for a missing image")
+	}
+}
@@ -0,0 +1,36 @@
+package dalle
+
+import (
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/palette"
+)
+
+// MetadataPalette records the dominant colors of the generated image and,
+// when the image was asked for particular colors, how closely it kept to
+// them. Targets are the hex colors of color1..3 and ColorLimit is the
+// series limit as written.
+type MetadataPalette struct {
+	Colors     []palette.Swatch    `json:"colors"`
+	Targets    []string            `json:"targets,omitempty"`
+	ColorLimit string              `json:"colorLimit,omitempty"`
+	Compliance *palette.Compliance `json:"compliance,omitempty"`
+}
+
+// imagePalette extracts the palette of the image at path and scores it
+// against the dress's colors. It returns nil when the image cannot be read.
+func imagePalette(path string, dress *model.DalleDress) *MetadataPalette {
+	if path == "" {
+		return nil
+	}
+	img, err := decodeImageFile(path)
+	if err != nil {
+		return nil
+	}
+	recorded := &MetadataPalette{Colors: palette.Extract(img, palette.DefaultColors)}
+	if dress != nil {
+		recorded.Targets = dressColors(dress)
+		recorded.ColorLimit = dress.ColorLimit
+	}
+	recorded.Compliance = palette.Score(recorded.Colors, recorded.Targets, palette.ParseLimit(recorded.ColorLimit))
+	return recorded
+}
@@ -0,0 +1,39 @@
+package dalle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEngineGenerateRecordsPalette(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = midToneImages
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	recorded := result.Metadata.Palette
+	if recorded == nil || len(recorded.Colors) != 1 || recorded.Colors[0].Hex != "#777777" || recorded.Colors[0].Share != 1 {
+		t.Fatalf("expected the flat gray palette, got %+v", recorded)
+	}
+	want := dressColorsOf(result.Metadata)
+	if len(want) == 0 || !reflect.DeepEqual(recorded.Targets, want) {
+		t.Fatalf("targets = %v, want %v", recorded.Targets, want)
+	}
+	if recorded.Compliance == nil || len(recorded.Compliance.Targets) != len(want) {
+		t.Fatalf("expected a compliance score against every target, got %+v", recorded.Compliance)
+	}
+
+	record, err := engine.GetImage(result.Metadata.ImageID)
+	if err != nil || !reflect.DeepEqual(record.Metadata.Palette, recorded) {
+		t.Fatalf("expected the palette in the stored record, got %+v, %v", record.Metadata.Palette, err)
+	}
+
+	prompts, err := engine.Generate(GenerateRequest{Input: "prompts only"})
+	if err != nil || prompts.Metadata.Palette != nil {
+		t.Fatalf("expected no palette without an image, got %+v, %v", prompts.Metadata.Palette, err)
+	}
+}
@@ -69,24 +69,43 @@ func (ctx *Context) reportOn(dd *model.DalleDress, addr, loc, ft, value string)
 
 // MakeDalleDress builds or retrieves a DalleDress for the given address using the context's templates, series, dbs, and cache.
 func (ctx *Context) MakeDalleDress(addressIn string) (*model.DalleDress, error) {
-	return ctx.makeDalleDress(addressIn, "", true)
+	return ctx.makeDalleDress(addressIn, dressOptions{}, true)
 }
 
 // PreviewDalleDress builds or retrieves a DalleDress without writing prompt sidecars.
 func (ctx *Context) PreviewDalleDress(addressIn string) (*model.DalleDress, error) {
-	return ctx.makeDalleDress(addressIn, "", false)
+	return ctx.makeDalleDress(addressIn, dressOptions{}, false)
 }
 
-func (ctx *Context) makeDalleDress(addressIn, backstyle string, writeReports bool) (*model.DalleDress, error) {
+// dressOptions carries per-request adjustments applied on top of the seed-derived
+// attribute selection.
+type dressOptions struct {
+	backstyle string
+	overrides map[string]string
+	reseeds   map[string]int
+	scheme    SeedScheme
+}
+
+func (ctx *Context) makeDalleDress(addressIn string, options dressOptions, writeReports bool) (*model.DalleDress, error) {
 	ctx.CacheMutex.Lock()
 	defer ctx.CacheMutex.Unlock()
 
-	resolvedBackstyle := strings.TrimSpace(backstyle)
+	resolvedBackstyle := strings.TrimSpace(options.backstyle)
 	if resolvedBackstyle == "" {
 		resolvedBackstyle = defaultBackstyle()
 	}
 
-	cacheKey := addressIn + "|" + resolvedBackstyle
+	variant := ""
+	if len(options.overrides) > 0 {
+		variant += "|" + canonicalOverrides(options.overrides)
+	}
+	if len(options.reseeds) > 0 {
+		variant += "|reseeds=" + canonicalReseeds(options.reseeds)
+	}
+	if options.scheme != nil && !isDefaultSeedScheme(options.scheme.Name(), options.scheme.Version()) {
+		variant += "|" + seedSchemeReference(options.scheme)
+	}
+	cacheKey := addressIn + "|" + resolvedBackstyle + variant
 	if ctx.DalleCache[cacheKey] != nil {
 		if writeReports {
 			ctx.reportDalleDress(ctx.DalleCache[cacheKey], addressIn)
@@ -95,19 +114,22 @@ func (ctx *Context) makeDalleDress(addressIn, backstyle string, writeReports boo
 	}
 
 	address := addressIn
-	// ENS resolution should be handled outside, but you can add it here if needed
+	// ENS names are resolved before this point by the engine input adapters (see NormalizeInput).
 
-	parts := strings.Split(address, ",")
-	seed := parts[0] + utils.Reverse(parts[0])
-	if len(seed) < 66 {
-		return nil, fmt.Errorf("seed length is less than 66")
+	scheme := options.scheme
+	if scheme == nil {
+		scheme = sha256Scheme{}
 	}
-	if strings.HasPrefix(seed, "0x") {
-		seed = seed[2:66]
+	// Generate attributes from the seed, at most one per attribute name; schemes
+	// with a short seed (the legacy ones) return fewer.
+	parts := strings.Split(address, ",")
+	seed, chunks, err := scheme.Chunks(parts[0], len(prompt.AttributeNames()))
+	if err != nil {
+		return nil, err
 	}
 
 	fn := utils.ValidFilename(address)
-	fnKey := fn + "|" + resolvedBackstyle
+	fnKey := fn + "|" + resolvedBackstyle + variant
 	if ctx.DalleCache[fnKey] != nil {
 		if writeReports {
 			ctx.reportDalleDress(ctx.DalleCache[fnKey], addressIn)
@@ -128,30 +150,20 @@ func (ctx *Context) makeDalleDress(addressIn, backstyle string, writeReports boo
 		ColorLimit:      ctx.Series.ColorLimit,
 	}
 
-	// Generate attributes from the seed. We cap the number of attributes to the number of
-	// configured databases (DatabaseNames) and carefully guard slice bounds so we never
-	// index past the seed or database lists. The original logic could overrun both the
-	// seed slicing (i+6) and the database name list when the seed was long enough to
-	// create more than len(DatabaseNames) attributes.
-	maxAttribs := len(prompt.DatabaseNames)
-	cnt := 0
-	for i := 0; i+6 <= len(dd.Seed) && cnt < maxAttribs; i += 8 {
-		attr := prompt.NewAttribute(ctx.Databases, cnt, dd.Seed[i:i+6])
+	for cnt, chunk := range chunks {
+		attr := prompt.NewAttribute(ctx.Databases, cnt, chunk)
 		dd.Attribs = append(dd.Attribs, attr)
 		dd.AttribMap[attr.Name] = attr
 		dd.SeedChunks = append(dd.SeedChunks, attr.Value)
 		dd.SelectedTokens = append(dd.SelectedTokens, attr.Name)
 		dd.SelectedRecords = append(dd.SelectedRecords, attr.Value)
-		cnt++
-		if cnt < maxAttribs && i+4+6 <= len(dd.Seed) {
-			attr = prompt.NewAttribute(ctx.Databases, cnt, dd.Seed[i+4:i+4+6])
-			dd.Attribs = append(dd.Attribs, attr)
-			dd.AttribMap[attr.Name] = attr
-			dd.SeedChunks = append(dd.SeedChunks, attr.Value)
-			dd.SelectedTokens = append(dd.SelectedTokens, attr.Name)
-			dd.SelectedRecords = append(dd.SelectedRecords, attr.Value)
-			cnt++
-		}
+	}
+
+	if err := ctx.applyOverrides(&dd, options.overrides); err != nil {
+		return nil, err
+	}
+	if err := ctx.applyReseeds(&dd, options.reseeds); err != nil {
+		return nil, err
 	}
 
 	backAttr := prompt.Attribute{
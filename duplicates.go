@@ -0,0 +1,244 @@
+package dalle
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/phash"
+)
+
+const (
+	HashKindPHash = "phash"
+	HashKindDHash = "dhash"
+
+	// DefaultDuplicateThreshold is the largest Hamming distance between two
+	// 64-bit hashes that still counts as a near-duplicate.
+	DefaultDuplicateThreshold = 8
+)
+
+// PerceptualHash holds the 64-bit perceptual hashes of the generated image
+// as 16 hex digits. Images that look alike have hashes a few bits apart.
+type PerceptualHash struct {
+	DHash string `json:"dhash"`
+	PHash string `json:"phash"`
+}
+
+// DuplicatesFilter selects the records FindDuplicates compares. An empty
+// Series compares every series; Threshold zero is DefaultDuplicateThreshold
+// and an empty Hash is HashKindPHash.
+type DuplicatesFilter struct {
+	Series    []string `json:"series,omitempty"`
+	Threshold int      `json:"threshold,omitempty"`
+	Hash      string   `json:"hash,omitempty"`
+}
+
+// DuplicateMatch is one image of a near-duplicate cluster. Distance is
+// measured from the first image of its cluster, or from the new image in a
+// GenerateResult.
+type DuplicateMatch struct {
+	ImageID  string `json:"imageId"`
+	Series   string `json:"series"`
+	Seed     string `json:"seed"`
+	Path     string `json:"path"`
+	Hash     string `json:"hash"`
+	Distance int    `json:"distance"`
+}
+
+// DuplicateCluster is a group of images linked by pairs within the
+// threshold. MaxDistance is the largest distance between any two members.
+type DuplicateCluster struct {
+	Images      []DuplicateMatch `json:"images"`
+	MaxDistance int              `json:"maxDistance"`
+}
+
+// DuplicatesReport summarizes a FindDuplicates run. Unhashed counts records
+// without a decodable generated image.
+type DuplicatesReport struct {
+	Hash      string             `json:"hash"`
+	Threshold int                `json:"threshold"`
+	Checked   int                `json:"checked"`
+	Unhashed  int                `json:"unhashed"`
+	Clusters  []DuplicateCluster `json:"clusters"`
+}
+
+type hashedImage struct {
+	match DuplicateMatch
+	hash  phash.Hash
+}
+
+// FindDuplicates clusters the images of the selected series whose
+// perceptual hashes are within the threshold of each other. Records written
+// before hashes were recorded are hashed from their generated image.
+func (engine *Engine) FindDuplicates(filter DuplicatesFilter) (DuplicatesReport, error) {
+	if engine == nil {
+		return DuplicatesReport{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	kind, threshold, err := duplicateSettings(filter.Hash, filter.Threshold)
+	if err != nil {
+		return DuplicatesReport{}, err
+	}
+	series := map[string]bool{}
+	for _, name := range filter.Series {
+		if name = strings.TrimSpace(name); name != "" {
+			series[name] = true
+		}
+	}
+	records, err := engine.ListImages(ImageFilter{})
+	if err != nil {
+		return DuplicatesReport{}, err
+	}
+	report := DuplicatesReport{Hash: kind, Threshold: threshold, Clusters: []DuplicateCluster{}}
+	images := []hashedImage{}
+	for _, record := range records {
+		if len(series) > 0 && !series[record.Metadata.Series.Name] {
+			continue
+		}
+		report.Checked++
+		hashed, ok := hashedRecord(record, kind)
+		if !ok {
+			report.Unhashed++
+			continue
+		}
+		images = append(images, hashed)
+	}
+
+	// Union-find over every pair within the threshold.
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if phash.Distance(images[i].hash, images[j].hash) <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	groups := map[int][]hashedImage{}
+	roots := []int{}
+	for i, hashed := range images {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], hashed)
+	}
+	for _, root := range roots {
+		members := groups[root]
+		if len(members) < 2 {
+			continue
+		}
+		cluster := DuplicateCluster{Images: make([]DuplicateMatch, 0, len(members))}
+		for i, member := range members {
+			member.match.Distance = phash.Distance(members[0].hash, member.hash)
+			cluster.Images = append(cluster.Images, member.match)
+			for _, other := range members[i+1:] {
+				cluster.MaxDistance = max(cluster.MaxDistance, phash.Distance(member.hash, other.hash))
+			}
+		}
+		report.Clusters = append(report.Clusters, cluster)
+	}
+	sort.SliceStable(report.Clusters, func(i, j int) bool {
+		return len(report.Clusters[i].Images) > len(report.Clusters[j].Images)
+	})
+	return report, nil
+}
+
+// nearDuplicates lists the other images whose pHash is within threshold of
+// metadata's, closest first.
+func (engine *Engine) nearDuplicates(metadata ImageMetadata, threshold int) ([]DuplicateMatch, error) {
+	if metadata.PerceptualHash == nil {
+		return nil, nil
+	}
+	hash, err := phash.Parse(metadata.PerceptualHash.PHash)
+	if err != nil {
+		return nil, nil
+	}
+	records, err := engine.ListImages(ImageFilter{})
+	if err != nil {
+		return nil, err
+	}
+	matches := []DuplicateMatch{}
+	for _, record := range records {
+		if record.Metadata.ImageID == metadata.ImageID {
+			continue
+		}
+		hashed, ok := hashedRecord(record, HashKindPHash)
+		if !ok {
+			continue
+		}
+		if distance := phash.Distance(hash, hashed.hash); distance <= threshold {
+			hashed.match.Distance = distance
+			matches = append(matches, hashed.match)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+	return matches, nil
+}
+
+func duplicateSettings(kind string, threshold int) (string, int, error) {
+	switch kind = strings.ToLower(strings.TrimSpace(kind)); kind {
+	case "":
+		kind = HashKindPHash
+	case HashKindPHash, HashKindDHash:
+	default:
+		return "", 0, NewError(ErrInvalidInput, "unknown hash "+kind+" (phash or dhash)")
+	}
+	if threshold < 0 || threshold > 64 {
+		return "", 0, NewError(ErrInvalidInput, "threshold must be between 0 and 64 bits")
+	}
+	if threshold == 0 {
+		threshold = DefaultDuplicateThreshold
+	}
+	return kind, threshold, nil
+}
+
+// hashedRecord returns the record's recorded hash of the given kind, or
+// hashes its generated image when none was recorded.
+func hashedRecord(record ImageMetadataRecord, kind string) (hashedImage, bool) {
+	hashes := record.Metadata.PerceptualHash
+	if hashes == nil {
+		if hashes = perceptualHashOf(record.Metadata.Artifacts.Generated); hashes == nil {
+			return hashedImage{}, false
+		}
+	}
+	text := hashes.PHash
+	if kind == HashKindDHash {
+		text = hashes.DHash
+	}
+	hash, err := phash.Parse(text)
+	if err != nil {
+		return hashedImage{}, false
+	}
+	return hashedImage{
+		match: DuplicateMatch{
+			ImageID: record.Metadata.ImageID,
+			Series:  record.Metadata.Series.Name,
+			Seed:    record.Metadata.Seed,
+			Path:    record.Metadata.Artifacts.Generated,
+			Hash:    text,
+		},
+		hash: hash,
+	}, true
+}
+
+// perceptualHashOf hashes the image at path. Missing files and files that do
+// not decode, such as the empty placeholders written without a provider key,
+// have no hash.
+func perceptualHashOf(path string) *PerceptualHash {
+	if path == "" {
+		return nil
+	}
+	img, err := decodeImageFile(path)
+	if err != nil {
+		return nil
+	}
+	return &PerceptualHash{DHash: phash.DHash(img).String(), PHash: phash.PHash(img).String()}
+}
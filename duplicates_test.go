@@ -0,0 +1,102 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patternImages writes a 64x64 PNG of vertical or horizontal bars, offset
+// in brightness, so that bars of the same direction are near-duplicates.
+func patternImages(vertical *bool, offset *uint8) func(imageRequest) (imageResult, error) {
+	return func(request imageRequest) (imageResult, error) {
+		if err := os.MkdirAll(filepath.Dir(request.generatedPath), 0o750); err != nil {
+			return imageResult{}, err
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				position := y
+				if *vertical {
+					position = x
+				}
+				v := uint8(40 + 3*position + int(*offset))
+				img.Set(x, y, color.RGBA{R: v, G: v, B: 255 - v, A: 0xFF})
+			}
+		}
+		file, err := os.Create(request.generatedPath)
+		if err != nil {
+			return imageResult{}, err
+		}
+		defer file.Close()
+		return imageResult{generatedPath: request.generatedPath}, png.Encode(file, img)
+	}
+}
+
+func TestEngineFindDuplicates(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	vertical, offset := true, uint8(0)
+	engine.requestImage = patternImages(&vertical, &offset)
+
+	first, err := engine.Generate(GenerateRequest{Input: "first", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if first.Metadata.PerceptualHash == nil || len(first.Metadata.PerceptualHash.PHash) != 16 || len(first.Metadata.PerceptualHash.DHash) != 16 {
+		t.Fatalf("expected perceptual hashes in the metadata, got %+v", first.Metadata.PerceptualHash)
+	}
+	offset = 10
+	second, err := engine.Generate(GenerateRequest{Input: "second", Image: true, DuplicateThreshold: DefaultDuplicateThreshold})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(second.Duplicates) != 1 || second.Duplicates[0].ImageID != first.Metadata.ImageID {
+		t.Fatalf("expected a warning about the first image, got %+v", second.Duplicates)
+	}
+	vertical = false
+	third, err := engine.Generate(GenerateRequest{Input: "third", Image: true, DuplicateThreshold: DefaultDuplicateThreshold})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(third.Duplicates) != 0 {
+		t.Fatalf("expected no near-duplicates of a different image, got %+v", third.Duplicates)
+	}
+
+	// Records from before hashes were recorded are hashed on the fly.
+	record, err := engine.GetImage(second.Metadata.ImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Metadata.PerceptualHash = nil
+	if _, err := WriteImageMetadata(engine.dataDir, record.Metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := engine.FindDuplicates(DuplicatesFilter{})
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if report.Checked != 3 || report.Unhashed != 0 || len(report.Clusters) != 1 || len(report.Clusters[0].Images) != 2 {
+		t.Fatalf("expected one cluster of two, got %+v", report)
+	}
+	ids := map[string]bool{}
+	for _, match := range report.Clusters[0].Images {
+		ids[match.ImageID] = true
+	}
+	if !ids[first.Metadata.ImageID] || !ids[second.Metadata.ImageID] {
+		t.Fatalf("unexpected cluster %+v", report.Clusters[0])
+	}
+
+	if report, err = engine.FindDuplicates(DuplicatesFilter{Series: []string{"no-such-series"}}); err != nil || report.Checked != 0 {
+		t.Fatalf("expected a series filter to exclude every image, got %+v, %v", report, err)
+	}
+	if _, err := engine.FindDuplicates(DuplicatesFilter{Hash: "md5"}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an unknown hash to be rejected, got %v", err)
+	}
+}
@@ -4,15 +4,18 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/image"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/progress"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/prompt"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/storage"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/utils"
 )
 
 const DefaultSeriesName = "empty"
@@ -25,6 +28,13 @@ type Config struct {
 	DataDir    string         `json:"dataDir,omitempty"`
 	Provider   ProviderConfig `json:"provider,omitempty"`
 	ImageModel string         `json:"imageModel,omitempty"`
+	// ENSResolver resolves .eth inputs. When nil, names are looked up in
+	// ens.json in the data directory (see FileENSResolver).
+	ENSResolver ENSResolver `json:"-"`
+	// Variants are the web sizes derived from every image. When nil they
+	// are read from variants.json in the data directory, or default to
+	// DefaultVariants; an empty list turns them off.
+	Variants []VariantSpec `json:"variants,omitempty"`
 }
 
 type Engine struct {
@@ -32,6 +42,8 @@ type Engine struct {
 	provider      ProviderConfig
 	imageModel    string
 	database      storage.DatabaseArchiveManifest
+	ensResolver   ENSResolver
+	variants      []VariantSpec
 	enhancePrompt func(basePrompt, authorContext string) (string, error)
 	requestImage  func(request imageRequest) (imageResult, error)
 }
@@ -50,23 +62,67 @@ type imageRequest struct {
 	tersePrompt     string
 	baseURL         string
 	imageModel      string
+	annotation      annotate.Options
 }
 
 type imageResult struct {
 	generatedPath string
 	annotatedPath string
+	payload       *image.Payload
+	colors        *annotate.Colors
 }
 
 type GenerateRequest struct {
-	Input    string `json:"input"`
-	Seed     string `json:"seed,omitempty"`
-	Series   string `json:"series,omitempty"`
-	Recipe   string `json:"recipe,omitempty"`
+	Input string `json:"input"`
+	// InputKind forces how Input is interpreted (text, address, ens, tx or
+	// block). Empty detects addresses and transaction hashes (see
+	// DetectInputKind) and reads anything else as text.
+	InputKind string `json:"inputKind,omitempty"`
+	Seed      string `json:"seed,omitempty"`
+	Series    string `json:"series,omitempty"`
+	Recipe    string `json:"recipe,omitempty"`
 	Backstyle string `json:"backstyle,omitempty"`
-	Enhance  bool   `json:"enhance,omitempty"`
-	Image    bool   `json:"image,omitempty"`
-	Annotate bool   `json:"annotate,omitempty"`
-	Force    bool   `json:"force,omitempty"`
+	// Overrides pins attributes (by name, e.g. "noun") to a database record key
+	// or a row index in the series-filtered database, replacing the seed's pick.
+	Overrides map[string]string `json:"overrides,omitempty"`
+	// reseeds replaces the seed's pick with rows the engine chose, by
+	// attribute name, such as a storyboard panel's varied attributes. They
+	// are recorded as ImageMetadata.Reseeds and, unlike Overrides, are not
+	// marked as pinned in the selected records.
+	reseeds map[string]int
+	// SeedScheme selects how the input becomes a seed and the seed becomes
+	// attribute selections, as "name" or "name@version" (see SeedSchemes).
+	// Empty means the default sha256 scheme.
+	SeedScheme string `json:"seedScheme,omitempty"`
+	// Font adjusts the annotation font on top of the series font settings.
+	Font *annotate.FontOptions `json:"font,omitempty"`
+	// Layout selects the annotation layout (see annotate.Layouts); empty is
+	// the bottom band. Title adds the title prompt as a block above the
+	// terse-prompt caption.
+	Layout string `json:"layout,omitempty"`
+	Title  bool   `json:"title,omitempty"`
+	// Contrast is the WCAG level (AA or AAA) the caption must meet against
+	// its band; empty is AA. BandColors picks the band color from the image
+	// (the default), the series colors or the selected color1..3.
+	Contrast   string `json:"contrast,omitempty"`
+	BandColors string `json:"bandColors,omitempty"`
+	// Badge stamps a watermark on the annotated image, on top of any badge
+	// the series configures. Edition is the image's number within its run
+	// (e.g. 42 of 500) for badge templates; zero leaves it out.
+	Badge   *BadgeConfig `json:"badge,omitempty"`
+	Edition int          `json:"edition,omitempty"`
+	// Sign writes a signed manifest for the image with the data directory's
+	// signing key. Images that already have one are always re-signed.
+	Sign bool `json:"sign,omitempty"`
+	// DuplicateThreshold, when positive, lists existing images whose
+	// perceptual hash is within that many bits of the new image in the
+	// result's Duplicates.
+	DuplicateThreshold int `json:"duplicateThreshold,omitempty"`
+
+	Enhance  bool `json:"enhance,omitempty"`
+	Image    bool `json:"image,omitempty"`
+	Annotate bool `json:"annotate,omitempty"`
+	Force    bool `json:"force,omitempty"`
 }
 
 type GenerateResult struct {
@@ -78,6 +134,9 @@ type GenerateResult struct {
 	GeneratedPath string        `json:"generatedPath,omitempty"`
 	AnnotatedPath string        `json:"annotatedPath,omitempty"`
 	Metadata      ImageMetadata `json:"metadata"`
+	// Duplicates are existing images that look like this one; see
+	// GenerateRequest.DuplicateThreshold.
+	Duplicates []DuplicateMatch `json:"duplicates,omitempty"`
 }
 
 type SeriesFilter struct {
@@ -93,11 +152,21 @@ type ExportImageOptions struct {
 	IncludeTerse     bool
 	IncludeEnhanced  bool
 	IncludeTechnical bool
+	// Profile renders the image for print with one of ExportProfiles, as
+	// <profile>.png next to the prompt files.
+	Profile string
+	// Card renders the image as a card (see RenderCard) into card.png with
+	// CardTemplate, or the default template when that is empty.
+	Card         bool
+	CardTemplate string
 }
 
 type ExportImageResult struct {
-	Dir   string            `json:"dir"`
-	Files map[string]string `json:"files"`
+	Dir     string            `json:"dir"`
+	Files   map[string]string `json:"files"`
+	Image   string            `json:"image,omitempty"`
+	Profile *ExportProfile    `json:"profile,omitempty"`
+	Card    string            `json:"card,omitempty"`
 }
 
 type DatabaseRecordsResult struct {
@@ -116,11 +185,21 @@ func New(config Config) (*Engine, error) {
 	if err != nil {
 		return nil, WrapError(ErrDatabaseManifestInvalid, "load embedded database archive manifest", err)
 	}
+	resolver := config.ENSResolver
+	if resolver == nil {
+		resolver = FileENSResolver{Path: filepath.Join(dataDir, "ens.json")}
+	}
+	variants, err := loadVariants(dataDir, config.Variants)
+	if err != nil {
+		return nil, err
+	}
 	return &Engine{
 		dataDir:       dataDir,
 		provider:      config.Provider,
 		imageModel:    config.ImageModel,
 		database:      manifest,
+		ensResolver:   resolver,
+		variants:      variants,
 		enhancePrompt: prompt.EnhanceLiteraryContent,
 		requestImage:  requestGeneratedImage,
 	}, nil
@@ -132,6 +211,7 @@ type promptBuild struct {
 	technicalPrompt string
 	filename        string
 	dress           *model.DalleDress
+	series          Series
 }
 
 func ResolveDataDir(configDir string) (string, error) {
@@ -399,6 +479,13 @@ func (engine *Engine) getImageInSeries(id, series string) (ImageMetadataRecord,
 			return record, nil
 		}
 	}
+	// Pinned and reseeded variants share their parent's seed, so a bare seed
+	// resolves to the ordinary image when there is one.
+	for _, record := range records {
+		if record.Metadata.Seed == id && !derivedImage(record.Metadata) {
+			return record, nil
+		}
+	}
 	for _, record := range records {
 		if record.Metadata.Seed == id {
 			return record, nil
@@ -415,11 +502,15 @@ func (engine *Engine) DeleteImage(id string) error {
 	if err != nil {
 		return err
 	}
-	for _, path := range []string{
-		record.Metadata.Artifacts.Generated,
-		record.Metadata.Artifacts.Annotated,
-		record.Path,
-	} {
+	paths := []string{}
+	for _, artifact := range record.Metadata.Artifacts.Named() {
+		paths = append(paths, artifact.Path)
+	}
+	paths = append(paths, record.Path)
+	if manifestPath := manifestPathFor(record.Path); fileExists(manifestPath) {
+		paths = append(paths, manifestPath)
+	}
+	for _, path := range paths {
 		if err := archiveDataDirFile(engine.dataDir, path); err != nil {
 			return err
 		}
@@ -436,24 +527,44 @@ func (engine *Engine) RegenerateImage(id string) (GenerateResult, error) {
 		return GenerateResult{}, err
 	}
 	metadata := record.Metadata
-	backstyle := ""
+	return engine.generate(GenerateRequest{
+		Input:      metadata.Input,
+		InputKind:  storedInputKind(metadata),
+		Seed:       metadata.Seed,
+		Series:     metadata.Series.Name,
+		Recipe:     metadata.Recipe.Name,
+		Backstyle:  backstyleOf(metadata),
+		Overrides:  metadata.Overrides,
+		reseeds:    metadata.Reseeds,
+		SeedScheme: metadata.Recipe.SeedSchemeReference(),
+		Enhance:    strings.TrimSpace(metadata.Prompts.EnhancedPrompt) != "",
+		Image:      true,
+		Annotate:   strings.TrimSpace(metadata.Artifacts.Annotated) != "",
+		Force:      true,
+	}, metadata.Lineage)
+}
+
+// storedInputKind is the kind to re-read a stored canonical input as. ENS
+// inputs were stored as their resolved address, so they are not resolved
+// again. Records written before input kinds existed were seeded from the
+// input exactly as typed, so they are read back as text rather than detected.
+func storedInputKind(metadata ImageMetadata) string {
+	if metadata.InputInfo == nil || metadata.InputInfo.Kind == "" {
+		return InputKindText
+	}
+	if metadata.InputInfo.Kind == InputKindENS {
+		return ""
+	}
+	return metadata.InputInfo.Kind
+}
+
+func backstyleOf(metadata ImageMetadata) string {
 	for _, rec := range metadata.SelectedRecords {
 		if rec.Attribute == "backStyle" {
-			backstyle = rec.Record
-			break
+			return rec.Record
 		}
 	}
-	return engine.Generate(GenerateRequest{
-		Input:     metadata.Input,
-		Seed:      metadata.Seed,
-		Series:    metadata.Series.Name,
-		Recipe:    metadata.Recipe.Name,
-		Backstyle: backstyle,
-		Enhance:   strings.TrimSpace(metadata.Prompts.EnhancedPrompt) != "",
-		Image:     true,
-		Annotate:  strings.TrimSpace(metadata.Artifacts.Annotated) != "",
-		Force:     true,
-	})
+	return ""
 }
 
 func (engine *Engine) ExportImage(id string, options ExportImageOptions) (ExportImageResult, error) {
@@ -465,6 +576,20 @@ func (engine *Engine) ExportImage(id string, options ExportImageOptions) (Export
 		return ExportImageResult{}, err
 	}
 	metadata := record.Metadata
+	var profile *ExportProfile
+	if strings.TrimSpace(options.Profile) != "" {
+		found, err := LookupExportProfile(options.Profile)
+		if err != nil {
+			return ExportImageResult{}, err
+		}
+		profile = &found
+	}
+	var cardLayout annotate.CardLayout
+	if options.Card {
+		if cardLayout, err = engine.loadCardLayout(cardName(options.CardTemplate)); err != nil {
+			return ExportImageResult{}, err
+		}
+	}
 	if !options.IncludePrompt && !options.IncludeData && !options.IncludeTitle && !options.IncludeTerse && !options.IncludeEnhanced && !options.IncludeTechnical {
 		options.IncludePrompt = true
 		options.IncludeData = true
@@ -529,7 +654,23 @@ func (engine *Engine) ExportImage(id string, options ExportImageOptions) (Export
 			return ExportImageResult{}, err
 		}
 	}
-	return ExportImageResult{Dir: exportDir, Files: files}, nil
+	result := ExportImageResult{Dir: exportDir, Files: files, Profile: profile}
+	if profile != nil {
+		if result.Image, err = engine.exportProfileImage(metadata, *profile, exportDir); err != nil {
+			return ExportImageResult{}, err
+		}
+	}
+	if options.Card {
+		card, _, err := engine.renderCard(metadata, cardLayout)
+		if err != nil {
+			return ExportImageResult{}, err
+		}
+		result.Card = filepath.Join(exportDir, "card.png")
+		if err := writePNG(result.Card, card); err != nil {
+			return ExportImageResult{}, WrapError(ErrMetadataInvalid, "write export card", err)
+		}
+	}
+	return result, nil
 }
 
 func (engine *Engine) NewMetadata(request GenerateRequest) (ImageMetadata, error) {
@@ -537,7 +678,20 @@ func (engine *Engine) NewMetadata(request GenerateRequest) (ImageMetadata, error
 		return ImageMetadata{}, NewError(ErrInvalidInput, "engine is nil")
 	}
 	input := strings.TrimSpace(request.Input)
-	seed, err := NormalizeSeed(input, request.Seed, request.Series)
+	var inputInfo *MetadataInput
+	if input != "" {
+		normalized, err := NormalizeInput(input, request.InputKind, engine.ensResolver)
+		if err != nil {
+			return ImageMetadata{}, err
+		}
+		input = normalized.Canonical
+		inputInfo = &normalized
+	}
+	scheme, err := LookupSeedScheme(request.SeedScheme)
+	if err != nil {
+		return ImageMetadata{}, err
+	}
+	seed, err := NormalizeSeedWith(scheme, input, request.Seed)
 	if err != nil {
 		return ImageMetadata{}, err
 	}
@@ -549,9 +703,20 @@ func (engine *Engine) NewMetadata(request GenerateRequest) (ImageMetadata, error
 	if recipe == "" {
 		recipe = DefaultRecipeName
 	}
+	overrides, err := NormalizeOverrides(request.Overrides)
+	if err != nil {
+		return ImageMetadata{}, err
+	}
 	metadata := NewImageMetadata(input, seed, series)
+	metadata.InputInfo = inputInfo
+	metadata.Overrides = overrides
+	if len(request.reseeds) > 0 {
+		metadata.Reseeds = request.reseeds
+	}
 	metadata.Recipe.Name = recipe
 	metadata.Recipe.Version = DefaultRecipeVersion
+	metadata.Recipe.SeedScheme = scheme.Name()
+	metadata.Recipe.SeedSchemeVersion = scheme.Version()
 	metadata.Database.Version = engine.database.Version
 	metadata.Database.ArchiveHash = engine.database.ArchiveHash
 	metadata.ImageID = ComputeImageID(metadata)
@@ -562,15 +727,20 @@ func (engine *Engine) Preview(request GenerateRequest) (GenerateResult, error) {
 	if engine == nil {
 		return GenerateResult{}, NewError(ErrInvalidInput, "engine is nil")
 	}
+	return engine.preview(request, nil)
+}
+
+func (engine *Engine) preview(request GenerateRequest, lineage *MetadataLineage) (GenerateResult, error) {
 	if cached, ok, err := engine.cachedMetadata(request); err != nil {
 		return GenerateResult{}, err
 	} else if ok {
-		return engine.generateResult(cached.Metadata, cached.Path), nil
+		return engine.cachedResult(cached, lineage, false)
 	}
 	build, err := engine.buildPromptMetadata(request)
 	if err != nil {
 		return GenerateResult{}, err
 	}
+	build.metadata.Lineage = lineage
 	metadataPath, err := WriteImageMetadata(engine.dataDir, build.metadata)
 	if err != nil {
 		return GenerateResult{}, err
@@ -583,12 +753,15 @@ func (engine *Engine) buildPromptMetadata(request GenerateRequest) (promptBuild,
 	if err != nil {
 		return promptBuild{}, err
 	}
-	storage.UseDataDir(engine.dataDir)
-	ctx := NewContext()
-	if err := ctx.ReloadDatabases(metadata.Series.Name); err != nil {
-		return promptBuild{}, WrapError(ErrSeriesInvalid, "load series", err)
+	ctx, err := engine.seriesContext(metadata.Series.Name)
+	if err != nil {
+		return promptBuild{}, err
+	}
+	scheme, err := LookupSeedScheme(metadata.Recipe.SeedSchemeReference())
+	if err != nil {
+		return promptBuild{}, err
 	}
-	dress, err := ctx.makeDalleDress(metadata.Seed, request.Backstyle, false)
+	dress, err := ctx.makeDalleDress(metadata.Seed, dressOptions{backstyle: request.Backstyle, overrides: metadata.Overrides, reseeds: metadata.Reseeds, scheme: scheme}, false)
 	if err != nil {
 		return promptBuild{}, WrapError(ErrInvalidInput, "build preview prompt", err)
 	}
@@ -617,28 +790,65 @@ func (engine *Engine) buildPromptMetadata(request GenerateRequest) (promptBuild,
 	metadata.Stages.Annotated.Status = "skipped"
 	metadata.Status.Completed = true
 	metadata.ImageID = ComputeImageID(metadata)
-	return promptBuild{metadata: metadata, authorContext: authorContext, technicalPrompt: technicalPrompt, filename: dress.FileName, dress: dress}, nil
+	return promptBuild{metadata: metadata, authorContext: authorContext, technicalPrompt: technicalPrompt, filename: dress.FileName + variantSuffix(metadata), dress: dress, series: ctx.Series}, nil
+}
+
+// seriesContext returns a Context with the series filters applied to every
+// attribute database.
+func (engine *Engine) seriesContext(series string) (*Context, error) {
+	storage.UseDataDir(engine.dataDir)
+	ctx := NewContext()
+	if err := ctx.ReloadDatabases(series); err != nil {
+		return nil, WrapError(ErrSeriesInvalid, "load series", err)
+	}
+	return ctx, nil
 }
 
 func (engine *Engine) Generate(request GenerateRequest) (GenerateResult, error) {
 	if engine == nil {
 		return GenerateResult{}, NewError(ErrInvalidInput, "engine is nil")
 	}
+	return engine.generate(request, nil)
+}
+
+func (engine *Engine) generate(request GenerateRequest, lineage *MetadataLineage) (GenerateResult, error) {
 	if request.Annotate && !request.Image {
 		return GenerateResult{}, NewError(ErrProviderUnavailable, "annotation requires image generation")
 	}
-	if cached, ok, err := engine.cachedMetadata(request); err != nil {
+	if request.Sign {
+		if _, err := engine.signingPrivateKey(); err != nil {
+			return GenerateResult{}, err
+		}
+	}
+	cached, ok, err := engine.cachedMetadata(request)
+	if err != nil {
 		return GenerateResult{}, err
-	} else if ok && cachedSatisfiesRequest(cached.Metadata, request) {
-		metadata := cached.Metadata
-		metadata.Status.CacheHit = true
-		return engine.generateResult(metadata, cached.Path), nil
+	}
+	current := false
+	if ok && cachedSatisfiesRequest(cached.Metadata, request) {
+		if current, err = engine.annotationSatisfiesRequest(cached.Metadata, request); err != nil {
+			return GenerateResult{}, err
+		}
+		if !current && engine.canReannotate(cached.Metadata) {
+			// Only the annotation differs: redraw it from the generated image
+			// rather than asking the provider for a new one.
+			return engine.reannotate(cached, request, lineage)
+		}
+	}
+	if current {
+		result, err := engine.cachedResult(cached, lineage, request.Sign)
+		if err != nil {
+			return GenerateResult{}, err
+		}
+		result.Metadata.Status.CacheHit = true
+		return result, nil
 	}
 	build, err := engine.buildPromptMetadata(request)
 	if err != nil {
 		return GenerateResult{}, err
 	}
 	metadata := build.metadata
+	metadata.Lineage = lineage
 	// Re-check cached metadata for partial results (e.g. enhanced prompt from a previous failed run)
 	if cached, ok, _ := engine.cachedMetadata(request); ok {
 		if request.Enhance && strings.TrimSpace(cached.Metadata.Prompts.EnhancedPrompt) != "" {
@@ -684,6 +894,21 @@ func (engine *Engine) Generate(request GenerateRequest) (GenerateResult, error)
 		if imagePrompt == "" {
 			imagePrompt = metadata.Prompts.Prompt
 		}
+		annotation, err := engine.annotationOptions(build, request)
+		if err != nil {
+			progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+			return GenerateResult{}, err
+		}
+		if request.Title {
+			annotation.Title = metadata.Prompts.TitlePrompt
+		}
+		var badge *BadgeConfig
+		if request.Annotate {
+			if badge, err = badgeConfig(build.series, request); err != nil {
+				progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+				return GenerateResult{}, err
+			}
+		}
 		generatedPath := filepath.Join(engine.dataDir, "output", safePathPart(metadata.Series.Name), "generated", build.filename+".png")
 		annotatedPath := filepath.Join(engine.dataDir, "output", safePathPart(metadata.Series.Name), "annotated", build.filename+".png")
 		result, err := engine.requestImage(imageRequest{
@@ -700,9 +925,14 @@ func (engine *Engine) Generate(request GenerateRequest) (GenerateResult, error)
 			tersePrompt:     metadata.Prompts.TersePrompt,
 			baseURL:         engine.provider.BaseURL,
 			imageModel:      engine.imageModel,
+			annotation:      annotation,
 		})
 		if err != nil {
-			wrapped := WrapError(ErrProviderFailed, "generate image", err)
+			code := ErrProviderFailed
+			if errors.Is(err, image.ErrInvalidPayload) {
+				code = ErrImagePayloadInvalid
+			}
+			wrapped := WrapError(code, "generate image", err)
 			progressMgr.Fail(metadata.Series.Name, metadata.Seed, wrapped)
 			// Persist partial metadata so completed stages (e.g. enhancement) are cached for re-runs
 			metadata.Status.Completed = false
@@ -711,13 +941,36 @@ func (engine *Engine) Generate(request GenerateRequest) (GenerateResult, error)
 		}
 		metadata.Artifacts.Generated = result.generatedPath
 		metadata.Stages.Generated.Status = "complete"
+		metadata.Payload = result.payload
 		if request.Annotate {
 			metadata.Artifacts.Annotated = result.annotatedPath
 			metadata.Stages.Annotated.Status = "complete"
+			metadata.Annotation = &MetadataAnnotation{
+				Font:       annotation.Font,
+				Layout:     annotationLayout(request.Layout),
+				Title:      request.Title,
+				BandColors: bandColorSource(request.BandColors),
+				Colors:     result.colors,
+			}
+			if badge != nil {
+				data := BadgeData{DalleDress: build.dress, Metadata: metadata, Edition: request.Edition}
+				recorded, err := engine.applyBadge(result.annotatedPath, *badge, data, annotation)
+				if err != nil {
+					progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+					return GenerateResult{}, err
+				}
+				metadata.Annotation.Badge = recorded
+			}
 		} else {
 			progressMgr.Skip(metadata.Series.Name, metadata.Seed, progress.PhaseAnnotate)
 		}
-		metadata.ImageID = ComputeImageID(metadata)
+		if err := engine.recordArtifacts(&metadata, build.filename); err != nil {
+			progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+			return GenerateResult{}, err
+		}
+		progressMgr.UpdateDress(metadata.Series.Name, metadata.Seed, func(dd *model.DalleDress) { dd.IPFSHash = dressCID(metadata.CIDs) })
+		metadata.PerceptualHash = perceptualHashOf(metadata.Artifacts.Generated)
+		metadata.Palette = imagePalette(metadata.Artifacts.Generated, build.dress)
 	} else {
 		progressMgr.Skip(metadata.Series.Name, metadata.Seed, progress.PhaseImagePrep)
 		progressMgr.Skip(metadata.Series.Name, metadata.Seed, progress.PhaseImageWait)
@@ -729,9 +982,20 @@ func (engine *Engine) Generate(request GenerateRequest) (GenerateResult, error)
 		progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
 		return GenerateResult{}, err
 	}
+	if err := engine.signIfRequested(metadataPath, request.Sign); err != nil {
+		progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+		return GenerateResult{}, err
+	}
+	result := engine.generateResult(metadata, metadataPath)
+	if request.DuplicateThreshold > 0 {
+		if result.Duplicates, err = engine.nearDuplicates(metadata, request.DuplicateThreshold); err != nil {
+			progressMgr.Fail(metadata.Series.Name, metadata.Seed, err)
+			return GenerateResult{}, err
+		}
+	}
 	progressMgr.Transition(metadata.Series.Name, metadata.Seed, progress.PhaseCompleted)
 	progressMgr.Complete(metadata.Series.Name, metadata.Seed)
-	return engine.generateResult(metadata, metadataPath), nil
+	return result, nil
 }
 
 func (engine *Engine) cachedMetadata(request GenerateRequest) (ImageMetadataRecord, bool, error) {
@@ -742,7 +1006,7 @@ func (engine *Engine) cachedMetadata(request GenerateRequest) (ImageMetadataReco
 	if err != nil {
 		return ImageMetadataRecord{}, false, err
 	}
-	path, err := MetadataPath(engine.dataDir, metadata.Series.Name, metadata.Seed)
+	path, err := MetadataPathFor(engine.dataDir, metadata)
 	if err != nil {
 		return ImageMetadataRecord{}, false, err
 	}
@@ -762,14 +1026,40 @@ func (engine *Engine) cachedMetadata(request GenerateRequest) (ImageMetadataReco
 	return ImageMetadataRecord{Path: path, Metadata: existing}, true, nil
 }
 
+// cachedResult returns a cached record as a result. When the caller supplies
+// lineage that the record does not have yet (an image first generated on its
+// own and later reached as a variant), the lineage is recorded on the sidecar
+// and the sidecar is signed again if it has a manifest. With sign set, a
+// record without a manifest gets one.
+func (engine *Engine) cachedResult(cached ImageMetadataRecord, lineage *MetadataLineage, sign bool) (GenerateResult, error) {
+	metadata := cached.Metadata
+	if lineage != nil && metadata.Lineage == nil {
+		metadataPath, err := WriteImageMetadata(engine.dataDir, metadata)
+		if err != nil {
+			return GenerateResult{}, err
+		}
+		if err := engine.signIfRequested(metadataPath, sign); err != nil {
+			return GenerateResult{}, err
+		}
+	} else if sign && !fileExists(manifestPathFor(cached.Path)) {
+		if _, err := engine.signRecord(cached); err != nil {
+			return GenerateResult{}, err
+		}
+	}
+	return engine.generateResult(metadata, cached.Path), nil
+}
+
+// cachedSatisfiesRequest reports whether a cached record has every stage the
+// request asks for, apart from the annotation (see annotationSatisfiesRequest).
 func cachedSatisfiesRequest(metadata ImageMetadata, request GenerateRequest) bool {
-	if request.Enhance && strings.TrimSpace(metadata.Prompts.EnhancedPrompt) == "" {
+	// Records marked incomplete (see VerifyImages) are generated again.
+	if request.Image && !metadata.Status.Completed {
 		return false
 	}
-	if request.Image && strings.TrimSpace(metadata.Artifacts.Generated) == "" {
+	if request.Enhance && strings.TrimSpace(metadata.Prompts.EnhancedPrompt) == "" {
 		return false
 	}
-	if request.Annotate && strings.TrimSpace(metadata.Artifacts.Annotated) == "" {
+	if request.Image && strings.TrimSpace(metadata.Artifacts.Generated) == "" {
 		return false
 	}
 	requestedBackstyle := strings.TrimSpace(request.Backstyle)
@@ -784,6 +1074,213 @@ func cachedSatisfiesRequest(metadata ImageMetadata, request GenerateRequest) boo
 	return false
 }
 
+// annotationSatisfiesRequest reports whether a cached record's annotated
+// artifact was drawn the way the request asks, badge included. The badge is
+// the one badgeConfig resolves now, so a later change to the series badge
+// is picked up too.
+func (engine *Engine) annotationSatisfiesRequest(metadata ImageMetadata, request GenerateRequest) (bool, error) {
+	if !request.Annotate {
+		return true, nil
+	}
+	if strings.TrimSpace(metadata.Artifacts.Annotated) == "" {
+		return false, nil
+	}
+	series, err := engine.loadSeries(metadata.Series.Name)
+	if err != nil {
+		return false, err
+	}
+	badge, err := badgeConfig(series, request)
+	if err != nil {
+		return false, err
+	}
+	if request.Layout != "" || request.Title || request.Contrast != "" || request.BandColors != "" {
+		// Annotations recorded before layouts existed are bottom bands without a
+		// title, colored from the image.
+		recorded := MetadataAnnotation{}
+		if metadata.Annotation != nil {
+			recorded = *metadata.Annotation
+		}
+		recordedContrast := annotate.ContrastAA
+		if recorded.Colors != nil {
+			recordedContrast = recorded.Colors.Level
+		}
+		if annotationLayout(recorded.Layout) != annotationLayout(request.Layout) ||
+			recorded.Title != request.Title ||
+			bandColorSource(recorded.BandColors) != bandColorSource(request.BandColors) ||
+			(request.Contrast != "" && !strings.EqualFold(recordedContrast, request.Contrast)) {
+			return false, nil
+		}
+	}
+	if info, err := os.Stat(metadata.Artifacts.Annotated); err == nil && info.Size() == 0 {
+		// Empty placeholders never carry a badge.
+		return true, nil
+	}
+	var recorded *MetadataBadge
+	if metadata.Annotation != nil {
+		recorded = metadata.Annotation.Badge
+	}
+	return badgeSatisfiesRequest(recorded, badge, request.Edition), nil
+}
+
+// badgeSatisfiesRequest reports whether a recorded badge was drawn with
+// config. An edition of zero accepts the recorded one.
+func badgeSatisfiesRequest(recorded *MetadataBadge, config *BadgeConfig, edition int) bool {
+	if config == nil || recorded == nil {
+		return config == nil && recorded == nil
+	}
+	corner := config.Corner
+	if corner == "" {
+		corner = annotate.CornerBottomRight
+	}
+	return recorded.Template == config.Template &&
+		recorded.Logo == config.Logo &&
+		recorded.Corner == corner &&
+		recorded.Opacity == config.Opacity &&
+		recorded.Scale == config.Scale &&
+		recorded.EditionSize == config.EditionSize &&
+		(edition == 0 || recorded.Edition == edition)
+}
+
+// loadSeries reads a series definition without loading its databases.
+func (engine *Engine) loadSeries(name string) (Series, error) {
+	storage.UseDataDir(engine.dataDir)
+	series, err := (&Context{}).loadSeries(name)
+	if err != nil {
+		return Series{}, WrapError(ErrSeriesInvalid, "load series", err)
+	}
+	return series, nil
+}
+
+// canReannotate reports whether a record's generated image can be annotated
+// again. Empty placeholders (written when no image provider key is set),
+// missing files and files outside the output directory cannot.
+func (engine *Engine) canReannotate(metadata ImageMetadata) bool {
+	if strings.TrimSpace(metadata.Artifacts.Generated) == "" {
+		return false
+	}
+	path, err := engine.generatedArtifact(metadata)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > 0
+}
+
+// generatedArtifact confines the generated image of a stored record before
+// it is annotated again: it must be in a "generated" folder under the output
+// directory.
+func (engine *Engine) generatedArtifact(metadata ImageMetadata) (string, error) {
+	generated := filepath.Clean(metadata.Artifacts.Generated)
+	if _, _, err := outputRelativePath(engine.dataDir, generated); err != nil {
+		return "", err
+	}
+	if filepath.Base(filepath.Dir(generated)) != "generated" {
+		return "", NewError(ErrInvalidInput, "image "+generated+" is not in a generated folder")
+	}
+	return generated, nil
+}
+
+// reannotate draws the annotation of a cached record again from its generated
+// artifact with the request's annotation settings, leaving the generated
+// image as it is.
+func (engine *Engine) reannotate(cached ImageMetadataRecord, request GenerateRequest, lineage *MetadataLineage) (GenerateResult, error) {
+	build, err := engine.buildPromptMetadata(request)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	metadata := cached.Metadata
+	if lineage != nil && metadata.Lineage == nil {
+		metadata.Lineage = lineage
+	}
+	annotation, err := engine.annotationOptions(build, request)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	annotation.Caption = metadata.Prompts.TersePrompt
+	if request.Title {
+		annotation.Title = metadata.Prompts.TitlePrompt
+	}
+	badge, err := badgeConfig(build.series, request)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	generated, err := engine.generatedArtifact(metadata)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	path := metadata.Artifacts.Annotated
+	if strings.TrimSpace(path) == "" {
+		path = filepath.Join(engine.dataDir, "output", safePathPart(metadata.Series.Name), "annotated", build.filename+".png")
+	}
+	if _, _, err := outputRelativePath(engine.dataDir, path); err != nil {
+		return GenerateResult{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return GenerateResult{}, WrapError(ErrArtifactMissing, "create annotated directory", err)
+	}
+	if err := annotate.AnnotateFile(generated, path, annotation); err != nil {
+		return GenerateResult{}, WrapError(ErrArtifactMissing, "annotate image", err)
+	}
+	colors, err := annotate.FileColors(generated, annotation)
+	if err != nil {
+		return GenerateResult{}, WrapError(ErrArtifactMissing, "annotate image", err)
+	}
+	var recordedBadge *MetadataBadge
+	if metadata.Annotation != nil {
+		recordedBadge = metadata.Annotation.Badge
+	}
+	metadata.Artifacts.Annotated = path
+	metadata.Stages.Annotated.Status = "complete"
+	metadata.Annotation = &MetadataAnnotation{
+		Font:       annotation.Font,
+		Layout:     annotationLayout(request.Layout),
+		Title:      request.Title,
+		BandColors: bandColorSource(request.BandColors),
+		Colors:     &colors,
+	}
+	if badge != nil {
+		edition := request.Edition
+		if edition == 0 && recordedBadge != nil {
+			edition = recordedBadge.Edition
+		}
+		data := BadgeData{DalleDress: build.dress, Metadata: metadata, Edition: edition}
+		if metadata.Annotation.Badge, err = engine.applyBadge(path, *badge, data, annotation); err != nil {
+			return GenerateResult{}, err
+		}
+	}
+	if err := engine.recordArtifacts(&metadata, build.filename); err != nil {
+		return GenerateResult{}, err
+	}
+	metadataPath, err := WriteImageMetadata(engine.dataDir, metadata)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	if err := engine.signIfRequested(metadataPath, request.Sign); err != nil {
+		return GenerateResult{}, err
+	}
+	return engine.generateResult(metadata, metadataPath), nil
+}
+
+// recordArtifacts embeds provenance in a record's artifacts, derives its
+// variants and records the size, hash and CID of each artifact.
+func (engine *Engine) recordArtifacts(metadata *ImageMetadata, filename string) error {
+	metadata.ImageID = ComputeImageID(*metadata)
+	if err := embedProvenance(*metadata); err != nil {
+		return err
+	}
+	var err error
+	if metadata.Artifacts.Variants, err = engine.writeVariants(metadata.Artifacts, metadata.Series.Name, filename); err != nil {
+		return err
+	}
+	if metadata.Artifacts.Info, err = describeArtifacts(metadata.Artifacts); err != nil {
+		return err
+	}
+	if metadata.CIDs, err = artifactCIDs(metadata.Artifacts); err != nil {
+		return err
+	}
+	return nil
+}
+
 // func removeDataDirFile(dataDir string, path string) error {
 // 	if strings.TrimSpace(path) == "" {
 // 		return nil
@@ -813,38 +1310,88 @@ func archiveDataDirFile(dataDir string, path string) error {
 	if strings.TrimSpace(path) == "" {
 		return nil
 	}
+	cleanDataDir, outputRelative, err := outputRelativePath(dataDir, path)
+	if err != nil {
+		return err
+	}
+	cleanPath := filepath.Join(cleanDataDir, "output", outputRelative)
+	archivePath := filepath.Join(cleanDataDir, "archives", outputRelative)
+	archiveDir := filepath.Dir(archivePath)
+	if err := os.MkdirAll(archiveDir, 0o750); err != nil {
+		return WrapError(ErrInvalidInput, "create archive directory", err)
+	}
+	if err := os.Rename(cleanPath, archivePath); err != nil {
+		return WrapError(ErrMetadataInvalid, "archive image artifact", err)
+	}
+	return nil
+}
+
+// outputRelativePath returns the absolute data directory and path relative to
+// its output directory, refusing paths outside it.
+func outputRelativePath(dataDir string, path string) (string, string, error) {
 	cleanDataDir, err := filepath.Abs(filepath.Clean(dataDir))
 	if err != nil {
-		return WrapError(ErrInvalidInput, "resolve data directory", err)
+		return "", "", WrapError(ErrInvalidInput, "resolve data directory", err)
 	}
 	cleanPath, err := filepath.Abs(filepath.Clean(path))
 	if err != nil {
-		return WrapError(ErrInvalidInput, "resolve image artifact path", err)
+		return "", "", WrapError(ErrInvalidInput, "resolve image artifact path", err)
 	}
 	relative, err := filepath.Rel(cleanDataDir, cleanPath)
 	if err != nil {
-		return WrapError(ErrInvalidInput, "compare image artifact path", err)
+		return "", "", WrapError(ErrInvalidInput, "compare image artifact path", err)
 	}
 	if relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
-		return NewError(ErrInvalidInput, "image artifact path is outside the data directory")
+		return "", "", NewError(ErrInvalidInput, "image artifact path is outside the data directory")
 	}
-	outputDir := filepath.Join(cleanDataDir, "output")
-	outputRelative, err := filepath.Rel(outputDir, cleanPath)
+	outputRelative, err := filepath.Rel(filepath.Join(cleanDataDir, "output"), cleanPath)
 	if err != nil {
-		return WrapError(ErrInvalidInput, "compare image artifact path with output directory", err)
+		return "", "", WrapError(ErrInvalidInput, "compare image artifact path with output directory", err)
 	}
 	if outputRelative == ".." || strings.HasPrefix(outputRelative, ".."+string(os.PathSeparator)) {
-		return NewError(ErrInvalidInput, "image artifact path is outside the output directory")
+		return "", "", NewError(ErrInvalidInput, "image artifact path is outside the output directory")
 	}
-	archivePath := filepath.Join(cleanDataDir, "archives", outputRelative)
-	archiveDir := filepath.Dir(archivePath)
-	if err := os.MkdirAll(archiveDir, 0o750); err != nil {
-		return WrapError(ErrInvalidInput, "create archive directory", err)
+	return cleanDataDir, outputRelative, nil
+}
+
+// annotationOptions combines the series font settings with the request's and
+// resolves the band palette.
+func (engine *Engine) annotationOptions(build promptBuild, request GenerateRequest) (annotate.Options, error) {
+	series := build.series
+	font := annotate.FontOptions{}
+	if series.Font != nil {
+		font = *series.Font
 	}
-	if err := os.Rename(cleanPath, archivePath); err != nil {
-		return WrapError(ErrMetadataInvalid, "archive image artifact", err)
+	if request.Font != nil {
+		font = font.Merge(*request.Font)
 	}
-	return nil
+	if err := font.Validate(); err != nil {
+		return annotate.Options{}, WrapError(ErrInvalidInput, "annotation font", err)
+	}
+	if err := annotate.ValidateLayout(request.Layout); err != nil {
+		return annotate.Options{}, WrapError(ErrInvalidInput, "annotation layout", err)
+	}
+	if err := annotate.ValidateContrast(request.Contrast); err != nil {
+		return annotate.Options{}, WrapError(ErrInvalidInput, "annotation contrast", err)
+	}
+	palette, err := engine.bandPalette(build, request.BandColors)
+	if err != nil {
+		return annotate.Options{}, err
+	}
+	return annotate.Options{
+		Layout:   request.Layout,
+		Contrast: request.Contrast,
+		Palette:  palette,
+		Font:     font,
+		FontDir:  filepath.Join(engine.dataDir, "fonts"),
+	}, nil
+}
+
+func annotationLayout(layout string) string {
+	if layout == "" {
+		return annotate.LayoutBottomBand
+	}
+	return layout
 }
 
 func (engine *Engine) generateResult(metadata ImageMetadata, metadataPath string) GenerateResult {
@@ -887,12 +1434,14 @@ func requestGeneratedImage(request imageRequest) (imageResult, error) {
 		Series:          request.series,
 		Address:         request.seed,
 	}
-	if err := image.RequestImageWithOptions(request.outputDir, &data, config, image.ImageOptions{Annotate: request.annotate}); err != nil {
+	requested, err := image.RequestImageWithResult(request.outputDir, &data, config, image.ImageOptions{Annotate: request.annotate, AnnotatedPath: request.annotatedPath, Annotation: request.annotation})
+	if err != nil {
 		return imageResult{}, err
 	}
-	result := imageResult{generatedPath: request.generatedPath}
+	result := imageResult{generatedPath: request.generatedPath, payload: requested.Payload}
 	if request.annotate {
 		result.annotatedPath = request.annotatedPath
+		result.colors = requested.Colors
 	}
 	return result, nil
 }
@@ -906,6 +1455,12 @@ func requestGeneratedImage(request imageRequest) (imageResult, error) {
 //
 // The series parameter is retained for API compatibility and is ignored.
 func NormalizeSeed(input, seed, _ string) (string, error) {
+	return NormalizeSeedWith(sha256Scheme{}, input, seed)
+}
+
+// NormalizeSeedWith derives the seed for input using the given scheme. As with
+// NormalizeSeed, an explicit seed is returned unchanged.
+func NormalizeSeedWith(scheme SeedScheme, input, seed string) (string, error) {
 	seed = strings.TrimSpace(seed)
 	if seed != "" {
 		// An explicit seed is treated as already normalized; do not re-hash it.
@@ -915,7 +1470,7 @@ func NormalizeSeed(input, seed, _ string) (string, error) {
 	if input == "" {
 		return "", NewError(ErrInvalidInput, "input is required")
 	}
-	return stableSeed(input), nil
+	return scheme.Seed(input)
 }
 
 func stableSeed(seed string) string {
@@ -959,11 +1514,49 @@ func selectedRecordsFromDress(dress *model.DalleDress) []SelectedRecord {
 	records := make([]SelectedRecord, 0, len(dress.Attribs))
 	for _, attr := range dress.Attribs {
 		records = append(records, SelectedRecord{
-			Attribute: attr.Name,
-			Database:  attr.Database,
-			RowIndex:  int(attr.Selector),
-			Record:    attr.Value,
+			Attribute:  attr.Name,
+			Database:   attr.Database,
+			RowIndex:   int(attr.Selector),
+			Record:     attr.Value,
+			Overridden: attr.Overridden,
 		})
 	}
 	return records
 }
+
+// dressFromMetadata is the DalleDress a stored image was made with, bound from
+// its selected records and prompts rather than rebuilt against the databases,
+// which may have changed since.
+func dressFromMetadata(metadata ImageMetadata) *model.DalleDress {
+	dress := &model.DalleDress{
+		Original:        metadata.Seed,
+		FileName:        utils.ValidFilename(metadata.Seed),
+		Seed:            metadata.Seed,
+		Prompt:          metadata.Prompts.Prompt,
+		DataPrompt:      metadata.Prompts.DataPrompt,
+		TitlePrompt:     metadata.Prompts.TitlePrompt,
+		TersePrompt:     metadata.Prompts.TersePrompt,
+		EnhancedPrompt:  metadata.Prompts.EnhancedPrompt,
+		Attribs:         []prompt.Attribute{},
+		AttribMap:       make(map[string]prompt.Attribute),
+		SeedChunks:      []string{},
+		SelectedTokens:  []string{},
+		SelectedRecords: []string{},
+		IPFSHash:        dressCID(metadata.CIDs),
+		Series:          metadata.Series.Name,
+	}
+	for _, record := range metadata.SelectedRecords {
+		attr := prompt.Attribute{
+			Database:   record.Database,
+			Name:       record.Attribute,
+			Selector:   uint64(max(record.RowIndex, 0)),
+			Value:      record.Record,
+			Overridden: record.Overridden,
+		}
+		dress.Attribs = append(dress.Attribs, attr)
+		dress.AttribMap[attr.Name] = attr
+		dress.SelectedTokens = append(dress.SelectedTokens, attr.Name)
+		dress.SelectedRecords = append(dress.SelectedRecords, attr.Value)
+	}
+	return dress
+}
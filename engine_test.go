@@ -1,12 +1,15 @@
 package dalle
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/image"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/progress"
 )
 
@@ -373,7 +376,7 @@ func TestEngineGenerateForceBypassesMetadataCache(t *testing.T) {
 }
 
 func TestEngineDeleteImageRemovesMetadataAndArtifacts(t *testing.T) {
-	engine, err := New(Config{DataDir: t.TempDir()})
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -427,7 +430,7 @@ func TestEngineDeleteImageRemovesMetadataAndArtifacts(t *testing.T) {
 }
 
 func TestEngineRegenerateImageForcesNewImageRequest(t *testing.T) {
-	engine, err := New(Config{DataDir: t.TempDir()})
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -489,7 +492,7 @@ func TestEngineGenerateRejectsAnnotationWithoutImage(t *testing.T) {
 }
 
 func TestEngineGenerateImage(t *testing.T) {
-	engine, err := New(Config{DataDir: t.TempDir()})
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -530,11 +533,39 @@ func TestEngineGenerateImage(t *testing.T) {
 	}
 }
 
-func TestEngineGenerateImageAndAnnotate(t *testing.T) {
+func TestEngineGenerateRecordsImagePayload(t *testing.T) {
 	engine, err := New(Config{DataDir: t.TempDir()})
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
+	payload := &image.Payload{Format: "jpeg", Width: 32, Height: 32, Size: 900, Transcoded: true, Mode: "url"}
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		result, err := midToneImages(request)
+		result.payload = payload
+		return result, err
+	}
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if result.Metadata.Payload == nil || *result.Metadata.Payload != *payload {
+		t.Fatalf("payload %+v, want %+v", result.Metadata.Payload, payload)
+	}
+
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		return imageResult{}, &image.PayloadError{Reason: "HTML error page", ContentType: "text/html", Size: 120}
+	}
+	_, err = engine.Generate(GenerateRequest{Input: "rejected", Image: true})
+	if ErrorCodeOf(err) != ErrImagePayloadInvalid {
+		t.Fatalf("expected ErrImagePayloadInvalid, got %v", err)
+	}
+}
+
+func TestEngineGenerateImageAndAnnotate(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
 	engine.requestImage = func(request imageRequest) (imageResult, error) {
 		if !request.annotate {
 			t.Fatalf("image+annotate generate should request annotation")
@@ -631,3 +662,101 @@ func TestEngineGenerateEnhanceFailure(t *testing.T) {
 		t.Fatalf("expected provider failed error, got %v", err)
 	}
 }
+
+func TestEngineGenerateMergesSeriesAndRequestFonts(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir, Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := engine.SaveSeries(Series{Suffix: "fonted", Font: &annotate.FontOptions{Family: annotate.FamilyGo, LineSpacing: 1.2}}); err != nil {
+		t.Fatalf("SaveSeries: %v", err)
+	}
+	var received annotate.Options
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		received = request.annotation
+		if err := os.MkdirAll(filepath.Dir(request.generatedPath), 0o750); err != nil {
+			return imageResult{}, err
+		}
+		if err := os.WriteFile(request.generatedPath, []byte("png"), 0o600); err != nil {
+			return imageResult{}, err
+		}
+		return imageResult{generatedPath: request.generatedPath, annotatedPath: request.annotatedPath}, nil
+	}
+	result, err := engine.Generate(GenerateRequest{
+		Input:    "Person Tour Coordinates",
+		Series:   "fonted",
+		Image:    true,
+		Annotate: true,
+		Font:     &annotate.FontOptions{Weight: annotate.WeightBold},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	want := annotate.FontOptions{Family: annotate.FamilyGo, Weight: annotate.WeightBold, LineSpacing: 1.2}
+	if received.Font != want || received.FontDir != filepath.Join(dataDir, "fonts") {
+		t.Fatalf("unexpected annotation options: %#v", received)
+	}
+	if result.Metadata.Annotation == nil || result.Metadata.Annotation.Font != want {
+		t.Fatalf("font not recorded in metadata: %#v", result.Metadata.Annotation)
+	}
+
+	_, err = engine.Generate(GenerateRequest{Input: "Other", Image: true, Annotate: true, Font: &annotate.FontOptions{File: "../escape.ttf"}})
+	if ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected invalid font to be rejected, got %v", err)
+	}
+}
+
+func TestEngineGenerateSelectsLayoutAndTitle(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var received []annotate.Options
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		received = append(received, request.annotation)
+		return midToneImages(request)
+	}
+	request := GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true}
+	first, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	generated, err := os.ReadFile(first.GeneratedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	banded, err := os.ReadFile(first.AnnotatedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Layout, request.Title = annotate.LayoutPolaroid, true
+	result, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(received) != 1 || result.Metadata.Status.CacheHit {
+		t.Fatalf("expected a new layout to redraw the annotation without a new image, got %d image requests", len(received))
+	}
+	if regenerated, err := os.ReadFile(result.GeneratedPath); err != nil || !bytes.Equal(regenerated, generated) {
+		t.Fatalf("expected the generated image to be kept (err %v)", err)
+	}
+	if polaroid, err := os.ReadFile(result.AnnotatedPath); err != nil || bytes.Equal(polaroid, banded) {
+		t.Fatalf("expected the annotated image to be redrawn (err %v)", err)
+	}
+	if annotation := result.Metadata.Annotation; annotation == nil || annotation.Layout != annotate.LayoutPolaroid || !annotation.Title {
+		t.Fatalf("layout not recorded in metadata: %#v", annotation)
+	}
+	if info := result.Metadata.Artifacts.Info[ArtifactAnnotated]; info.SHA256 == first.Metadata.Artifacts.Info[ArtifactAnnotated].SHA256 {
+		t.Fatalf("annotated artifact info not updated: %+v", info)
+	}
+	if _, err := engine.Generate(request); err != nil || len(received) != 1 {
+		t.Fatalf("expected the same layout to be served from the cache (err %v, %d requests)", err, len(received))
+	}
+
+	request.Layout = "diagonal"
+	if _, err := engine.Generate(request); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an unknown layout to be rejected, got %v", err)
+	}
+}
@@ -19,6 +19,8 @@ const (
 	ErrArtifactMissing            ErrorCode = "artifact_missing"
 	ErrProviderUnavailable        ErrorCode = "provider_unavailable"
 	ErrProviderFailed             ErrorCode = "provider_failed"
+	ErrSigningKeyUnavailable      ErrorCode = "signing_key_unavailable"
+	ErrImagePayloadInvalid        ErrorCode = "image_payload_invalid"
 )
 
 type Error struct {
@@ -0,0 +1,177 @@
+package dalle
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/pngmeta"
+	"golang.org/x/image/draw"
+)
+
+const (
+	FilterNearest    = "nearest"
+	FilterBilinear   = "bilinear"
+	FilterCatmullRom = "catmull-rom"
+
+	CaptionAbove = "above"
+	CaptionBelow = "below"
+
+	// captionShare is the share of the content area a caption band takes.
+	captionShare = 0.08
+)
+
+// ExportProfile describes a print-ready rendering of an image. Width and
+// Height are the trim size in pixels at DPI; Bleed pixels are added on
+// every side for the printer to cut into. Margin keeps the image that far
+// inside the trim on a white page, with an optional caption (the terse
+// prompt) above or below it; with no margin and no caption the image
+// covers the whole sheet, bleed included. Artifact picks the generated or
+// annotated image as the source.
+type ExportProfile struct {
+	Name     string `json:"name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	DPI      int    `json:"dpi"`
+	Filter   string `json:"filter"`
+	Margin   int    `json:"margin,omitempty"`
+	Bleed    int    `json:"bleed,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Artifact string `json:"artifact"`
+}
+
+// ExportProfiles lists the built-in profiles.
+func ExportProfiles() []ExportProfile {
+	return []ExportProfile{
+		// A4 (210x297mm) with a 10mm margin and 3mm bleed.
+		{Name: "print-a4-300dpi", Width: 2480, Height: 3508, DPI: 300, Filter: FilterCatmullRom, Margin: 118, Bleed: 35, Caption: CaptionBelow, Artifact: ArtifactGenerated},
+		{Name: "square-4k", Width: 4096, Height: 4096, DPI: 300, Filter: FilterCatmullRom, Artifact: ArtifactAnnotated},
+		// 18x24in with a half-inch margin and 1/8in bleed; 150 dpi is
+		// plenty at poster viewing distance.
+		{Name: "poster-18x24", Width: 2700, Height: 3600, DPI: 150, Filter: FilterCatmullRom, Margin: 75, Bleed: 19, Caption: CaptionBelow, Artifact: ArtifactGenerated},
+	}
+}
+
+// LookupExportProfile returns the built-in profile with the given name.
+func LookupExportProfile(name string) (ExportProfile, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	known := []string{}
+	for _, profile := range ExportProfiles() {
+		if profile.Name == name {
+			return profile, nil
+		}
+		known = append(known, profile.Name)
+	}
+	return ExportProfile{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown export profile %q (want one of %s)", name, strings.Join(known, ", ")))
+}
+
+func (profile ExportProfile) scaler() draw.Scaler {
+	switch profile.Filter {
+	case FilterNearest:
+		return draw.NearestNeighbor
+	case FilterBilinear:
+		return draw.BiLinear
+	default:
+		return draw.CatmullRom
+	}
+}
+
+// sourcePath is the artifact the profile renders, falling back to the
+// generated image when an image was never annotated.
+func (profile ExportProfile) sourcePath(set ArtifactSet) string {
+	if profile.Artifact == ArtifactAnnotated && strings.TrimSpace(set.Annotated) != "" {
+		return set.Annotated
+	}
+	return set.Generated
+}
+
+// renderProfile lays img out on the profile's sheet.
+func (engine *Engine) renderProfile(img image.Image, profile ExportProfile, caption string) (*image.RGBA, error) {
+	sheet := image.NewRGBA(image.Rect(0, 0, profile.Width+2*profile.Bleed, profile.Height+2*profile.Bleed))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	bounds := img.Bounds()
+	if profile.Margin == 0 && profile.Caption == "" {
+		// Full bleed: cover the sheet and crop the overflow from the center.
+		scale := max(float64(sheet.Bounds().Dx())/float64(bounds.Dx()), float64(sheet.Bounds().Dy())/float64(bounds.Dy()))
+		width, height := float64(sheet.Bounds().Dx())/scale, float64(sheet.Bounds().Dy())/scale
+		x := bounds.Min.X + int((float64(bounds.Dx())-width)/2)
+		y := bounds.Min.Y + int((float64(bounds.Dy())-height)/2)
+		source := image.Rect(x, y, x+int(width+0.5), y+int(height+0.5))
+		profile.scaler().Scale(sheet, sheet.Bounds(), img, source, draw.Over, nil)
+		return sheet, nil
+	}
+
+	content := image.Rect(0, 0, profile.Width, profile.Height).Add(image.Pt(profile.Bleed, profile.Bleed)).Inset(profile.Margin)
+	area, band := content, image.Rectangle{}
+	if profile.Caption != "" && strings.TrimSpace(caption) != "" {
+		height := int(float64(content.Dy()) * captionShare)
+		gap := max(profile.Margin/2, 1)
+		if profile.Caption == CaptionAbove {
+			band = image.Rect(content.Min.X, content.Min.Y, content.Max.X, content.Min.Y+height)
+			area.Min.Y = band.Max.Y + gap
+		} else {
+			band = image.Rect(content.Min.X, content.Max.Y-height, content.Max.X, content.Max.Y)
+			area.Max.Y = band.Min.Y - gap
+		}
+	}
+	scale := min(float64(area.Dx())/float64(bounds.Dx()), float64(area.Dy())/float64(bounds.Dy()))
+	width, height := int(float64(bounds.Dx())*scale+0.5), int(float64(bounds.Dy())*scale+0.5)
+	x := area.Min.X + (area.Dx()-width)/2
+	y := area.Min.Y + (area.Dy()-height)/2
+	if profile.Caption == CaptionBelow {
+		// Keep the caption close to the image it describes.
+		y = area.Max.Y - height
+	} else if profile.Caption == CaptionAbove {
+		y = area.Min.Y
+	}
+	profile.scaler().Scale(sheet, image.Rect(x, y, x+width, y+height), img, bounds, draw.Over, nil)
+	if !band.Empty() {
+		options := annotate.CaptionOptions{FontDir: filepath.Join(engine.dataDir, "fonts")}
+		if err := annotate.DrawCaption(sheet, band, caption, options); err != nil {
+			return nil, WrapError(ErrInvalidInput, "draw export caption", err)
+		}
+	}
+	return sheet, nil
+}
+
+// exportProfileImage renders the image for profile into dir as
+// <profile>.png, with the image's provenance and the profile's resolution
+// in the PNG.
+func (engine *Engine) exportProfileImage(metadata ImageMetadata, profile ExportProfile, dir string) (string, error) {
+	source := profile.sourcePath(metadata.Artifacts)
+	if strings.TrimSpace(source) == "" {
+		return "", NewError(ErrArtifactMissing, "image has no generated artifact to export")
+	}
+	img, err := decodeImageFile(source)
+	if err != nil {
+		return "", WrapError(ErrArtifactMissing, "read "+profile.Artifact+" artifact", err)
+	}
+	caption := metadata.Prompts.TersePrompt
+	if strings.TrimSpace(caption) == "" {
+		caption = metadata.Prompts.TitlePrompt
+	}
+	sheet, err := engine.renderProfile(img, profile, caption)
+	if err != nil {
+		return "", err
+	}
+	var encoded, tagged, out bytes.Buffer
+	if err := png.Encode(&encoded, sheet); err != nil {
+		return "", WrapError(ErrInvalidInput, "encode export image", err)
+	}
+	if err := pngmeta.WriteText(&tagged, &encoded, ProvenanceOf(metadata).texts()); err != nil {
+		return "", WrapError(ErrInvalidInput, "embed export provenance", err)
+	}
+	if err := pngmeta.WriteDPI(&out, &tagged, profile.DPI); err != nil {
+		return "", WrapError(ErrInvalidInput, "record export resolution", err)
+	}
+	path := filepath.Join(dir, profile.Name+".png")
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		return "", WrapError(ErrMetadataInvalid, "write export image", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,101 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/pngmeta"
+)
+
+func TestEngineExportImageProfile(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	exported, err := engine.ExportImage(result.Metadata.ImageID, ExportImageOptions{Profile: "print-a4-300dpi"})
+	if err != nil {
+		t.Fatalf("ExportImage: %v", err)
+	}
+	if exported.Profile == nil || exported.Files["terse"] == "" {
+		t.Fatalf("expected the profile and the prompt files, got %+v", exported)
+	}
+	profile := *exported.Profile
+	file, err := os.Open(exported.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if dpi, ok, err := pngmeta.ReadDPI(file); err != nil || !ok || dpi != 300 {
+		t.Fatalf("expected 300 dpi, got %d, %v, %v", dpi, ok, err)
+	}
+	img, err := decodeImageFile(exported.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := img.(*image.RGBA)
+	if sheet.Bounds().Dx() != profile.Width+2*profile.Bleed || sheet.Bounds().Dy() != profile.Height+2*profile.Bleed {
+		t.Fatalf("unexpected sheet size %v", sheet.Bounds())
+	}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	if got := sheet.RGBAAt(profile.Bleed+profile.Margin/2, profile.Bleed+profile.Margin/2); got != white {
+		t.Fatalf("expected a white margin, got %v", got)
+	}
+	center := sheet.Bounds().Dx() / 2
+	if got := sheet.RGBAAt(center, sheet.Bounds().Dy()/2); got == white {
+		t.Fatal("expected the image in the middle of the sheet")
+	}
+	inked := false
+	bottom := profile.Bleed + profile.Height - profile.Margin
+	for y := bottom - int(float64(profile.Height)*captionShare); y < bottom && !inked; y++ {
+		for x := profile.Bleed + profile.Margin; x < profile.Bleed+profile.Width-profile.Margin; x++ {
+			if got := sheet.RGBAAt(x, y); got != white {
+				inked = true
+				break
+			}
+		}
+	}
+	if !inked {
+		t.Fatal("expected a caption below the image")
+	}
+	inspection, err := engine.InspectImage(exported.Image)
+	if err != nil || inspection.Provenance == nil || inspection.Provenance.ImageID != result.Metadata.ImageID {
+		t.Fatalf("expected provenance in the exported PNG, got %+v, %v", inspection, err)
+	}
+
+	if _, err := engine.ExportImage(result.Metadata.ImageID, ExportImageOptions{Profile: "billboard"}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an unknown profile to be rejected, got %v", err)
+	}
+}
+
+func TestRenderProfileFullBleed(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			img.Set(x, y, color.RGBA{R: 0x10, G: uint8(x * 4), B: 0x90, A: 0xFF})
+		}
+	}
+	profile := ExportProfile{Name: "tile", Width: 80, Height: 80, DPI: 72, Filter: FilterBilinear, Bleed: 4}
+	sheet, err := engine.renderProfile(img, profile, "ignored without a caption placement")
+	if err != nil {
+		t.Fatalf("renderProfile: %v", err)
+	}
+	if sheet.Bounds().Dx() != 88 || sheet.Bounds().Dy() != 88 {
+		t.Fatalf("unexpected sheet size %v", sheet.Bounds())
+	}
+	for _, corner := range []image.Point{{0, 0}, {87, 0}, {0, 87}, {87, 87}} {
+		if got := sheet.RGBAAt(corner.X, corner.Y); got.B != 0x90 {
+			t.Fatalf("expected the image to cover the bleed at %v, got %v", corner, got)
+		}
+	}
+}
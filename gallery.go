@@ -0,0 +1,384 @@
+package dalle
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GalleryOptions selects the series to publish and where. Out defaults to
+// output/<series>/gallery in the data directory. With Link, assets are
+// symlinked to the artifacts instead of copied, which saves space but only
+// works where the data directory is reachable.
+type GalleryOptions struct {
+	Series string
+	Out    string
+	Link   bool
+}
+
+// GalleryEntry is one image of a gallery as written to index.json. Paths
+// are relative to the gallery directory and use forward slashes.
+type GalleryEntry struct {
+	ImageID    string            `json:"imageId"`
+	Input      string            `json:"input"`
+	Seed       string            `json:"seed"`
+	Title      string            `json:"title"`
+	Terse      string            `json:"terse,omitempty"`
+	Enhanced   string            `json:"enhanced,omitempty"`
+	Attributes map[string]string `json:"attributes"`
+	Page       string            `json:"page"`
+	Image      string            `json:"image"`
+	Thumbnail  string            `json:"thumbnail"`
+	Assets     map[string]string `json:"assets"`
+}
+
+// GalleryIndex is index.json: the series and every published image, for
+// client-side search.
+type GalleryIndex struct {
+	Series string         `json:"series"`
+	Images []GalleryEntry `json:"images"`
+}
+
+type GalleryResult struct {
+	Dir     string   `json:"dir"`
+	Index   string   `json:"index"`
+	JSON    string   `json:"json"`
+	Images  int      `json:"images"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+type galleryField struct {
+	Name  string
+	Value string
+}
+
+type galleryPage struct {
+	Style      template.CSS
+	Series     string
+	Entry      GalleryEntry
+	Records    []SelectedRecord
+	Prompts    []galleryField
+	Provenance []galleryField
+}
+
+// The gallery is meant to be served by a web server, which usually runs as
+// another user, so everything it publishes is world readable.
+const (
+	galleryFileMode = 0o644
+	galleryDirMode  = 0o755
+)
+
+const galleryStyle = `body{margin:0;font-family:system-ui,-apple-system,"Segoe UI",sans-serif;background:#f6f5f2;color:#222}
+header{padding:16px 24px;background:#1c1b22;color:#f6f1e3}header a{color:#f6f1e3}
+h1{margin:0;font-size:1.4em}main{padding:24px}
+input[type=search]{width:100%;max-width:480px;padding:8px;font-size:1em;margin-bottom:16px}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(220px,1fr));gap:16px}
+.cell{background:#fff;border-radius:8px;overflow:hidden;box-shadow:0 1px 3px rgba(0,0,0,.15);text-decoration:none;color:inherit}
+.cell img{width:100%;aspect-ratio:1;object-fit:cover;display:block}.cell span{display:block;padding:8px;font-size:.9em}
+.detail img{max-width:100%;border-radius:8px}table{border-collapse:collapse;margin:8px 0 24px}
+td,th{border-bottom:1px solid #ddd;padding:4px 12px 4px 0;text-align:left;vertical-align:top}
+dt{font-weight:600;margin-top:12px}dd{margin:4px 0 0;white-space:pre-wrap}code{word-break:break-all}`
+
+var galleryIndexTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Series}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header><h1>{{.Series}}</h1></header>
+<main>
+<input type="search" id="search" placeholder="Search titles, inputs and attributes">
+<div class="grid" id="grid">
+{{range .Images}}<a class="cell" href="{{.Page}}" data-search="{{.Search}}"><img src="{{.Thumbnail}}" alt="{{.Title}}" loading="lazy"><span>{{.Title}}</span></a>
+{{end}}</div>
+</main>
+<script>
+document.getElementById("search").addEventListener("input", function (event) {
+  var terms = event.target.value.toLowerCase().split(/\s+/).filter(Boolean);
+  document.querySelectorAll("#grid .cell").forEach(function (cell) {
+    var text = cell.dataset.search;
+    cell.style.display = terms.every(function (term) { return text.indexOf(term) >= 0; }) ? "" : "none";
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+var galleryPageTemplate = template.Must(template.New("page").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Entry.Title}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header><a href="../index.html">{{.Series}}</a><h1>{{.Entry.Title}}</h1></header>
+<main class="detail">
+<img src="../{{.Entry.Image}}" alt="{{.Entry.Title}}">
+<h2>Attributes</h2>
+<table>
+<tr><th>Attribute</th><th>Value</th><th>Database</th><th>Row</th></tr>
+{{range .Records}}<tr><td>{{.Attribute}}</td><td>{{.Record}}</td><td>{{.Database}}</td><td>{{.RowIndex}}{{if .Overridden}} (pinned){{end}}</td></tr>
+{{end}}</table>
+<h2>Prompts</h2>
+<dl>
+{{range .Prompts}}<dt>{{.Name}}</dt><dd>{{.Value}}</dd>
+{{end}}</dl>
+<h2>Provenance</h2>
+<table>
+{{range .Provenance}}<tr><th>{{.Name}}</th><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>
+<h2>Files</h2>
+<ul>
+{{range $name, $path := .Entry.Assets}}<li><a href="../{{$path}}">{{$name}}</a></li>
+{{end}}</ul>
+</main>
+</body>
+</html>
+`))
+
+// ExportGallery writes a static, self-contained site for a series: an
+// index page of thumbnails with a search box, a detail page per image with
+// its attributes, prompts and provenance, the images themselves under
+// assets/ and index.json. Images with no artifact on disk are skipped.
+func (engine *Engine) ExportGallery(options GalleryOptions) (GalleryResult, error) {
+	if engine == nil {
+		return GalleryResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	series := strings.TrimSpace(options.Series)
+	if series == "" {
+		return GalleryResult{}, NewError(ErrInvalidInput, "gallery series is required")
+	}
+	records, err := engine.ListImages(ImageFilter{Series: series})
+	if err != nil {
+		return GalleryResult{}, err
+	}
+	if len(records) == 0 {
+		return GalleryResult{}, NewError(ErrArtifactMissing, fmt.Sprintf("series %s has no images", series))
+	}
+	dir := strings.TrimSpace(options.Out)
+	if dir == "" {
+		dir = filepath.Join(engine.dataDir, "output", safePathPart(series), "gallery")
+	}
+	if hasLeadingTilde(dir) {
+		return GalleryResult{}, NewError(ErrInvalidInput, "gallery directory must not start with '~'")
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(engine.dataDir, dir)
+	}
+	dir = filepath.Clean(dir)
+	for _, sub := range []string{dir, filepath.Join(dir, "images")} {
+		if err := makeGalleryDir(sub); err != nil {
+			return GalleryResult{}, WrapError(ErrMetadataInvalid, "create gallery directory", err)
+		}
+	}
+
+	result := GalleryResult{Dir: dir, Index: filepath.Join(dir, "index.html"), JSON: filepath.Join(dir, "index.json")}
+	index := GalleryIndex{Series: series, Images: []GalleryEntry{}}
+	pages := []galleryPage{}
+	for _, record := range records {
+		metadata := record.Metadata
+		entry, err := galleryAssets(metadata, dir, options.Link)
+		if err != nil {
+			return GalleryResult{}, err
+		}
+		if entry.Image == "" {
+			result.Skipped = append(result.Skipped, metadata.ImageID)
+			continue
+		}
+		index.Images = append(index.Images, entry)
+		pages = append(pages, galleryPage{Style: template.CSS(galleryStyle), Series: series, Entry: entry, Records: metadata.SelectedRecords, Prompts: galleryPrompts(metadata.Prompts), Provenance: galleryProvenance(metadata)})
+	}
+	if len(index.Images) == 0 {
+		return GalleryResult{}, NewError(ErrArtifactMissing, fmt.Sprintf("series %s has no images on disk", series))
+	}
+
+	for _, page := range pages {
+		if err := writeGalleryFile(filepath.Join(dir, filepath.FromSlash(page.Entry.Page)), galleryPageTemplate, page); err != nil {
+			return GalleryResult{}, err
+		}
+	}
+	type cell struct {
+		GalleryEntry
+		Search string
+	}
+	cells := []cell{}
+	for _, entry := range index.Images {
+		words := []string{entry.Title, entry.Input, entry.Seed, entry.Terse}
+		for _, value := range entry.Attributes {
+			words = append(words, value)
+		}
+		cells = append(cells, cell{entry, strings.ToLower(strings.Join(words, " "))})
+	}
+	data := struct {
+		Series string
+		Style  template.CSS
+		Images []cell
+	}{series, template.CSS(galleryStyle), cells}
+	if err := writeGalleryFile(result.Index, galleryIndexTemplate, data); err != nil {
+		return GalleryResult{}, err
+	}
+	encoded, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return GalleryResult{}, WrapError(ErrMetadataInvalid, "encode gallery index", err)
+	}
+	if err := os.WriteFile(result.JSON, append(encoded, '\n'), galleryFileMode); err != nil {
+		return GalleryResult{}, WrapError(ErrMetadataInvalid, "write gallery index", err)
+	}
+	if err := os.Chmod(result.JSON, galleryFileMode); err != nil {
+		return GalleryResult{}, WrapError(ErrMetadataInvalid, "write gallery index", err)
+	}
+	result.Images = len(index.Images)
+	return result, nil
+}
+
+// galleryAssets copies (or links) every artifact of the image into
+// assets/<artifact>/ and returns its index entry. The entry has no Image
+// when neither the annotated nor the generated image is on disk.
+func galleryAssets(metadata ImageMetadata, dir string, link bool) (GalleryEntry, error) {
+	slug := metadata.ImageID
+	if _, hash, ok := strings.Cut(slug, ":"); ok {
+		slug = hash
+	}
+	slug = safePathPart(slug)
+	entry := GalleryEntry{
+		ImageID:    metadata.ImageID,
+		Input:      metadata.Input,
+		Seed:       metadata.Seed,
+		Title:      metadata.Prompts.TitlePrompt,
+		Terse:      metadata.Prompts.TersePrompt,
+		Enhanced:   metadata.Prompts.EnhancedPrompt,
+		Attributes: map[string]string{},
+		Page:       path.Join("images", slug+".html"),
+		Assets:     map[string]string{},
+	}
+	if entry.Title == "" {
+		entry.Title = metadata.Input
+	}
+	for _, record := range metadata.SelectedRecords {
+		value, _, _ := strings.Cut(record.Record, ",")
+		entry.Attributes[record.Attribute] = value
+	}
+	for _, artifact := range metadata.Artifacts.Named() {
+		if info, err := os.Stat(artifact.Path); err != nil || info.Size() == 0 {
+			continue
+		}
+		asset := path.Join("assets", artifact.Name, slug+strings.ToLower(filepath.Ext(artifact.Path)))
+		target := filepath.Join(dir, filepath.FromSlash(asset))
+		if err := makeGalleryDir(filepath.Dir(target)); err != nil {
+			return GalleryEntry{}, WrapError(ErrMetadataInvalid, "create gallery assets directory", err)
+		}
+		if err := publishAsset(artifact.Path, target, link); err != nil {
+			return GalleryEntry{}, WrapError(ErrArtifactMissing, "publish "+artifact.Name+" artifact", err)
+		}
+		entry.Assets[artifact.Name] = asset
+	}
+	for _, name := range []string{ArtifactAnnotated, ArtifactGenerated} {
+		if asset, ok := entry.Assets[name]; ok && entry.Image == "" {
+			entry.Image = asset
+		}
+	}
+	entry.Thumbnail = entry.Image
+	if asset, ok := entry.Assets["thumbnail"]; ok {
+		entry.Thumbnail = asset
+	}
+	return entry, nil
+}
+
+func publishAsset(source, target string, link bool) error {
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if link {
+		absolute, err := filepath.Abs(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(absolute, target)
+	}
+	in, err := os.Open(filepath.Clean(source))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filepath.Clean(target), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, galleryFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, galleryFileMode)
+}
+
+// makeGalleryDir creates the directory and opens it up to galleryDirMode,
+// which MkdirAll alone does not do under a restrictive umask or when an
+// earlier export created the directory.
+func makeGalleryDir(dir string) error {
+	if err := os.MkdirAll(dir, galleryDirMode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, galleryDirMode)
+}
+
+func galleryPrompts(prompts PromptSet) []galleryField {
+	fields := []galleryField{}
+	for _, field := range []galleryField{
+		{"Title", prompts.TitlePrompt},
+		{"Terse", prompts.TersePrompt},
+		{"Enhanced", prompts.EnhancedPrompt},
+		{"Prompt", prompts.Prompt},
+		{"Data", prompts.DataPrompt},
+	} {
+		if strings.TrimSpace(field.Value) != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// galleryProvenance lists the provenance fields other than the prompts,
+// which the page shows on their own.
+func galleryProvenance(metadata ImageMetadata) []galleryField {
+	provenance := ProvenanceOf(metadata)
+	fields := []galleryField{}
+	for _, field := range provenance.fields() {
+		if *field.value == "" || strings.HasSuffix(strings.ToLower(field.name), "prompt") {
+			continue
+		}
+		fields = append(fields, galleryField{field.name, *field.value})
+	}
+	return fields
+}
+
+func writeGalleryFile(path string, page *template.Template, data any) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, galleryFileMode)
+	if err != nil {
+		return WrapError(ErrMetadataInvalid, "create gallery page", err)
+	}
+	if err := page.Execute(file, data); err != nil {
+		_ = file.Close()
+		return WrapError(ErrMetadataInvalid, "write gallery page", err)
+	}
+	if err := file.Close(); err != nil {
+		return WrapError(ErrMetadataInvalid, "write gallery page", err)
+	}
+	if err := os.Chmod(path, galleryFileMode); err != nil {
+		return WrapError(ErrMetadataInvalid, "write gallery page", err)
+	}
+	return nil
+}
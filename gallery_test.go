@@ -0,0 +1,108 @@
+package dalle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngineExportGallery(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	generated, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := engine.Generate(GenerateRequest{Input: "prompt only"}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "site")
+	if err := os.MkdirAll(out, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.ExportGallery(GalleryOptions{Series: generated.Series, Out: out})
+	if err != nil {
+		t.Fatalf("ExportGallery: %v", err)
+	}
+	if result.Images != 1 || len(result.Skipped) != 1 || result.Dir != out {
+		t.Fatalf("unexpected gallery %+v", result)
+	}
+	data, err := os.ReadFile(result.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := GalleryIndex{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Images) != 1 {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	entry := index.Images[0]
+	if entry.ImageID != generated.Metadata.ImageID || entry.Attributes["noun"] == "" || !strings.HasPrefix(entry.Thumbnail, "assets/thumbnail/") || !strings.HasPrefix(entry.Image, "assets/annotated/") {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	for name, asset := range entry.Assets {
+		info, err := os.Lstat(filepath.Join(out, filepath.FromSlash(asset)))
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			t.Fatalf("expected %s copied into the gallery, got %v", name, err)
+		}
+	}
+	if err := filepath.WalkDir(out, func(path string, item os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := item.Info()
+		if err != nil {
+			return err
+		}
+		want := os.FileMode(0o644)
+		if item.IsDir() {
+			want = 0o755
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("expected %s to have mode %v, got %v", path, want, info.Mode().Perm())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(entry.Page)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{entry.Title, "../" + entry.Image, generated.Metadata.Seed, "seriesHash", "<style>"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("expected the detail page to contain %q", want)
+		}
+	}
+	home, err := os.ReadFile(result.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(home), `href="`+entry.Page+`"`) || strings.Contains(string(home), "http") {
+		t.Fatalf("expected a self-contained index linking the page:\n%s", home)
+	}
+
+	linked, err := engine.ExportGallery(GalleryOptions{Series: generated.Series, Link: true})
+	if err != nil || filepath.Base(linked.Dir) != "gallery" {
+		t.Fatalf("expected the default gallery directory, got %+v, %v", linked, err)
+	}
+	if info, err := os.Lstat(filepath.Join(linked.Dir, filepath.FromSlash(entry.Image))); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected a linked asset, got %v", err)
+	}
+
+	if _, err := engine.ExportGallery(GalleryOptions{}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected the series to be required, got %v", err)
+	}
+	if _, err := engine.ExportGallery(GalleryOptions{Series: "no-such-series"}); ErrorCodeOf(err) != ErrArtifactMissing {
+		t.Fatalf("expected an empty series to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package dalle
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatTXT  = "txt"
+	ImportFormatJSON = "json"
+
+	ImportStatusGenerated = "generated"
+	ImportStatusCached    = "cached"
+	ImportStatusFailed    = "failed"
+)
+
+// AddressList is the result of reading an address export: normalized, deduped
+// addresses in first-seen order, plus the entries that were not addresses.
+type AddressList struct {
+	Addresses []string `json:"addresses"`
+	Invalid   []string `json:"invalid,omitempty"`
+}
+
+// ParseAddressList reads the address lists TrueBlocks tools export: CSV or
+// tab-separated text (an "address" column when there is a header, otherwise
+// the first field that is an address) and JSON (an array, or an object with a
+// "data" array, of address strings or objects with an "address" field). An
+// empty format is detected from the content.
+func ParseAddressList(reader io.Reader, format string) (AddressList, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return AddressList{}, WrapError(ErrInvalidInput, "read address list", err)
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = detectAddressListFormat(contents)
+	}
+	var raw []string
+	switch format {
+	case ImportFormatJSON:
+		raw, err = addressesFromJSON(contents)
+	case ImportFormatCSV:
+		raw, err = addressesFromDelimited(contents, ',')
+	case ImportFormatTXT, "tsv":
+		raw, err = addressesFromDelimited(contents, '\t')
+	default:
+		return AddressList{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown address list format %q", format))
+	}
+	if err != nil {
+		return AddressList{}, err
+	}
+	list := AddressList{Addresses: []string{}}
+	seen := map[string]bool{}
+	for _, value := range raw {
+		address, err := normalizeAddress(strings.TrimSpace(value))
+		if err != nil {
+			list.Invalid = append(list.Invalid, value)
+			continue
+		}
+		if !seen[address] {
+			seen[address] = true
+			list.Addresses = append(list.Addresses, address)
+		}
+	}
+	return list, nil
+}
+
+func detectAddressListFormat(contents []byte) string {
+	trimmed := bytes.TrimSpace(contents)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return ImportFormatJSON
+	}
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	if bytes.ContainsRune(firstLine, ',') && !bytes.ContainsRune(firstLine, '\t') {
+		return ImportFormatCSV
+	}
+	return ImportFormatTXT
+}
+
+func addressesFromJSON(contents []byte) ([]string, error) {
+	var document any
+	if err := json.Unmarshal(contents, &document); err != nil {
+		return nil, WrapError(ErrInvalidInput, "decode JSON address list", err)
+	}
+	if object, ok := document.(map[string]any); ok {
+		document = object["data"]
+	}
+	items, ok := document.([]any)
+	if !ok {
+		return nil, NewError(ErrInvalidInput, "JSON address list must be an array or an object with a data array")
+	}
+	addresses := make([]string, 0, len(items))
+	for _, item := range items {
+		switch value := item.(type) {
+		case string:
+			addresses = append(addresses, value)
+		case map[string]any:
+			if address, ok := value["address"].(string); ok {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+func addressesFromDelimited(contents []byte, delimiter rune) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(contents))
+	reader.Comma = delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, WrapError(ErrInvalidInput, "decode address list", err)
+	}
+	column := -1
+	if len(records) > 0 {
+		for index, field := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(field), "address") {
+				column = index
+				records = records[1:]
+				break
+			}
+		}
+	}
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		if column >= 0 {
+			if column < len(record) {
+				addresses = append(addresses, record[column])
+			}
+			continue
+		}
+		found := ""
+		for _, field := range record {
+			if addressPattern.MatchString(strings.TrimSpace(field)) {
+				found = field
+				break
+			}
+		}
+		if found == "" && len(record) > 0 && strings.TrimSpace(strings.Join(record, "")) != "" {
+			// Keep the row so that it is reported as invalid rather than dropped.
+			found = strings.Join(record, string(delimiter))
+		}
+		if found != "" {
+			addresses = append(addresses, found)
+		}
+	}
+	return addresses, nil
+}
+
+// ImportRequest describes a bulk generation from an address list file. The
+// manifest defaults to output/<series>/imports/<source name>.json in the data
+// directory and is merged with any manifest already there.
+type ImportRequest struct {
+	Path       string `json:"path"`
+	Format     string `json:"format,omitempty"`
+	Manifest   string `json:"manifest,omitempty"`
+	Series     string `json:"series,omitempty"`
+	SeedScheme string `json:"seedScheme,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Preview    bool   `json:"preview,omitempty"`
+	Enhance    bool   `json:"enhance,omitempty"`
+	Image      bool   `json:"image,omitempty"`
+	Annotate   bool   `json:"annotate,omitempty"`
+}
+
+type ImportEntry struct {
+	Address string `json:"address"`
+	ImageID string `json:"imageId,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ImportResult struct {
+	Source    string        `json:"source"`
+	Manifest  string        `json:"manifest"`
+	Generated int           `json:"generated"`
+	Cached    int           `json:"cached"`
+	Failed    int           `json:"failed"`
+	Invalid   []string      `json:"invalid,omitempty"`
+	Entries   []ImportEntry `json:"entries"`
+}
+
+// ImportManifest maps each imported source address to its image id and to
+// its edition number for badges. An address keeps the edition it was first
+// given; addresses new to the list get the next free number.
+type ImportManifest struct {
+	Source   string            `json:"source"`
+	Series   string            `json:"series"`
+	Images   map[string]string `json:"images"`
+	Editions map[string]int    `json:"editions,omitempty"`
+}
+
+// ImportAddresses generates an image for every address in an exported list.
+// Addresses with compatible cached metadata are not generated again. A
+// failure on one address is recorded in its entry and the import continues.
+func (engine *Engine) ImportAddresses(request ImportRequest) (ImportResult, error) {
+	if engine == nil {
+		return ImportResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if strings.TrimSpace(request.Path) == "" {
+		return ImportResult{}, NewError(ErrInvalidInput, "import source path is required")
+	}
+	if request.Annotate && !request.Image {
+		return ImportResult{}, NewError(ErrProviderUnavailable, "annotation requires image generation")
+	}
+	file, err := os.Open(filepath.Clean(request.Path))
+	if err != nil {
+		return ImportResult{}, WrapError(ErrArtifactMissing, "open import source", err)
+	}
+	defer file.Close()
+	format := request.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(request.Path)) {
+		case ".json":
+			format = ImportFormatJSON
+		case ".csv":
+			format = ImportFormatCSV
+		case ".txt", ".tsv":
+			format = ImportFormatTXT
+		}
+	}
+	list, err := ParseAddressList(file, format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	addresses := list.Addresses
+	if request.Limit > 0 && len(addresses) > request.Limit {
+		addresses = addresses[:request.Limit]
+	}
+
+	series := strings.TrimSpace(request.Series)
+	if series == "" {
+		series = DefaultSeriesName
+	}
+	manifestPath := request.Manifest
+	if manifestPath == "" {
+		name := strings.TrimSuffix(filepath.Base(request.Path), filepath.Ext(request.Path))
+		manifestPath = filepath.Join(engine.dataDir, "output", safePathPart(series), "imports", safePathPart(name)+".json")
+	}
+	manifest, err := readImportManifest(manifestPath)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	manifest.Source = request.Path
+	manifest.Series = series
+
+	result := ImportResult{Source: request.Path, Manifest: manifestPath, Invalid: list.Invalid, Entries: []ImportEntry{}}
+	for _, address := range addresses {
+		generateRequest := GenerateRequest{
+			Input:      address,
+			InputKind:  InputKindAddress,
+			Series:     series,
+			SeedScheme: request.SeedScheme,
+			Edition:    manifest.edition(address),
+			Enhance:    request.Enhance,
+			Image:      request.Image,
+			Annotate:   request.Annotate,
+		}
+		entry := ImportEntry{Address: address}
+		cached, ok, err := engine.cachedMetadata(generateRequest)
+		if ok && err == nil {
+			if ok = cachedSatisfiesRequest(cached.Metadata, generateRequest); ok {
+				ok, err = engine.annotationSatisfiesRequest(cached.Metadata, generateRequest)
+			}
+		}
+		switch {
+		case err != nil:
+			entry.Status, entry.Error = ImportStatusFailed, err.Error()
+		case ok:
+			entry.Status, entry.ImageID = ImportStatusCached, cached.Metadata.ImageID
+		default:
+			var generated GenerateResult
+			if request.Preview {
+				generated, err = engine.Preview(generateRequest)
+			} else {
+				generated, err = engine.Generate(generateRequest)
+			}
+			if err != nil {
+				entry.Status, entry.Error = ImportStatusFailed, err.Error()
+			} else {
+				entry.Status, entry.ImageID = ImportStatusGenerated, generated.Metadata.ImageID
+			}
+		}
+		switch entry.Status {
+		case ImportStatusGenerated:
+			result.Generated++
+		case ImportStatusCached:
+			result.Cached++
+		default:
+			result.Failed++
+		}
+		if entry.ImageID != "" {
+			manifest.Images[address] = entry.ImageID
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	if err := writeImportManifest(manifestPath, manifest); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// edition returns the edition number of an address, giving it the next free
+// one when it has none yet.
+func (manifest *ImportManifest) edition(address string) int {
+	if edition, ok := manifest.Editions[address]; ok {
+		return edition
+	}
+	next := 1
+	for _, edition := range manifest.Editions {
+		next = max(next, edition+1)
+	}
+	manifest.Editions[address] = next
+	return next
+}
+
+func readImportManifest(path string) (ImportManifest, error) {
+	manifest := ImportManifest{Images: map[string]string{}, Editions: map[string]int{}}
+	contents, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return ImportManifest{}, WrapError(ErrMetadataInvalid, "read import manifest", err)
+	}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return ImportManifest{}, WrapError(ErrMetadataInvalid, "decode import manifest", err)
+	}
+	if manifest.Images == nil {
+		manifest.Images = map[string]string{}
+	}
+	if manifest.Editions == nil {
+		manifest.Editions = map[string]int{}
+	}
+	return manifest, nil
+}
+
+func writeImportManifest(path string, manifest ImportManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return WrapError(ErrMetadataInvalid, "create import manifest directory", err)
+	}
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return WrapError(ErrMetadataInvalid, "encode import manifest", err)
+	}
+	if err := os.WriteFile(path, append(encoded, '\n'), 0o600); err != nil {
+		return WrapError(ErrMetadataInvalid, "write import manifest", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package dalle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	importAddressA = "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	importAddressB = "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"
+)
+
+func TestParseAddressListFormats(t *testing.T) {
+	cases := map[string]string{
+		"csv":       "\"blockNumber\",\"transactionIndex\",\"address\"\n\"100\",\"2\",\"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed\"\n\"101\",\"0\",\"" + importAddressB + "\"\n\"102\",\"1\",\"" + importAddressA + "\"\n",
+		"txt":       "# monitor export\n" + importAddressA + "\t100\n\n" + strings.ToUpper(importAddressB[2:]) + "\n100\t" + importAddressB + "\n",
+		"json-data": `{"data":[{"address":"` + importAddressA + `","blockNumber":1},{"address":"` + importAddressB + `"}]}`,
+		"json-list": `["` + importAddressA + `", "` + importAddressB + `", "` + importAddressA + `"]`,
+	}
+	for name, contents := range cases {
+		list, err := ParseAddressList(strings.NewReader(contents), "")
+		if err != nil {
+			t.Fatalf("%s: ParseAddressList: %v", name, err)
+		}
+		if len(list.Addresses) != 2 || list.Addresses[0] != importAddressA || list.Addresses[1] != importAddressB {
+			t.Errorf("%s: unexpected addresses %v", name, list.Addresses)
+		}
+		if name == "txt" && len(list.Invalid) != 1 {
+			t.Errorf("txt: expected the unprefixed row to be reported invalid, got %v", list.Invalid)
+		}
+	}
+	if _, err := ParseAddressList(strings.NewReader("{}"), "xml"); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected unknown format to be rejected, got %v", err)
+	}
+}
+
+func TestEngineImportAddressesKeepsEditions(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	writeBadgedSeries(t, dataDir, "{{.Edition}}")
+	source := filepath.Join(t.TempDir(), "monitor.txt")
+	importList := func(addresses ...string) ImportResult {
+		t.Helper()
+		if err := os.WriteFile(source, []byte(strings.Join(addresses, "\n")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		result, err := engine.ImportAddresses(ImportRequest{Path: source, Series: "badged", Image: true, Annotate: true})
+		if err != nil {
+			t.Fatalf("ImportAddresses: %v", err)
+		}
+		return result
+	}
+	importList(importAddressA, importAddressB)
+	const importAddressC = "0x0000000000000000000000000000000000000001"
+	result := importList(importAddressB, importAddressC, importAddressA)
+	if result.Cached != 2 || result.Generated != 1 {
+		t.Fatalf("expected a reordered list to keep its cached images: %#v", result)
+	}
+	for address, want := range map[string]string{importAddressA: "1", importAddressB: "2", importAddressC: "3"} {
+		for _, entry := range result.Entries {
+			if entry.Address != address {
+				continue
+			}
+			record, err := engine.GetImage(entry.ImageID)
+			if err != nil {
+				t.Fatalf("GetImage: %v", err)
+			}
+			if badge := record.Metadata.Annotation.Badge; badge == nil || badge.Text != want {
+				t.Fatalf("%s: expected edition %s, got %+v", address, want, badge)
+			}
+		}
+	}
+}
+
+func TestEngineImportAddressesWritesManifestAndSkipsCached(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	source := filepath.Join(t.TempDir(), "monitor.csv")
+	if err := os.WriteFile(source, []byte("address\n"+importAddressA+"\n"+importAddressB+"\nnot-an-address\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	first, err := engine.ImportAddresses(ImportRequest{Path: source, Preview: true})
+	if err != nil {
+		t.Fatalf("ImportAddresses: %v", err)
+	}
+	if first.Generated != 2 || first.Cached != 0 || first.Failed != 0 || len(first.Invalid) != 1 {
+		t.Fatalf("unexpected first import: %#v", first)
+	}
+	if first.Manifest != filepath.Join(dataDir, "output", DefaultSeriesName, "imports", "monitor.json") {
+		t.Fatalf("unexpected manifest path %s", first.Manifest)
+	}
+
+	second, err := engine.ImportAddresses(ImportRequest{Path: source, Preview: true})
+	if err != nil {
+		t.Fatalf("ImportAddresses again: %v", err)
+	}
+	if second.Generated != 0 || second.Cached != 2 {
+		t.Fatalf("expected cached addresses to be skipped: %#v", second)
+	}
+
+	contents, err := os.ReadFile(first.Manifest)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var manifest ImportManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	for _, entry := range first.Entries {
+		if manifest.Images[entry.Address] != entry.ImageID {
+			t.Fatalf("manifest missing %s: %#v", entry.Address, manifest.Images)
+		}
+		record, err := engine.GetImage(entry.ImageID)
+		if err != nil || record.Metadata.InputInfo == nil || record.Metadata.InputInfo.Kind != InputKindAddress {
+			t.Fatalf("imported image not stored as an address: %v", err)
+		}
+	}
+}
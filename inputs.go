@@ -0,0 +1,183 @@
+package dalle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/utils"
+)
+
+const (
+	InputKindText    = "text"
+	InputKindAddress = "address"
+	InputKindENS     = "ens"
+	InputKindTxHash  = "tx"
+	InputKindBlock   = "block"
+)
+
+// ENSResolver resolves an ENS name (already lowercased) to an address.
+type ENSResolver interface {
+	Resolve(name string) (string, error)
+}
+
+// FileENSResolver resolves ENS names from a JSON object of name to address,
+// standing in for a chain-backed resolver in tests and offline use. The
+// default engine resolver reads ens.json in the data directory.
+type FileENSResolver struct {
+	Path string
+}
+
+func (resolver FileENSResolver) Resolve(name string) (string, error) {
+	contents, err := os.ReadFile(filepath.Clean(resolver.Path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", NewError(ErrProviderUnavailable, "no ENS resolver is configured")
+		}
+		return "", WrapError(ErrProviderFailed, "read ENS names", err)
+	}
+	names := map[string]string{}
+	if err := json.Unmarshal(contents, &names); err != nil {
+		return "", WrapError(ErrProviderFailed, "decode ENS names", err)
+	}
+	for candidate, address := range names {
+		if strings.EqualFold(candidate, name) {
+			return address, nil
+		}
+	}
+	return "", NewError(ErrInvalidInput, fmt.Sprintf("ENS name %s does not resolve", name))
+}
+
+// MetadataInput records how the raw input was interpreted. Canonical is the
+// form stored as the metadata input and used for seeding; ENSName keeps the
+// name an address was resolved from.
+type MetadataInput struct {
+	Kind      string `json:"kind"`
+	Canonical string `json:"canonical"`
+	Original  string `json:"original,omitempty"`
+	ENSName   string `json:"ensName,omitempty"`
+}
+
+var (
+	txHashPattern  = regexp.MustCompile(`^0[xX][0-9a-fA-F]{64}$`)
+	blockPattern   = regexp.MustCompile(`^[0-9][0-9_,]*$`)
+	ensNamePattern = regexp.MustCompile(`^([a-z0-9-]+\.)+eth$`)
+)
+
+// DetectInputKind guesses the kind of a trimmed input. Only values that
+// cannot have been meant as text are detected: addresses (with a valid
+// EIP-55 checksum when mixed case) and transaction hashes. Everything else,
+// numbers and .eth names included, is text; block numbers and ENS names need
+// an explicit kind. A new request for a checksummed address or an uppercase
+// hash is lowercased and so seeds differently than it did before detection;
+// stored records without an input kind are regenerated as text.
+func DetectInputKind(input string) string {
+	switch {
+	case addressPattern.MatchString(input):
+		if _, err := normalizeAddress(input); err != nil {
+			return InputKindText
+		}
+		return InputKindAddress
+	case txHashPattern.MatchString(input):
+		return InputKindTxHash
+	default:
+		return InputKindText
+	}
+}
+
+// NormalizeInput validates input as the given kind (detected with
+// DetectInputKind when empty) and returns its canonical form. Addresses and
+// hashes are lowercased so that differently cased spellings of one value
+// seed the same image; mixed-case addresses must carry a valid EIP-55
+// checksum. ENS names are resolved to their address with resolver.
+func NormalizeInput(input, kind string, resolver ENSResolver) (MetadataInput, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return MetadataInput{}, NewError(ErrInvalidInput, "input is required")
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = DetectInputKind(input)
+	}
+	normalized := MetadataInput{Kind: kind, Original: input}
+	switch kind {
+	case InputKindText:
+		normalized.Canonical = input
+	case InputKindAddress:
+		address, err := normalizeAddress(input)
+		if err != nil {
+			return MetadataInput{}, err
+		}
+		normalized.Canonical = address
+	case InputKindTxHash:
+		if !txHashPattern.MatchString(input) {
+			return MetadataInput{}, NewError(ErrInvalidInput, fmt.Sprintf("%q is not a 32-byte transaction hash", input))
+		}
+		normalized.Canonical = strings.ToLower(input)
+	case InputKindBlock:
+		digits := strings.NewReplacer("_", "", ",", "").Replace(input)
+		number, err := strconv.ParseUint(digits, 10, 64)
+		if err != nil || !blockPattern.MatchString(input) {
+			return MetadataInput{}, NewError(ErrInvalidInput, fmt.Sprintf("%q is not a block number", input))
+		}
+		normalized.Canonical = strconv.FormatUint(number, 10)
+	case InputKindENS:
+		name := strings.ToLower(input)
+		if !ensNamePattern.MatchString(name) {
+			return MetadataInput{}, NewError(ErrInvalidInput, fmt.Sprintf("%q is not an ENS name", input))
+		}
+		if resolver == nil {
+			return MetadataInput{}, NewError(ErrProviderUnavailable, "no ENS resolver is configured")
+		}
+		resolved, err := resolver.Resolve(name)
+		if err != nil {
+			if ErrorCodeOf(err) != "" {
+				return MetadataInput{}, err
+			}
+			return MetadataInput{}, WrapError(ErrProviderFailed, "resolve "+name, err)
+		}
+		address, err := normalizeAddress(strings.TrimSpace(resolved))
+		if err != nil {
+			return MetadataInput{}, WrapError(ErrProviderFailed, "resolve "+name, err)
+		}
+		normalized.Canonical = address
+		normalized.ENSName = name
+	default:
+		return MetadataInput{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown input kind %q", kind))
+	}
+	if normalized.Original == normalized.Canonical {
+		normalized.Original = ""
+	}
+	return normalized, nil
+}
+
+func normalizeAddress(input string) (string, error) {
+	if !addressPattern.MatchString(input) {
+		return "", NewError(ErrInvalidInput, fmt.Sprintf("%q is not a 20-byte address", input))
+	}
+	body := input[2:]
+	lower := strings.ToLower(body)
+	if body != lower && body != strings.ToUpper(body) && input[:2]+body != ChecksumAddress(lower) {
+		return "", NewError(ErrInvalidInput, fmt.Sprintf("address %s has an invalid EIP-55 checksum", input))
+	}
+	return "0x" + lower, nil
+}
+
+// ChecksumAddress returns the EIP-55 mixed-case form of an address.
+func ChecksumAddress(address string) string {
+	lower := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	hash := hex.EncodeToString(utils.Keccak256([]byte(lower)))
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
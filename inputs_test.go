@@ -0,0 +1,140 @@
+package dalle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeInputKinds(t *testing.T) {
+	resolver := FileENSResolver{Path: filepath.Join(t.TempDir(), "ens.json")}
+	if err := os.WriteFile(resolver.Path, []byte(`{"trueblocks.eth": "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		input     string
+		given     string
+		kind      string
+		canonical string
+	}{
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "", InputKindAddress, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{"0X5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "", InputKindAddress, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{" TrueBlocks.ETH ", InputKindENS, InputKindENS, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{"0x" + strings.Repeat("AB", 32), "", InputKindTxHash, "0x" + strings.Repeat("ab", 32)},
+		{"0_012_345", InputKindBlock, InputKindBlock, "12345"},
+		{"Person Tour Coordinates", "", InputKindText, "Person Tour Coordinates"},
+		// Text that only looks like another kind keeps the seed it had
+		// before detection.
+		{"trueblocks.eth", "", InputKindText, "trueblocks.eth"},
+		{"007", "", InputKindText, "007"},
+		{"1,000", "", InputKindText, "1,000"},
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", "", InputKindText, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+	}
+	for _, c := range cases {
+		got, err := NormalizeInput(c.input, c.given, resolver)
+		if err != nil {
+			t.Fatalf("NormalizeInput(%q): %v", c.input, err)
+		}
+		if got.Kind != c.kind || got.Canonical != c.canonical {
+			t.Errorf("NormalizeInput(%q) = %s %s, want %s %s", c.input, got.Kind, got.Canonical, c.kind, c.canonical)
+		}
+	}
+	if got, _ := NormalizeInput("trueblocks.eth", InputKindENS, resolver); got.ENSName != "trueblocks.eth" {
+		t.Errorf("expected ENS name recorded, got %#v", got)
+	}
+	if got, _ := NormalizeInput("12345", InputKindText, resolver); got.Kind != InputKindText {
+		t.Errorf("explicit kind should win over detection, got %#v", got)
+	}
+}
+
+func TestNormalizeInputRejectsInvalidValues(t *testing.T) {
+	resolver := FileENSResolver{Path: filepath.Join(t.TempDir(), "ens.json")}
+	for _, c := range []struct{ input, kind string }{
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", InputKindAddress}, // bad checksum
+		{"0x1234", InputKindAddress},
+		{"0x1234", InputKindTxHash},
+		{"12a", InputKindBlock},
+		{"hello", "nft"},
+	} {
+		if _, err := NormalizeInput(c.input, c.kind, resolver); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("NormalizeInput(%q, %q): expected invalid input, got %v", c.input, c.kind, err)
+		}
+	}
+	if _, err := NormalizeInput("nobody.eth", InputKindENS, resolver); ErrorCodeOf(err) != ErrProviderUnavailable {
+		t.Errorf("expected missing resolver file to be reported, got %v", err)
+	}
+}
+
+func TestChecksumAddress(t *testing.T) {
+	for _, address := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if got := ChecksumAddress(strings.ToLower(address)); got != address {
+			t.Errorf("ChecksumAddress = %s, want %s", got, address)
+		}
+	}
+}
+
+type mapResolver map[string]string
+
+func (resolver mapResolver) Resolve(name string) (string, error) {
+	return resolver[name], nil
+}
+
+func TestEnginePreviewDedupesAddressSpellings(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), ENSResolver: mapResolver{"dalle.eth": "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	checksummed, err := engine.Preview(GenerateRequest{Input: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	lower, err := engine.Preview(GenerateRequest{Input: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if checksummed.Metadata.ImageID != lower.Metadata.ImageID || checksummed.MetadataPath != lower.MetadataPath {
+		t.Fatalf("address spellings produced two images")
+	}
+	info := checksummed.Metadata.InputInfo
+	if info == nil || info.Kind != InputKindAddress || info.Canonical != lower.Metadata.Input || info.Original == "" {
+		t.Fatalf("unexpected input info: %#v", info)
+	}
+	ens, err := engine.Preview(GenerateRequest{Input: "Dalle.eth", InputKind: InputKindENS, Force: true})
+	if err != nil {
+		t.Fatalf("Preview ENS: %v", err)
+	}
+	if ens.Metadata.Seed != lower.Metadata.Seed || ens.Metadata.InputInfo.ENSName != "dalle.eth" {
+		t.Fatalf("ENS input should seed from its address: %#v", ens.Metadata.InputInfo)
+	}
+}
+
+func TestEngineRegenerateImageKeepsLegacyInputs(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	input := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	result, err := engine.Generate(GenerateRequest{Input: input, InputKind: InputKindText, Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	legacy := result.Metadata
+	legacy.InputInfo = nil
+	if _, err := WriteImageMetadata(engine.DataDir(), legacy); err != nil {
+		t.Fatalf("WriteImageMetadata: %v", err)
+	}
+	regenerated, err := engine.RegenerateImage(legacy.ImageID)
+	if err != nil {
+		t.Fatalf("RegenerateImage: %v", err)
+	}
+	if regenerated.Metadata.Input != input || regenerated.Seed != result.Seed {
+		t.Fatalf("expected the legacy input regenerated verbatim, got %q seeded %s", regenerated.Metadata.Input, regenerated.Seed)
+	}
+}
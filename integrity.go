@@ -0,0 +1,183 @@
+package dalle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ArtifactStatusOK         = "ok"
+	ArtifactStatusChanged    = "changed"
+	ArtifactStatusMissing    = "missing"
+	ArtifactStatusEmpty      = "empty"
+	ArtifactStatusUnrecorded = "unrecorded"
+)
+
+// VerifyImagesFilter selects the records VerifyImages checks. With
+// MarkIncomplete, damaged records are marked incomplete so that the next
+// generate or import run makes them again.
+type VerifyImagesFilter struct {
+	Series         string `json:"series,omitempty"`
+	MarkIncomplete bool   `json:"markIncomplete,omitempty"`
+}
+
+// ArtifactIntegrity compares one artifact with what its record says.
+type ArtifactIntegrity struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Status   string        `json:"status"`
+	Recorded *ArtifactInfo `json:"recorded,omitempty"`
+	Actual   *ArtifactInfo `json:"actual,omitempty"`
+}
+
+// ImageIntegrity lists the artifacts of one damaged record.
+type ImageIntegrity struct {
+	ImageID   string              `json:"imageId"`
+	Series    string              `json:"series"`
+	Path      string              `json:"path"`
+	Artifacts []ArtifactIntegrity `json:"artifacts"`
+	Marked    bool                `json:"marked,omitempty"`
+}
+
+// IntegrityReport summarizes a VerifyImages run. Images lists only the
+// damaged records. Unrecorded counts artifacts written before sizes and
+// hashes were recorded; they are not treated as damage.
+type IntegrityReport struct {
+	Checked    int              `json:"checked"`
+	Intact     int              `json:"intact"`
+	Damaged    int              `json:"damaged"`
+	Unrecorded int              `json:"unrecorded"`
+	Marked     int              `json:"marked"`
+	Images     []ImageIntegrity `json:"images"`
+}
+
+// VerifyImages re-hashes the artifacts of every matching record and reports
+// those that are missing, empty or changed since the record was written.
+func (engine *Engine) VerifyImages(filter VerifyImagesFilter) (IntegrityReport, error) {
+	if engine == nil {
+		return IntegrityReport{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	records, err := engine.ListImages(ImageFilter{Series: strings.TrimSpace(filter.Series)})
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	report := IntegrityReport{Images: []ImageIntegrity{}}
+	for _, record := range records {
+		report.Checked++
+		checked := ImageIntegrity{
+			ImageID:   record.Metadata.ImageID,
+			Series:    record.Metadata.Series.Name,
+			Path:      record.Path,
+			Artifacts: []ArtifactIntegrity{},
+		}
+		damaged := false
+		for _, artifact := range record.Metadata.Artifacts.Named() {
+			check, err := checkArtifact(artifact, record.Metadata.Artifacts.Info)
+			if err != nil {
+				return IntegrityReport{}, err
+			}
+			switch check.Status {
+			case ArtifactStatusOK:
+			case ArtifactStatusUnrecorded:
+				report.Unrecorded++
+			default:
+				damaged = true
+			}
+			checked.Artifacts = append(checked.Artifacts, check)
+		}
+		if !damaged {
+			report.Intact++
+			continue
+		}
+		report.Damaged++
+		if filter.MarkIncomplete && record.Metadata.Status.Completed {
+			metadata := record.Metadata
+			metadata.Status.Completed = false
+			if _, err := WriteImageMetadata(engine.dataDir, metadata); err != nil {
+				return IntegrityReport{}, err
+			}
+			checked.Marked = true
+			report.Marked++
+		}
+		report.Images = append(report.Images, checked)
+	}
+	return report, nil
+}
+
+func checkArtifact(artifact NamedArtifact, info map[string]ArtifactInfo) (ArtifactIntegrity, error) {
+	check := ArtifactIntegrity{Name: artifact.Name, Path: artifact.Path}
+	if recorded, ok := info[artifact.Name]; ok {
+		check.Recorded = &recorded
+	}
+	actual, err := describeArtifact(artifact.Path)
+	switch {
+	case os.IsNotExist(err):
+		check.Status = ArtifactStatusMissing
+		return check, nil
+	case err != nil:
+		return ArtifactIntegrity{}, WrapError(ErrArtifactMissing, "read "+artifact.Name+" artifact", err)
+	}
+	check.Actual = &actual
+	switch {
+	case actual.Size == 0:
+		// Zero-byte files are download failures or placeholders written
+		// without a provider key; neither is a usable image.
+		check.Status = ArtifactStatusEmpty
+	case check.Recorded == nil:
+		check.Status = ArtifactStatusUnrecorded
+	case actual.Size != check.Recorded.Size || actual.SHA256 != check.Recorded.SHA256:
+		check.Status = ArtifactStatusChanged
+	default:
+		check.Status = ArtifactStatusOK
+	}
+	return check, nil
+}
+
+// describeArtifacts describes every artifact in set that exists.
+func describeArtifacts(set ArtifactSet) (map[string]ArtifactInfo, error) {
+	info := map[string]ArtifactInfo{}
+	for _, artifact := range set.Named() {
+		described, err := describeArtifact(artifact.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, WrapError(ErrArtifactMissing, "read "+artifact.Name+" artifact", err)
+		}
+		info[artifact.Name] = described
+	}
+	if len(info) == 0 {
+		return nil, nil
+	}
+	return info, nil
+}
+
+// describeArtifact hashes a file and reads its dimensions when it is an
+// image. Files that do not decode get no dimensions.
+func describeArtifact(path string) (ArtifactInfo, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return ArtifactInfo{}, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return ArtifactInfo{}, err
+	}
+	info := ArtifactInfo{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return ArtifactInfo{}, err
+	}
+	if config, _, err := image.DecodeConfig(file); err == nil {
+		info.Width, info.Height = config.Width, config.Height
+	}
+	return info, nil
+}
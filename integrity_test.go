@@ -0,0 +1,106 @@
+package dalle
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestEngineGenerateRecordsArtifactInfo(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, artifact := range result.Metadata.Artifacts.Named() {
+		info, ok := result.Metadata.Artifacts.Info[artifact.Name]
+		if !ok || info.Width != 32 || info.Height != 32 {
+			t.Fatalf("%s: unexpected info %+v", artifact.Name, info)
+		}
+		sum, size, err := fileSHA256(artifact.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.SHA256 != sum || info.Size != size {
+			t.Fatalf("%s: recorded %+v, file has %s (%d bytes)", artifact.Name, info, sum, size)
+		}
+	}
+}
+
+func TestEngineVerifyImagesFindsDamage(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	requests := 0
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		requests++
+		return annotatedMidTones(request)
+	}
+	request := GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true}
+	damaged, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	legacy, err := engine.Generate(GenerateRequest{Input: "legacy", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	report, err := engine.VerifyImages(VerifyImagesFilter{})
+	if err != nil {
+		t.Fatalf("VerifyImages: %v", err)
+	}
+	if report.Checked != 2 || report.Intact != 2 || report.Damaged != 0 || len(report.Images) != 0 {
+		t.Fatalf("unexpected report for intact images: %+v", report)
+	}
+
+	contents, err := os.ReadFile(damaged.GeneratedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(damaged.GeneratedPath, contents[:len(contents)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(damaged.AnnotatedPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Records written before artifact info existed are reported but intact.
+	record, err := engine.GetImage(legacy.Metadata.ImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Metadata.Artifacts.Info = nil
+	encoded, _ := json.MarshalIndent(record.Metadata, "", "  ")
+	if err := os.WriteFile(record.Path, encoded, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = engine.VerifyImages(VerifyImagesFilter{MarkIncomplete: true})
+	if err != nil {
+		t.Fatalf("VerifyImages: %v", err)
+	}
+	if report.Damaged != 1 || report.Intact != 1 || report.Unrecorded != 1 || report.Marked != 1 || len(report.Images) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	image := report.Images[0]
+	if image.ImageID != damaged.Metadata.ImageID || !image.Marked ||
+		image.Artifacts[0].Status != ArtifactStatusChanged || image.Artifacts[1].Status != ArtifactStatusEmpty {
+		t.Fatalf("unexpected damaged image: %+v", image)
+	}
+
+	before := requests
+	again, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if again.Metadata.Status.CacheHit || requests != before+1 || !again.Metadata.Status.Completed {
+		t.Fatalf("expected the marked record to be generated again")
+	}
+	if report, err = engine.VerifyImages(VerifyImagesFilter{}); err != nil || report.Damaged != 0 {
+		t.Fatalf("expected regeneration to repair the record: %+v, %v", report, err)
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/image"
 )
 
 const (
@@ -19,18 +22,27 @@ const (
 )
 
 type ImageMetadata struct {
-	MetadataVersion string           `json:"metadataVersion"`
-	ImageID         string           `json:"imageId"`
-	Input           string           `json:"input"`
-	Seed            string           `json:"seed"`
-	Series          MetadataSeries   `json:"series"`
-	Recipe          MetadataRecipe   `json:"recipe"`
-	Database        MetadataDatabase `json:"database"`
-	SelectedRecords []SelectedRecord `json:"selectedRecords"`
-	Prompts         PromptSet        `json:"prompts"`
-	Artifacts       ArtifactSet      `json:"artifacts"`
-	Stages          PipelineStages   `json:"stages"`
-	Status          MetadataStatus   `json:"status"`
+	MetadataVersion string              `json:"metadataVersion"`
+	ImageID         string              `json:"imageId"`
+	Input           string              `json:"input"`
+	InputInfo       *MetadataInput      `json:"inputInfo,omitempty"`
+	Seed            string              `json:"seed"`
+	Series          MetadataSeries      `json:"series"`
+	Recipe          MetadataRecipe      `json:"recipe"`
+	Database        MetadataDatabase    `json:"database"`
+	Overrides       map[string]string   `json:"overrides,omitempty"`
+	Reseeds         map[string]int      `json:"reseeds,omitempty"`
+	SelectedRecords []SelectedRecord    `json:"selectedRecords"`
+	Prompts         PromptSet           `json:"prompts"`
+	Artifacts       ArtifactSet         `json:"artifacts"`
+	Payload         *image.Payload      `json:"payload,omitempty"`
+	PerceptualHash  *PerceptualHash     `json:"perceptualHash,omitempty"`
+	Palette         *MetadataPalette    `json:"palette,omitempty"`
+	CIDs            map[string]string   `json:"cids,omitempty"`
+	Annotation      *MetadataAnnotation `json:"annotation,omitempty"`
+	Lineage         *MetadataLineage    `json:"lineage,omitempty"`
+	Stages          PipelineStages      `json:"stages"`
+	Status          MetadataStatus      `json:"status"`
 }
 
 type MetadataSeries struct {
@@ -39,9 +51,26 @@ type MetadataSeries struct {
 	Source string `json:"source"`
 }
 
+// MetadataRecipe names the prompt recipe and the seed scheme that turned the
+// input into attribute selections. An empty seed scheme is the default
+// (sha256, version 1), which predates the field.
 type MetadataRecipe struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+	Name              string `json:"name"`
+	Version           string `json:"version"`
+	SeedScheme        string `json:"seedScheme,omitempty"`
+	SeedSchemeVersion string `json:"seedSchemeVersion,omitempty"`
+}
+
+// SeedSchemeReference returns the recorded seed scheme as "name@version".
+func (recipe MetadataRecipe) SeedSchemeReference() string {
+	name, version := recipe.SeedScheme, recipe.SeedSchemeVersion
+	if name == "" {
+		name = DefaultSeedScheme
+	}
+	if version == "" {
+		version = DefaultSeedSchemeVersion
+	}
+	return name + "@" + version
 }
 
 type MetadataDatabase struct {
@@ -50,10 +79,31 @@ type MetadataDatabase struct {
 }
 
 type SelectedRecord struct {
-	Attribute string `json:"attribute"`
-	Database  string `json:"database"`
-	RowIndex  int    `json:"rowIndex"`
-	Record    string `json:"record"`
+	Attribute  string `json:"attribute"`
+	Database   string `json:"database"`
+	RowIndex   int    `json:"rowIndex"`
+	Record     string `json:"record"`
+	Overridden bool   `json:"overridden,omitempty"`
+}
+
+// MetadataAnnotation records the settings the annotated artifact was drawn with.
+type MetadataAnnotation struct {
+	Font       annotate.FontOptions `json:"font"`
+	Layout     string               `json:"layout,omitempty"`
+	Title      bool                 `json:"title,omitempty"`
+	BandColors string               `json:"bandColors,omitempty"`
+	Colors     *annotate.Colors     `json:"colors,omitempty"`
+	Badge      *MetadataBadge       `json:"badge,omitempty"`
+}
+
+// MetadataLineage links a derived image back to the image it was made from,
+// or to the storyboard it is a panel of.
+type MetadataLineage struct {
+	ParentImageID string `json:"parentImageId,omitempty"`
+	Attribute     string `json:"attribute,omitempty"`
+	Variation     string `json:"variation,omitempty"`
+	StoryboardID  string `json:"storyboardId,omitempty"`
+	Panel         int    `json:"panel,omitempty"`
 }
 
 type PromptSet struct {
@@ -67,6 +117,47 @@ type PromptSet struct {
 type ArtifactSet struct {
 	Generated string `json:"generated,omitempty"`
 	Annotated string `json:"annotated,omitempty"`
+	// Variants are the derived web sizes (see VariantSpec), in the order
+	// they are configured.
+	Variants []NamedArtifact `json:"variants,omitempty"`
+	// Info describes each artifact, by name, as it was when the record was
+	// written, so that later damage can be detected.
+	Info map[string]ArtifactInfo `json:"info,omitempty"`
+}
+
+const (
+	ArtifactGenerated = "generated"
+	ArtifactAnnotated = "annotated"
+)
+
+// ArtifactInfo is the size, SHA-256 and, for images that decode, the pixel
+// dimensions of an artifact.
+type ArtifactInfo struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// NamedArtifact is an artifact path with its name in ArtifactSet.Info.
+type NamedArtifact struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Named lists the artifacts that have a path: generated, annotated, then
+// the variants.
+func (set ArtifactSet) Named() []NamedArtifact {
+	named := []NamedArtifact{}
+	for _, artifact := range append([]NamedArtifact{
+		{ArtifactGenerated, set.Generated},
+		{ArtifactAnnotated, set.Annotated},
+	}, set.Variants...) {
+		if strings.TrimSpace(artifact.Path) != "" {
+			named = append(named, artifact)
+		}
+	}
+	return named
 }
 
 type PipelineStages struct {
@@ -117,7 +208,7 @@ func NewImageMetadata(input, seed, series string) ImageMetadata {
 }
 
 func ComputeImageID(metadata ImageMetadata) string {
-	hashInput := strings.Join([]string{
+	parts := []string{
 		metadata.Input,
 		metadata.Seed,
 		metadata.Series.Name,
@@ -126,11 +217,48 @@ func ComputeImageID(metadata ImageMetadata) string {
 		metadata.Recipe.Version,
 		metadata.Database.Version,
 		metadata.Database.ArchiveHash,
-	}, "\x00")
-	digest := sha256.Sum256([]byte(hashInput))
+	}
+	// Pinned or reseeded attributes and non-default seed schemes are appended
+	// only when present so that existing images keep the IDs they were minted
+	// with.
+	if len(metadata.Overrides) > 0 {
+		parts = append(parts, canonicalOverrides(metadata.Overrides))
+	}
+	if len(metadata.Reseeds) > 0 {
+		parts = append(parts, "reseeds="+canonicalReseeds(metadata.Reseeds))
+	}
+	if !isDefaultSeedScheme(metadata.Recipe.SeedScheme, metadata.Recipe.SeedSchemeVersion) {
+		parts = append(parts, "seedScheme="+metadata.Recipe.SeedSchemeReference())
+	}
+	digest := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
 	return "sha256:" + hex.EncodeToString(digest[:])
 }
 
+// variantSuffix is appended to the seed in metadata and artifact file names.
+// It is empty for ordinary images; pinned or reseeded images, and images from
+// a seed scheme other than the default, get a short digest so they never
+// overwrite the ordinary result at the same seed.
+func variantSuffix(metadata ImageMetadata) string {
+	key := canonicalOverrides(metadata.Overrides)
+	if len(metadata.Reseeds) > 0 {
+		key = "reseeds=" + canonicalReseeds(metadata.Reseeds) + "\x1f" + key
+	}
+	if !isDefaultSeedScheme(metadata.Recipe.SeedScheme, metadata.Recipe.SeedSchemeVersion) {
+		key = "seedScheme=" + metadata.Recipe.SeedSchemeReference() + "\x1f" + key
+	}
+	if key == "" {
+		return ""
+	}
+	digest := sha256.Sum256([]byte(key))
+	return "-" + hex.EncodeToString(digest[:])[:12]
+}
+
+// derivedImage reports whether an image replaced any of its seed's picks,
+// either pinned by the user or reseeded by the engine.
+func derivedImage(metadata ImageMetadata) bool {
+	return len(metadata.Overrides) > 0 || len(metadata.Reseeds) > 0
+}
+
 func MetadataPath(dataDir, series, seed string) (string, error) {
 	if strings.TrimSpace(series) == "" {
 		return "", NewError(ErrInvalidInput, "series is required")
@@ -141,6 +269,19 @@ func MetadataPath(dataDir, series, seed string) (string, error) {
 	return filepath.Join(dataDir, "output", safePathPart(series), "metadata", safePathPart(seed)+".json"), nil
 }
 
+// MetadataPathFor returns the sidecar path for a metadata record, taking any
+// attribute overrides into account.
+func MetadataPathFor(dataDir string, metadata ImageMetadata) (string, error) {
+	path, err := MetadataPath(dataDir, metadata.Series.Name, metadata.Seed)
+	if err != nil {
+		return "", err
+	}
+	if suffix := variantSuffix(metadata); suffix != "" {
+		path = strings.TrimSuffix(path, ".json") + suffix + ".json"
+	}
+	return path, nil
+}
+
 func ReadImageMetadata(path string) (ImageMetadata, error) {
 	contents, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
@@ -172,7 +313,7 @@ func WriteImageMetadata(dataDir string, metadata ImageMetadata) (string, error)
 	if err := ValidateImageMetadata(metadata); err != nil {
 		return "", err
 	}
-	path, err := MetadataPath(dataDir, metadata.Series.Name, metadata.Seed)
+	path, err := MetadataPathFor(dataDir, metadata)
 	if err != nil {
 		return "", err
 	}
@@ -285,6 +426,9 @@ func CheckRegenerationCompatibility(metadata ImageMetadata, databaseVersion, arc
 	if metadata.Database.ArchiveHash != "" && metadata.Database.ArchiveHash != archiveHash {
 		return WrapError(ErrRegenerationRefused, "database archive hash differs", NewError(ErrDatabaseHashMismatch, fmt.Sprintf("metadata uses %s; current archive is %s", metadata.Database.ArchiveHash, archiveHash)))
 	}
+	if _, err := LookupSeedScheme(metadata.Recipe.SeedSchemeReference()); err != nil {
+		return WrapError(ErrRegenerationRefused, "seed scheme unavailable", err)
+	}
 	return nil
 }
 
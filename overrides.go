@@ -0,0 +1,150 @@
+package dalle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/model"
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/prompt"
+)
+
+// NormalizeOverrides validates attribute names in an override map and returns a
+// copy keyed by canonical attribute name (for example "artstyle1" becomes
+// "artStyle1") with trimmed values. Values are not checked against the
+// databases here; that happens once the series filters are loaded.
+func NormalizeOverrides(overrides map[string]string) (map[string]string, error) {
+	if len(overrides) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]string, len(overrides))
+	for name, value := range overrides {
+		canonical, ok := canonicalAttributeName(name)
+		if !ok {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown override attribute %q", name))
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("override for %s is empty", canonical))
+		}
+		if _, dup := normalized[canonical]; dup {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("duplicate override for %s", canonical))
+		}
+		normalized[canonical] = value
+	}
+	return normalized, nil
+}
+
+func canonicalAttributeName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for _, candidate := range prompt.AttributeNames() {
+		if strings.EqualFold(candidate, name) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// canonicalOverrides renders overrides as a stable "name=value" list so that
+// equal maps always hash and cache to the same key.
+func canonicalOverrides(overrides map[string]string) string {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+overrides[name])
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+// canonicalReseeds renders reseeded rows the same way as canonicalOverrides.
+func canonicalReseeds(reseeds map[string]int) string {
+	values := make(map[string]string, len(reseeds))
+	for name, row := range reseeds {
+		values[name] = strconv.Itoa(row)
+	}
+	return canonicalOverrides(values)
+}
+
+// applyOverrides replaces seed-selected attributes with pinned database rows.
+// An override value is either a row index into the series-filtered database or
+// a record key (the first CSV column, compared case-insensitively).
+func (ctx *Context) applyOverrides(dd *model.DalleDress, overrides map[string]string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	for i, attr := range dd.Attribs {
+		value, ok := overrides[attr.Name]
+		if !ok {
+			continue
+		}
+		row, err := resolveOverrideRow(ctx.Databases[attr.Database], attr.Database, value)
+		if err != nil {
+			return WrapError(ErrInvalidInput, "override "+attr.Name, err)
+		}
+		attr.Overridden = true
+		ctx.selectRow(dd, i, attr, row)
+	}
+	for name := range overrides {
+		if !dd.AttribMap[name].Overridden {
+			return NewError(ErrInvalidInput, fmt.Sprintf("override attribute %s was not selected from this seed", name))
+		}
+	}
+	return nil
+}
+
+// applyReseeds replaces seed-selected attributes with rows the engine picked
+// (see GenerateRequest.reseeds). Attributes the user pinned keep their
+// override, and reseeded ones are not marked Overridden.
+func (ctx *Context) applyReseeds(dd *model.DalleDress, reseeds map[string]int) error {
+	for name := range reseeds {
+		if _, ok := dd.AttribMap[name]; !ok {
+			return NewError(ErrInvalidInput, fmt.Sprintf("reseeded attribute %s was not selected from this seed", name))
+		}
+	}
+	for i, attr := range dd.Attribs {
+		row, ok := reseeds[attr.Name]
+		if !ok || attr.Overridden {
+			continue
+		}
+		if size := len(ctx.Databases[attr.Database]); row < 0 || row >= size {
+			return NewError(ErrInvalidInput, fmt.Sprintf("reseeded row %d is outside the filtered %s database (0-%d)", row, attr.Database, size-1))
+		}
+		ctx.selectRow(dd, i, attr, row)
+	}
+	return nil
+}
+
+// selectRow stores attr, moved to the given database row, at index i of the
+// dress.
+func (ctx *Context) selectRow(dd *model.DalleDress, i int, attr prompt.Attribute, row int) {
+	attr.Selector = uint64(row)
+	attr.Value = ctx.Databases[attr.Database][row]
+	dd.Attribs[i] = attr
+	dd.AttribMap[attr.Name] = attr
+	dd.SeedChunks[i] = attr.Value
+	dd.SelectedRecords[i] = attr.Value
+}
+
+func resolveOverrideRow(lines []string, database, value string) (int, error) {
+	if len(lines) == 0 {
+		return 0, fmt.Errorf("database %s is empty", database)
+	}
+	if index, err := strconv.Atoi(value); err == nil {
+		if index < 0 || index >= len(lines) {
+			return 0, fmt.Errorf("row %d is outside the filtered %s database (0-%d)", index, database, len(lines)-1)
+		}
+		return index, nil
+	}
+	for index, line := range lines {
+		key, _, _ := strings.Cut(line, ",")
+		if strings.EqualFold(strings.TrimSpace(key), value) {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("key %q is not in the filtered %s database", value, database)
+}
@@ -0,0 +1,101 @@
+package dalle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOverridesCanonicalizesNames(t *testing.T) {
+	got, err := NormalizeOverrides(map[string]string{"ARTSTYLE1": " cubism ", "noun": "octopus"})
+	if err != nil {
+		t.Fatalf("NormalizeOverrides: %v", err)
+	}
+	if got["artStyle1"] != "cubism" || got["noun"] != "octopus" || len(got) != 2 {
+		t.Fatalf("unexpected normalized overrides: %#v", got)
+	}
+	if _, err := NormalizeOverrides(map[string]string{"shoeSize": "9"}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected invalid input for unknown attribute, got %v", err)
+	}
+	if _, err := NormalizeOverrides(map[string]string{"noun": " "}); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected invalid input for empty value, got %v", err)
+	}
+}
+
+func TestEnginePreviewAppliesOverrides(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	nouns, err := engine.ListDatabaseRecords("nouns", 5)
+	if err != nil {
+		t.Fatalf("ListDatabaseRecords: %v", err)
+	}
+	key := nouns.Records[3].Key
+
+	base, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates"})
+	if err != nil {
+		t.Fatalf("Preview base: %v", err)
+	}
+	pinned, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates", Overrides: map[string]string{"Noun": strings.ToUpper(key), "emotion": "0"}})
+	if err != nil {
+		t.Fatalf("Preview pinned: %v", err)
+	}
+
+	if pinned.Metadata.Seed != base.Metadata.Seed {
+		t.Fatalf("overrides must not change the seed")
+	}
+	if pinned.Metadata.ImageID == base.Metadata.ImageID {
+		t.Fatalf("expected overrides to change the image ID")
+	}
+	if pinned.MetadataPath == base.MetadataPath {
+		t.Fatalf("pinned metadata would overwrite the unpinned result: %s", pinned.MetadataPath)
+	}
+	if pinned.Metadata.Overrides["noun"] != strings.ToUpper(key) {
+		t.Fatalf("expected overrides recorded in metadata: %#v", pinned.Metadata.Overrides)
+	}
+	for index, record := range pinned.Metadata.SelectedRecords {
+		baseRecord := base.Metadata.SelectedRecords[index]
+		switch record.Attribute {
+		case "noun":
+			if !record.Overridden || !strings.HasPrefix(record.Record, key+",") {
+				t.Fatalf("expected noun pinned to %s: %#v", key, record)
+			}
+		case "emotion":
+			if !record.Overridden || record.RowIndex != 0 {
+				t.Fatalf("expected emotion pinned to row 0: %#v", record)
+			}
+		default:
+			if record.Overridden || record.Record != baseRecord.Record {
+				t.Fatalf("unpinned attribute %s changed: %#v vs %#v", record.Attribute, record, baseRecord)
+			}
+		}
+	}
+	if !strings.Contains(pinned.Metadata.Prompts.Prompt, key) {
+		t.Fatalf("expected prompt to use the pinned noun %q", key)
+	}
+
+	again, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates"})
+	if err != nil {
+		t.Fatalf("Preview base again: %v", err)
+	}
+	if again.Metadata.ImageID != base.Metadata.ImageID || len(again.Metadata.Overrides) != 0 {
+		t.Fatalf("unpinned result was clobbered: %#v", again.Metadata)
+	}
+}
+
+func TestEnginePreviewRejectsInvalidOverrides(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, overrides := range []map[string]string{
+		{"noun": "definitely-not-a-noun"},
+		{"noun": "999999"},
+		{"hairstyle": "mohawk"},
+	} {
+		_, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates", Overrides: overrides})
+		if ErrorCodeOf(err) != ErrInvalidInput {
+			t.Fatalf("expected invalid input for %#v, got %v", overrides, err)
+		}
+	}
+}
@@ -4,114 +4,154 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/png"
-	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
-	"git.sr.ht/~sbinet/gg"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
-// Annotate reads an image and adds a text annotation to it either at the top
-// (location == "top") or the bottom (otherwise). The annotation is placed on
-// an appropriately colored background and rendered in a text color that
-// ensures good contrast and readability.
-func Annotate(text, fileName, location string, annoPct float64) (ret string, err error) {
-	cleanName := filepath.Clean(fileName)
-	if !strings.Contains(cleanName, string(os.PathSeparator)+"generated"+string(os.PathSeparator)) && !strings.HasSuffix(cleanName, string(os.PathSeparator)+"generated"+string(os.PathSeparator)+filepath.Base(cleanName)) {
-		return "", fmt.Errorf("invalid image path: %s", fileName)
+// defaultBandPct is the largest share of the image height the annotation band
+// may take when the caller does not say.
+const defaultBandPct = 0.2
+
+// Options configures an annotation. Caption is the main text and Title, when
+// set, is drawn as a separate block above it. Layout is one of Layouts (empty
+// is the bottom band) and BandPct caps the share of the image height the text
+// may take (default 0.2). Contrast is the WCAG level the text must meet
+// against the band (AA by default) and Palette, when set, lists the hex
+// colors the band color is chosen from (see ChooseColors). FontDir is where
+// user font files named by Font are looked up, normally the fonts directory
+// inside the data dir.
+type Options struct {
+	Caption  string
+	Title    string
+	Layout   string
+	BandPct  float64
+	Contrast string
+	Palette  []string
+	Font     FontOptions
+	FontDir  string
+}
+
+// AnnotateImage draws the title and caption of options onto img in the
+// selected layout and returns the new image; img is not modified. The colors
+// it draws with are those ChooseColors returns for the same img and options.
+func AnnotateImage(img image.Image, options Options) (image.Image, error) {
+	if err := ValidateLayout(options.Layout); err != nil {
+		return nil, err
+	}
+	annoPct := options.BandPct
+	if annoPct <= 0 || annoPct > 1 {
+		annoPct = defaultBandPct
 	}
-	file, err := os.Open(cleanName) // #nosec G304 - validated
+	colors, err := ChooseColors(img, options)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer func() { _ = file.Close() }()
+	col, _ := parseHexColor(colors.Band)
+	textColor, _ := parseHexColor(colors.Text)
+	switch options.Layout {
+	case LayoutOverlay:
+		return renderOverlay(img, annoPct, options, col, textColor)
+	case LayoutSidePanel:
+		return renderSidePanel(img, options, col, textColor)
+	case LayoutPolaroid:
+		return renderPolaroid(img, annoPct, options, col, textColor)
+	case LayoutCard:
+		return renderCard(img, annoPct, options, col, textColor)
+	default:
+		return renderBand(img, options.Layout == LayoutTopBand, annoPct, options, col, textColor)
+	}
+}
 
-	img, _, err := image.Decode(file)
+// AnnotateFile annotates the image at inPath and writes the result to outPath
+// as a PNG, creating its directory. The colors it draws with are those
+// FileColors returns for inPath. The paths are used as given: callers that
+// take them from untrusted input must confine them first.
+func AnnotateFile(inPath, outPath string, options Options) error {
+	img, err := decodeFile(inPath)
 	if err != nil {
-		return "", err
+		return err
 	}
-	width := img.Bounds().Dx()
-	height := img.Bounds().Dy()
-	lenText := len(text)
-	estimatedFontSize := 30. * (float64(width) / float64(lenText*7.))
-	textWidth := float64(width) * 0.95
-	lines := math.Ceil(float64(lenText) / (textWidth / estimatedFontSize))
-	marginHeight := float64(height) * 0.025
-	annoHeight := lines * estimatedFontSize * 1.5
-	newHeight := height + int(annoHeight+marginHeight*2)
-
-	newImg := image.NewRGBA(image.Rect(0, 0, width, newHeight))
-	draw.Draw(newImg, newImg.Bounds(), img, img.Bounds().Min, draw.Src)
-
-	bgColor, _ := findAverageDominantColor(img)
-	col, err := parseHexColor(bgColor)
+	annotated, err := AnnotateImage(img, options)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	bgRect := image.Rect(0, height, width, newHeight)
-	if location == "top" {
-		bgRect = image.Rect(0, 0, width, int(annoHeight+marginHeight*2))
-		draw.Draw(newImg, bgRect, &image.Uniform{col}, image.Point{}, draw.Src)
-	} else {
-		draw.Draw(newImg, bgRect, &image.Uniform{col}, image.Point{}, draw.Src)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o750); err != nil {
+		return err
 	}
-
-	gc := gg.NewContextForImage(newImg)
-
-	fontPaths := []string{
-		"/usr/share/fonts/truetype/dejavu/DejaVuSansMono.ttf", // Linux
-		"/System/Library/Fonts/Monaco.ttf",                    // macOS
-	}
-	var fontErr error
-	for _, fontPath := range fontPaths {
-		if err := gc.LoadFontFace(fontPath, estimatedFontSize); err == nil {
-			fontErr = nil
-			break
-		} else {
-			fontErr = err
-		}
-	}
-	if fontErr != nil {
-		return "", fmt.Errorf("load font: %w", fontErr)
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) // #nosec G304 - the caller owns path safety
+	if err != nil {
+		return err
 	}
-	borderCol := darkenColor(col)
-	gc.SetColor(borderCol)
-	gc.SetLineWidth(2)
-	if location == "top" {
-		gc.DrawLine(0, float64(height)*annoPct, float64(width), float64(height)*annoPct)
-	} else {
-		gc.DrawLine(0, float64(height), float64(width), float64(height))
+	if err := png.Encode(out, annotated); err != nil {
+		_ = out.Close()
+		return err
 	}
-	gc.Stroke()
+	return out.Close()
+}
 
-	textColor, _ := contrastColor(col)
-	gc.SetColor(textColor)
-	gc.DrawStringWrapped(text, float64(width)/2, float64(height)+marginHeight*2, 0.5, 0.35, textWidth, 1.5, gg.AlignLeft)
+// FileColors is ChooseColors for the image at path, the colors AnnotateFile
+// draws that image with.
+func FileColors(path string, options Options) (Colors, error) {
+	img, err := decodeFile(path)
+	if err != nil {
+		return Colors{}, err
+	}
+	return ChooseColors(img, options)
+}
 
-	outputPath := strings.ReplaceAll(fileName, "generated/", "annotated/")
-	outputPath = filepath.Clean(outputPath)
-	if !strings.Contains(outputPath, string(os.PathSeparator)+"annotated"+string(os.PathSeparator)) {
-		return "", fmt.Errorf("invalid output path: %s", outputPath)
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path) // #nosec G304 - the caller owns path safety
+	if err != nil {
+		return nil, err
 	}
-	out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	defer func() { _ = file.Close() }()
+
+	img, _, err := image.Decode(file)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("decode %s: %w", filepath.Base(path), err)
 	}
-	defer func() { _ = out.Close() }()
+	return img, nil
+}
+
+// Annotate reads an image and adds a text annotation to it either at the top
+// (location == "top") or the bottom (otherwise). The annotation is placed on
+// an appropriately colored background and rendered in a text color that
+// ensures good contrast and readability. The result is written to
+// AnnotatedPath(fileName).
+func Annotate(text, fileName, location string, annoPct float64) (ret string, err error) {
+	return AnnotateWithOptions(text, fileName, location, annoPct, Options{})
+}
 
-	if err = png.Encode(out, gc.Image()); err != nil {
+// AnnotateWithOptions is Annotate with configurable options. Prefer
+// AnnotateFile, which lets the caller choose the output path.
+func AnnotateWithOptions(text, fileName, location string, annoPct float64, options Options) (ret string, err error) {
+	outputPath := AnnotatedPath(fileName)
+	options.Caption = text
+	options.BandPct = annoPct
+	if options.Layout == "" && location == "top" {
+		options.Layout = LayoutTopBand
+	}
+	if err := AnnotateFile(fileName, outputPath, options); err != nil {
 		return "", err
 	}
 	return outputPath, nil
 }
 
+// AnnotatedPath is the file of the same name as imagePath in the "annotated"
+// sibling of its folder, which for an image in a series' "generated" folder
+// is the series' "annotated" folder.
+func AnnotatedPath(imagePath string) string {
+	dir, name := filepath.Split(filepath.Clean(imagePath))
+	return filepath.Join(filepath.Dir(filepath.Clean(dir)), "annotated", name)
+}
+
 func darkenColor(c color.Color) color.Color {
 	r, g, b, a := c.RGBA()
 	factor := 0.9
@@ -146,7 +186,12 @@ func findAverageDominantColor(img image.Image) (string, error) {
 	for k, v := range colorFrequency {
 		ss = append(ss, kv{k, v})
 	}
-	sort.Slice(ss, func(i, j int) bool { return ss[i].Value > ss[j].Value })
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Value != ss[j].Value {
+			return ss[i].Value > ss[j].Value
+		}
+		return ss[i].Key.Hex() < ss[j].Key.Hex()
+	})
 	topColors := make([]colorful.Color, 0, 3)
 	for i := 0; i < len(ss) && i < 3; i++ {
 		topColors = append(topColors, ss[i].Key)
@@ -162,18 +207,3 @@ func findAverageDominantColor(img image.Image) (string, error) {
 	avgColor := colorful.Color{R: r / count / 255, G: g / count / 255, B: b / count / 255}
 	return avgColor.Hex(), nil
 }
-
-func contrastColor(cIn color.Color) (color.Color, float64) {
-	c, _ := colorful.MakeColor(cIn)
-	_, _, l := c.Hcl()
-	white := colorful.Color{R: 1, G: 1, B: 1}
-	black := colorful.Color{R: 0, G: 0, B: 0}
-	var contrast colorful.Color
-	if l < 0.5 {
-		contrast = white
-	} else {
-		contrast = black
-	}
-	r, g, b := contrast.RGB255()
-	return color.RGBA{R: r, G: g, B: b, A: 255}, l
-}
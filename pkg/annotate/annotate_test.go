@@ -1,9 +1,14 @@
 package annotate
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -32,14 +37,6 @@ func TestDarkenColor(t *testing.T) {
 	}
 }
 
-func TestContrastColor(t *testing.T) {
-	c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
-	contrast, _ := contrastColor(c)
-	if _, ok := contrast.(color.RGBA); !ok {
-		t.Error("expected color.RGBA")
-	}
-}
-
 func TestFindAverageDominantColor(t *testing.T) {
 	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
 	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{R: 10, G: 20, B: 30, A: 255}}, image.Point{}, draw.Src)
@@ -51,3 +48,64 @@ func TestFindAverageDominantColor(t *testing.T) {
 		t.Errorf("invalid hex: %s", hex)
 	}
 }
+
+func TestAnnotateFileUsesExplicitPaths(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "imports", "source.png")
+	out := filepath.Join(dir, "exports", "nested", "captioned.png")
+	if err := os.MkdirAll(filepath.Dir(in), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, goldenSource()); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	if err := AnnotateFile(in, out, Options{Caption: "a cheerful octopus", Font: FontOptions{Family: FamilyGo}}); err != nil {
+		t.Fatalf("AnnotateFile: %v", err)
+	}
+	written, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("annotated image missing: %v", err)
+	}
+	defer written.Close()
+	decoded, err := png.Decode(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds().Dx() != 320 || decoded.Bounds().Dy() <= 200 {
+		t.Fatalf("unexpected annotated size %v", decoded.Bounds())
+	}
+}
+
+func TestAnnotateImageLeavesSourceUntouched(t *testing.T) {
+	source := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(source, source.Bounds(), &image.Uniform{color.RGBA{R: 200, G: 40, B: 40, A: 255}}, image.Point{}, draw.Src)
+	before := append([]uint8(nil), source.Pix...)
+	if _, err := AnnotateImage(source, Options{Caption: "overlay text", Layout: LayoutOverlay, Font: FontOptions{Family: FamilyGo}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, source.Pix) {
+		t.Fatal("AnnotateImage modified its input")
+	}
+}
+
+func TestAnnotatedPath(t *testing.T) {
+	if got := AnnotatedPath(filepath.Join("data", "output", "empty", "generated", "seed.png")); got != filepath.Join("data", "output", "empty", "annotated", "seed.png") {
+		t.Fatalf("AnnotatedPath = %q", got)
+	}
+	if got := AnnotatedPath(filepath.Join("data", "images", "seed.png")); got != filepath.Join("data", "annotated", "seed.png") {
+		t.Fatalf("AnnotatedPath = %q", got)
+	}
+}
+
+func TestAnnotateImageReportsFontErrorsOnce(t *testing.T) {
+	_, err := AnnotateImage(goldenSource(), Options{Caption: "text", Font: FontOptions{Family: "Missing"}, FontDir: t.TempDir()})
+	if err == nil || strings.Count(err.Error(), "load font") != 1 {
+		t.Fatalf("expected one load font error, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"git.sr.ht/~sbinet/gg"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	CornerTopLeft     = "top-left"
+	CornerTopRight    = "top-right"
+	CornerBottomLeft  = "bottom-left"
+	CornerBottomRight = "bottom-right"
+
+	defaultBadgeOpacity = 0.8
+	defaultBadgeScale   = 0.06
+)
+
+// Corners lists the corners a badge may be placed in.
+var Corners = []string{CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight}
+
+// BadgeOptions configures a badge: a rounded pill holding an optional logo
+// followed by a line of text. Corner defaults to bottom-right, Opacity (0-1)
+// to 0.8 and Scale, the badge height as a share of the image height, to 0.06.
+type BadgeOptions struct {
+	Text    string
+	Logo    image.Image
+	Corner  string
+	Opacity float64
+	Scale   float64
+	Font    FontOptions
+	FontDir string
+}
+
+// ValidateCorner reports a corner that is not one of Corners. Empty is the
+// bottom right.
+func ValidateCorner(corner string) error {
+	if corner == "" {
+		return nil
+	}
+	for _, known := range Corners {
+		if corner == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown badge corner %q (want one of %s)", corner, strings.Join(Corners, ", "))
+}
+
+// DrawBadge composites a badge onto a copy of img.
+func DrawBadge(img image.Image, options BadgeOptions) (image.Image, error) {
+	if err := ValidateCorner(options.Corner); err != nil {
+		return nil, err
+	}
+	opacity := options.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = defaultBadgeOpacity
+	}
+	scale := options.Scale
+	if scale <= 0 || scale > 0.5 {
+		scale = defaultBadgeScale
+	}
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+	if strings.TrimSpace(options.Text) == "" && options.Logo == nil {
+		return out, nil
+	}
+
+	height := math.Max(12, math.Round(float64(bounds.Dy())*scale))
+	padding := math.Round(height * 0.2)
+	inner := height - padding*2
+
+	logoWidth := 0.0
+	if options.Logo != nil {
+		logoBounds := options.Logo.Bounds()
+		logoWidth = math.Round(inner * float64(logoBounds.Dx()) / float64(max(1, logoBounds.Dy())))
+	}
+	hasText := strings.TrimSpace(options.Text) != ""
+	gap := 0.0
+	if logoWidth > 0 && hasText {
+		gap = padding
+	}
+	var text textLayout
+	textWidth := 0.0
+	if hasText {
+		font := options.Font
+		if font.Weight == "" {
+			font.Weight = WeightBold
+		}
+		parsed, err := loadFont(font, options.FontDir)
+		if err != nil {
+			return nil, fmt.Errorf("load font: %w", err)
+		}
+		// One line as large as the pill allows, shrunk or cut short with an
+		// ellipsis when it would be wider than most of the image.
+		available := float64(bounds.Dx())*0.9 - padding*2 - logoWidth - gap
+		text, err = layoutText(parsed, options.Text, available, inner, 4, inner, 1)
+		if err != nil {
+			return nil, err
+		}
+		gc := gg.NewContext(1, 1)
+		gc.SetFontFace(text.Face)
+		for _, line := range text.Lines {
+			lineWidth, _ := gc.MeasureString(line)
+			textWidth = math.Max(textWidth, lineWidth)
+		}
+	}
+	width := math.Ceil(padding*2 + logoWidth + gap + textWidth)
+
+	layer := gg.NewContext(int(width), int(height))
+	layer.SetRGBA(0, 0, 0, 0.6)
+	layer.DrawRoundedRectangle(0, 0, width, height, height/2.5)
+	layer.Fill()
+	if options.Logo != nil {
+		logo := image.NewRGBA(image.Rect(0, 0, int(logoWidth), int(inner)))
+		xdraw.CatmullRom.Scale(logo, logo.Bounds(), options.Logo, options.Logo.Bounds(), xdraw.Over, nil)
+		layer.DrawImage(logo, int(padding), int(padding))
+	}
+	if textWidth > 0 {
+		layer.SetColor(color.White)
+		drawLines(layer, text, padding+logoWidth+gap+textWidth/2, padding+(inner-text.Height)/2)
+	}
+
+	margin := math.Round(float64(bounds.Dy()) * 0.02)
+	x, y := margin, margin
+	switch options.Corner {
+	case CornerTopRight:
+		x = float64(bounds.Dx()) - margin - width
+	case CornerBottomLeft:
+		y = float64(bounds.Dy()) - margin - height
+	case CornerTopLeft:
+	default:
+		x = float64(bounds.Dx()) - margin - width
+		y = float64(bounds.Dy()) - margin - height
+	}
+	target := image.Rect(int(x), int(y), int(x)+int(width), int(y)+int(height))
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))})
+	draw.DrawMask(out, target, layer.Image(), image.Point{}, mask, image.Point{}, draw.Over)
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestDrawBadgeGolden(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			if (x-10)*(x-10)+(y-10)*(y-10) < 81 {
+				logo.Set(x, y, color.RGBA{R: 0xF5, G: 0xC5, B: 0x18, A: 0xFF})
+			}
+		}
+	}
+	got, err := DrawBadge(goldenSource(), BadgeOptions{
+		Text:    "#42 / 500",
+		Logo:    logo,
+		Corner:  CornerTopRight,
+		Opacity: 0.9,
+		Scale:   0.1,
+		Font:    FontOptions{Family: FamilyGo},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, filepath.Join("testdata", "badge-top-right.png"), got)
+}
+
+func TestDrawBadgeCorners(t *testing.T) {
+	source := goldenSource()
+	for _, corner := range Corners {
+		got, err := DrawBadge(source, BadgeOptions{Text: "edition", Corner: corner, Opacity: 1, Font: FontOptions{Family: FamilyGo}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Bounds() != source.Bounds() {
+			t.Fatalf("%s: bounds changed to %v", corner, got.Bounds())
+		}
+		// The badge's dark pill darkens the corner it sits in and no other.
+		changed := map[string]bool{}
+		for name, point := range map[string]image.Point{
+			CornerTopLeft: {12, 12}, CornerTopRight: {307, 12}, CornerBottomLeft: {12, 187}, CornerBottomRight: {307, 187},
+		} {
+			changed[name] = got.At(point.X, point.Y) != source.At(point.X, point.Y)
+		}
+		for name, isChanged := range changed {
+			if isChanged != (name == corner) {
+				t.Errorf("badge in %s: corner %s changed = %v", corner, name, isChanged)
+			}
+		}
+	}
+	if _, err := DrawBadge(source, BadgeOptions{Text: "x", Corner: "middle"}); err == nil {
+		t.Error("expected an unknown corner to be rejected")
+	}
+}
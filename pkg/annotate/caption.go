@@ -0,0 +1,39 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"strings"
+
+	"git.sr.ht/~sbinet/gg"
+)
+
+// CaptionOptions configures DrawCaption. Color defaults to a near-black
+// gray.
+type CaptionOptions struct {
+	Font    FontOptions
+	FontDir string
+	Color   color.Color
+}
+
+// DrawCaption draws text centered in box on img, wrapped and at the
+// largest size within the font options that fits the box.
+func DrawCaption(img *image.RGBA, box image.Rectangle, text string, options CaptionOptions) error {
+	box = box.Intersect(img.Bounds())
+	if strings.TrimSpace(text) == "" || box.Empty() {
+		return nil
+	}
+	layout, err := fitText(text, options.Font, options.FontDir, box.Dx(), 1, float64(box.Dx()), float64(box.Dy()))
+	if err != nil {
+		return err
+	}
+	ink := options.Color
+	if ink == nil {
+		ink = color.RGBA{R: 0x22, G: 0x22, B: 0x22, A: 0xFF}
+	}
+	gc := gg.NewContextForRGBA(img)
+	gc.SetColor(ink)
+	top := float64(box.Min.Y) + (float64(box.Dy())-layout.Height)/2
+	drawLines(gc, layout, float64(box.Min.X)+float64(box.Dx())/2, top)
+	return nil
+}
@@ -0,0 +1,36 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawCaptionStaysInsideItsBox(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	box := image.Rect(20, 140, 380, 190)
+	if err := DrawCaption(img, box, "a dinoflagellata biologist at work", CaptionOptions{Font: FontOptions{Family: FamilyGo}}); err != nil {
+		t.Fatalf("DrawCaption: %v", err)
+	}
+	inked, outside := 0, 0
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if img.RGBAAt(x, y) == (color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}) {
+				continue
+			}
+			if (image.Point{X: x, Y: y}).In(box) {
+				inked++
+			} else {
+				outside++
+			}
+		}
+	}
+	if inked == 0 || outside != 0 {
+		t.Fatalf("expected ink only inside the box, got %d inside and %d outside", inked, outside)
+	}
+	if err := DrawCaption(img, box, "  ", CaptionOptions{}); err != nil {
+		t.Fatalf("expected blank captions to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"git.sr.ht/~sbinet/gg"
+	"github.com/lucasb-eyer/go-colorful"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	CardRect  = "rect"
+	CardImage = "image"
+	CardText  = "text"
+
+	FitCover   = "cover"
+	FitContain = "contain"
+
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+
+	maxCardSide = 8192
+)
+
+// CardLayout is a declarative card: a canvas of Width x Height pixels and
+// the elements drawn on it in order. Font is the default for every text
+// element.
+type CardLayout struct {
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	Background string        `json:"background,omitempty"`
+	Font       FontOptions   `json:"font,omitempty"`
+	Elements   []CardElement `json:"elements"`
+}
+
+// CardElement is one shape on a card, placed by its top-left corner and
+// size in pixels.
+//
+//   - rect: a rectangle with optional Fill, Stroke and corner Radius.
+//   - image: the image named by Image, scaled to cover the box (cropping
+//     the overflow) or, with Fit contain, to fit inside it.
+//   - text: Text wrapped to the box in Color at the largest size up to Size
+//     points that fits, aligned left, center (the default) or right.
+type CardElement struct {
+	Type        string  `json:"type"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Fill        string  `json:"fill,omitempty"`
+	Stroke      string  `json:"stroke,omitempty"`
+	StrokeWidth float64 `json:"strokeWidth,omitempty"`
+	Radius      float64 `json:"radius,omitempty"`
+	Image       string  `json:"image,omitempty"`
+	Fit         string  `json:"fit,omitempty"`
+	Text        string  `json:"text,omitempty"`
+	Color       string  `json:"color,omitempty"`
+	Align       string  `json:"align,omitempty"`
+	Size        float64 `json:"size,omitempty"`
+	Weight      string  `json:"weight,omitempty"`
+}
+
+// Validate reports a layout that can never render, without touching the
+// disk.
+func (layout CardLayout) Validate() error {
+	if layout.Width <= 0 || layout.Height <= 0 || layout.Width > maxCardSide || layout.Height > maxCardSide {
+		return fmt.Errorf("card size %dx%d is outside 1x1-%dx%d", layout.Width, layout.Height, maxCardSide, maxCardSide)
+	}
+	if err := validateHex(layout.Background); err != nil {
+		return err
+	}
+	if err := layout.Font.Validate(); err != nil {
+		return err
+	}
+	for i, element := range layout.Elements {
+		if err := element.validate(); err != nil {
+			return fmt.Errorf("card element %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (element CardElement) validate() error {
+	switch element.Type {
+	case CardRect, CardImage, CardText:
+	default:
+		return fmt.Errorf("unknown type %q (want rect, image or text)", element.Type)
+	}
+	if element.Width <= 0 || element.Height <= 0 {
+		return fmt.Errorf("%s has no size", element.Type)
+	}
+	for _, hex := range []string{element.Fill, element.Stroke, element.Color} {
+		if err := validateHex(hex); err != nil {
+			return err
+		}
+	}
+	switch element.Fit {
+	case "", FitCover, FitContain:
+	default:
+		return fmt.Errorf("unknown fit %q (want cover or contain)", element.Fit)
+	}
+	switch element.Align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+	default:
+		return fmt.Errorf("unknown alignment %q (want left, center or right)", element.Align)
+	}
+	if element.Type == CardImage && element.Image == "" {
+		return fmt.Errorf("image element names no image")
+	}
+	if element.StrokeWidth < 0 || element.Radius < 0 || element.Size < 0 {
+		return fmt.Errorf("%s has a negative stroke width, radius or size", element.Type)
+	}
+	return (FontOptions{Weight: element.Weight}).Validate()
+}
+
+func validateHex(hex string) error {
+	if hex == "" {
+		return nil
+	}
+	if _, err := colorful.Hex(hex); err != nil {
+		return fmt.Errorf("invalid color %q", hex)
+	}
+	return nil
+}
+
+// RenderCard draws layout. images holds the pictures image elements name;
+// fontDir holds user fonts. Text elements are drawn as given, so any
+// templating happens before.
+func RenderCard(layout CardLayout, images map[string]image.Image, fontDir string) (image.Image, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	gc := gg.NewContext(layout.Width, layout.Height)
+	if layout.Background != "" {
+		gc.SetColor(hexColor(layout.Background))
+		gc.Clear()
+	}
+	for i, element := range layout.Elements {
+		var err error
+		switch element.Type {
+		case CardRect:
+			drawCardRect(gc, element)
+		case CardImage:
+			err = drawCardImage(gc, element, images[element.Image])
+		case CardText:
+			err = drawCardText(gc, element, layout.Font, fontDir)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("card element %d: %w", i+1, err)
+		}
+	}
+	return gc.Image(), nil
+}
+
+func drawCardRect(gc *gg.Context, element CardElement) {
+	gc.DrawRoundedRectangle(element.X, element.Y, element.Width, element.Height, element.Radius)
+	if element.Fill != "" {
+		gc.SetColor(hexColor(element.Fill))
+		gc.FillPreserve()
+	}
+	if element.Stroke != "" && element.StrokeWidth > 0 {
+		gc.SetColor(hexColor(element.Stroke))
+		gc.SetLineWidth(element.StrokeWidth)
+		gc.StrokePreserve()
+	}
+	gc.ClearPath()
+}
+
+func drawCardImage(gc *gg.Context, element CardElement, img image.Image) error {
+	if img == nil {
+		return fmt.Errorf("no %q image to draw", element.Image)
+	}
+	bounds := img.Bounds()
+	boxWidth, boxHeight := int(math.Round(element.Width)), int(math.Round(element.Height))
+	source := bounds
+	target := image.Rect(0, 0, boxWidth, boxHeight)
+	if element.Fit == FitContain {
+		scale := math.Min(element.Width/float64(bounds.Dx()), element.Height/float64(bounds.Dy()))
+		width, height := int(float64(bounds.Dx())*scale+0.5), int(float64(bounds.Dy())*scale+0.5)
+		target = image.Rect(0, 0, width, height).Add(image.Pt((boxWidth-width)/2, (boxHeight-height)/2))
+	} else {
+		aspect := element.Width / element.Height
+		cropWidth, cropHeight := float64(bounds.Dx()), float64(bounds.Dx())/aspect
+		if cropHeight > float64(bounds.Dy()) {
+			cropWidth, cropHeight = float64(bounds.Dy())*aspect, float64(bounds.Dy())
+		}
+		x := bounds.Min.X + int((float64(bounds.Dx())-cropWidth)/2)
+		y := bounds.Min.Y + int((float64(bounds.Dy())-cropHeight)/2)
+		source = image.Rect(x, y, x+int(cropWidth+0.5), y+int(cropHeight+0.5))
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, boxWidth, boxHeight))
+	xdraw.CatmullRom.Scale(scaled, target, img, source, xdraw.Over, nil)
+	gc.DrawImage(scaled, int(math.Round(element.X)), int(math.Round(element.Y)))
+	if element.Stroke != "" && element.StrokeWidth > 0 {
+		frame := element
+		frame.Fill = ""
+		drawCardRect(gc, frame)
+	}
+	return nil
+}
+
+func drawCardText(gc *gg.Context, element CardElement, font FontOptions, fontDir string) error {
+	text := strings.TrimSpace(element.Text)
+	if text == "" {
+		return nil
+	}
+	if element.Weight != "" {
+		font.Weight = element.Weight
+	}
+	parsed, err := loadFont(font, fontDir)
+	if err != nil {
+		return fmt.Errorf("load font: %w", err)
+	}
+	maxSize := element.Size
+	if maxSize <= 0 {
+		maxSize = element.Height * 0.6
+	}
+	layout, err := layoutText(parsed, text, element.Width, element.Height, math.Min(6, maxSize), maxSize, font.lineSpacing())
+	if err != nil {
+		return err
+	}
+	ink := color.Color(color.Black)
+	if element.Color != "" {
+		ink = hexColor(element.Color)
+	}
+	gc.SetColor(ink)
+	gc.SetFontFace(layout.Face)
+	x, anchor := element.X+element.Width/2, 0.5
+	switch element.Align {
+	case AlignLeft:
+		x, anchor = element.X, 0
+	case AlignRight:
+		x, anchor = element.X+element.Width, 1
+	}
+	top := element.Y + (element.Height-layout.Height)/2
+	for i, line := range layout.Lines {
+		baseline := top + layout.Ascent + float64(i)*layout.LineHeight*layout.LineSpacing
+		gc.DrawStringAnchored(line, x, baseline, anchor, 0)
+	}
+	return nil
+}
+
+func hexColor(hex string) color.Color {
+	parsed, _ := colorful.Hex(hex)
+	r, g, b := parsed.RGB255()
+	return color.RGBA{R: r, G: g, B: b, A: 0xFF}
+}
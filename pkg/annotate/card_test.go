@@ -0,0 +1,76 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestRenderCard(t *testing.T) {
+	art := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(art, art.Bounds(), &image.Uniform{color.RGBA{R: 0x20, G: 0xA0, B: 0x40, A: 0xFF}}, image.Point{}, draw.Src)
+	layout := CardLayout{
+		Width:      200,
+		Height:     300,
+		Background: "#102030",
+		Font:       FontOptions{Family: FamilyGo},
+		Elements: []CardElement{
+			{Type: CardRect, X: 10, Y: 10, Width: 180, Height: 280, Fill: "#f0e8d0", Radius: 8},
+			{Type: CardImage, X: 20, Y: 20, Width: 160, Height: 160, Image: "art", Stroke: "#000000", StrokeWidth: 2},
+			{Type: CardText, X: 20, Y: 190, Width: 160, Height: 40, Text: "Title", Color: "#800000", Align: AlignLeft, Weight: WeightBold},
+		},
+	}
+	img, err := RenderCard(layout, map[string]image.Image{"art": art}, "")
+	if err != nil {
+		t.Fatalf("RenderCard: %v", err)
+	}
+	rgba := img.(*image.RGBA)
+	if rgba.Bounds().Dx() != 200 || rgba.Bounds().Dy() != 300 {
+		t.Fatalf("unexpected card size %v", rgba.Bounds())
+	}
+	for name, check := range map[string]struct {
+		at   image.Point
+		want color.RGBA
+	}{
+		"background": {image.Pt(2, 2), color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF}},
+		"panel":      {image.Pt(100, 260), color.RGBA{R: 0xF0, G: 0xE8, B: 0xD0, A: 0xFF}},
+		"art":        {image.Pt(100, 100), color.RGBA{R: 0x20, G: 0xA0, B: 0x40, A: 0xFF}},
+	} {
+		if got := rgba.RGBAAt(check.at.X, check.at.Y); got != check.want {
+			t.Errorf("%s: got %v, want %v", name, got, check.want)
+		}
+	}
+	inked := false
+	for y := 190; y < 230 && !inked; y++ {
+		for x := 20; x < 100; x++ {
+			if c := rgba.RGBAAt(x, y); c.R > 0x60 && c.G < 0x60 {
+				inked = true
+				break
+			}
+		}
+	}
+	if !inked {
+		t.Error("expected the title in its box")
+	}
+
+	if _, err := RenderCard(layout, nil, ""); err == nil || !strings.Contains(err.Error(), "element 2") {
+		t.Fatalf("expected a missing image to be reported, got %v", err)
+	}
+}
+
+func TestCardLayoutValidate(t *testing.T) {
+	for name, layout := range map[string]CardLayout{
+		"no size":    {},
+		"bad type":   {Width: 10, Height: 10, Elements: []CardElement{{Type: "circle", Width: 1, Height: 1}}},
+		"bad color":  {Width: 10, Height: 10, Elements: []CardElement{{Type: CardRect, Width: 1, Height: 1, Fill: "teal"}}},
+		"no image":   {Width: 10, Height: 10, Elements: []CardElement{{Type: CardImage, Width: 1, Height: 1}}},
+		"bad fit":    {Width: 10, Height: 10, Elements: []CardElement{{Type: CardImage, Image: "art", Fit: "stretch", Width: 1, Height: 1}}},
+		"bad weight": {Width: 10, Height: 10, Elements: []CardElement{{Type: CardText, Weight: "heavy", Width: 1, Height: 1}}},
+	} {
+		if err := layout.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	ContrastAA  = "AA"
+	ContrastAAA = "AAA"
+)
+
+// contrastTargets are the WCAG 2 minimum contrast ratios for normal text.
+var contrastTargets = map[string]float64{
+	ContrastAA:  4.5,
+	ContrastAAA: 7,
+}
+
+// Colors records the band and text colors an annotation was drawn with and
+// the WCAG contrast ratio between them.
+type Colors struct {
+	Band          string  `json:"band"`
+	Text          string  `json:"text"`
+	ContrastRatio float64 `json:"contrastRatio"`
+	Level         string  `json:"level"`
+	// Source is where the band color came from: the image's dominant color,
+	// or the palette entry closest to it.
+	Source string `json:"source"`
+}
+
+const (
+	ColorSourceImage   = "image"
+	ColorSourcePalette = "palette"
+	// ColorSourceLayout marks the fixed colors of a layout (the polaroid's
+	// paper and ink).
+	ColorSourceLayout = "layout"
+)
+
+// ValidateContrast reports a contrast level other than AA or AAA. Empty is AA.
+func ValidateContrast(level string) error {
+	if _, ok := contrastTargets[contrastLevel(level)]; !ok {
+		return fmt.Errorf("unknown contrast level %q (want AA or AAA)", level)
+	}
+	return nil
+}
+
+func contrastLevel(level string) string {
+	if level == "" {
+		return ContrastAA
+	}
+	return strings.ToUpper(level)
+}
+
+// ChooseColors picks the band and text colors AnnotateImage draws img with.
+// The band starts as the image's dominant color, or the entry of
+// options.Palette perceptually closest to it, and its lightness is pushed
+// away from the text color until the contrast level is met. For the overlay
+// layout the level is met by the translucent box over any image; the
+// polaroid layout always draws its paper and ink.
+func ChooseColors(img image.Image, options Options) (Colors, error) {
+	level := contrastLevel(options.Contrast)
+	target, ok := contrastTargets[level]
+	if !ok {
+		return Colors{}, fmt.Errorf("unknown contrast level %q (want AA or AAA)", options.Contrast)
+	}
+	if options.Layout == LayoutPolaroid {
+		paper, _ := colorful.MakeColor(polaroidPaper)
+		ink, _ := colorful.MakeColor(polaroidInk)
+		return Colors{
+			Band:          paper.Hex(),
+			Text:          ink.Hex(),
+			ContrastRatio: math.Floor(contrastRatio(paper, ink)*100) / 100,
+			Level:         level,
+			Source:        ColorSourceLayout,
+		}, nil
+	}
+	dominantHex, err := findAverageDominantColor(img)
+	if err != nil {
+		return Colors{}, err
+	}
+	band, err := colorful.Hex(dominantHex)
+	if err != nil {
+		return Colors{}, err
+	}
+	source := ColorSourceImage
+	if closest, ok := closestPaletteColor(band, options.Palette); ok {
+		band, source = closest, ColorSourcePalette
+	}
+	opacity := 1.0
+	if options.Layout == LayoutOverlay {
+		opacity = overlayOpacity
+	}
+	band, text, ratio := ensureContrast(band, target, opacity)
+	return Colors{
+		Band:          band.Hex(),
+		Text:          text.Hex(),
+		ContrastRatio: math.Floor(ratio*100) / 100,
+		Level:         level,
+		Source:        source,
+	}, nil
+}
+
+// closestPaletteColor returns the palette color nearest to target by
+// CIEDE2000. Entries that are not hex colors are ignored.
+func closestPaletteColor(target colorful.Color, palette []string) (colorful.Color, bool) {
+	best, found, bestDistance := colorful.Color{}, false, math.Inf(1)
+	for _, entry := range palette {
+		candidate, err := colorful.Hex(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		if distance := target.DistanceCIEDE2000(candidate); distance < bestDistance {
+			best, found, bestDistance = candidate, true, distance
+		}
+	}
+	return best, found
+}
+
+// ensureContrast keeps the hue and chroma of band and steps its HCL
+// lightness away from the better of black and white text until the ratio
+// reaches target. A band drawn at less than full opacity is measured where
+// it is weakest: over white under white text, over black under black text.
+// Pure black or white always gets there, so it terminates.
+func ensureContrast(band colorful.Color, target, opacity float64) (colorful.Color, colorful.Color, float64) {
+	black, white := colorful.Color{}, colorful.Color{R: 1, G: 1, B: 1}
+	text := white
+	if contrastRatio(band, black) > contrastRatio(band, white) {
+		text = black
+	}
+	behind := func(band colorful.Color) colorful.Color {
+		return quantize(band.BlendRgb(text, 1-opacity))
+	}
+	band = quantize(band)
+	hue, chroma, lightness := band.Hcl()
+	for contrastRatio(behind(band), text) < target {
+		if text == white {
+			lightness = math.Max(0, lightness-0.01)
+		} else {
+			lightness = math.Min(1, lightness+0.01)
+		}
+		band = quantize(colorful.Hcl(hue, chroma, lightness))
+		if lightness == 0 || lightness == 1 {
+			band = colorful.Color{R: lightness, G: lightness, B: lightness}
+			break
+		}
+	}
+	return band, text, contrastRatio(behind(band), text)
+}
+
+// contrastRatio is the WCAG 2 contrast ratio, from 1 to 21.
+func contrastRatio(a, b colorful.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// ContrastRatio is the WCAG 2 contrast ratio between two colors.
+func ContrastRatio(a, b color.Color) float64 {
+	ca, _ := colorful.MakeColor(a)
+	cb, _ := colorful.MakeColor(b)
+	return contrastRatio(ca, cb)
+}
+
+func relativeLuminance(c colorful.Color) float64 {
+	r, g, b := c.Clamped().LinearRgb()
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+func toRGBA(c colorful.Color) color.RGBA {
+	r, g, b := c.Clamped().RGB255()
+	return color.RGBA{R: r, G: g, B: b, A: 0xFF}
+}
+
+// quantize rounds a color to the 8-bit value it will be drawn with, so that
+// the recorded contrast ratio is the one on the page.
+func quantize(c colorful.Color) colorful.Color {
+	quantized, _ := colorful.MakeColor(toRGBA(c))
+	return quantized
+}
@@ -0,0 +1,120 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func uniformImage(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestContrastRatio(t *testing.T) {
+	if got := ContrastRatio(color.Black, color.White); math.Abs(got-21) > 1e-9 {
+		t.Fatalf("black on white = %g, want 21", got)
+	}
+	if got := ContrastRatio(color.White, color.White); got != 1 {
+		t.Fatalf("white on white = %g, want 1", got)
+	}
+}
+
+func TestChooseColorsMeetsContrastLevels(t *testing.T) {
+	// Mid tones are where the old luminance heuristic produced unreadable text.
+	for _, mid := range []color.RGBA{{0x77, 0x77, 0x77, 0xFF}, {0xE0, 0x40, 0x40, 0xFF}, {0x30, 0x90, 0xC0, 0xFF}} {
+		for level, target := range map[string]float64{"": 4.5, ContrastAA: 4.5, "aaa": 7} {
+			colors, err := ChooseColors(uniformImage(mid), Options{Contrast: level})
+			if err != nil {
+				t.Fatal(err)
+			}
+			band, _ := parseHexColor(colors.Band)
+			text, _ := parseHexColor(colors.Text)
+			if ratio := ContrastRatio(band, text); ratio < target || colors.ContrastRatio < target {
+				t.Errorf("%v at %q: %s on %s has ratio %g (recorded %g)", mid, level, colors.Text, colors.Band, ratio, colors.ContrastRatio)
+			}
+			if colors.Source != ColorSourceImage {
+				t.Errorf("unexpected source %q", colors.Source)
+			}
+		}
+	}
+	if _, err := ChooseColors(uniformImage(color.White), Options{Contrast: "AAAA"}); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
+
+func TestChooseColorsPrefersClosestPaletteColor(t *testing.T) {
+	colors, err := ChooseColors(uniformImage(color.RGBA{0x10, 0x20, 0xA0, 0xFF}), Options{
+		Palette: []string{"#ff0000", "not-a-color", "#000080", "#00ff00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if colors.Source != ColorSourcePalette || colors.Band != "#000080" {
+		t.Fatalf("expected navy from the palette, got %+v", colors)
+	}
+}
+
+func TestValidateContrast(t *testing.T) {
+	for _, level := range []string{"", "AA", "aaa"} {
+		if err := ValidateContrast(level); err != nil {
+			t.Errorf("ValidateContrast(%q): %v", level, err)
+		}
+	}
+	if err := ValidateContrast("A"); err == nil {
+		t.Error("expected level A to be rejected")
+	}
+}
+
+// The overlay box is translucent, so the level must hold where it covers the
+// pixels closest to the text color.
+func TestOverlayContrastHoldsOverTheImage(t *testing.T) {
+	gray := color.RGBA{0x77, 0x77, 0x77, 0xFF}
+	options := Options{Caption: "overlay text", Layout: LayoutOverlay, Contrast: ContrastAAA, Font: FontOptions{Family: FamilyGo}}
+	chosen, err := ChooseColors(uniformImage(gray), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := parseHexColor(chosen.Text)
+	// Three grays keep the patch out of the dominant colors.
+	source := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	for i, shade := range []uint8{0x76, 0x77, 0x78} {
+		draw.Draw(source, image.Rect(0, i*67, 320, 200), &image.Uniform{color.RGBA{shade, shade, shade, 0xFF}}, image.Point{}, draw.Src)
+	}
+	draw.Draw(source, image.Rect(0, 160, 40, 200), &image.Uniform{text}, image.Point{}, draw.Src)
+	out, err := AnnotateImage(source, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors, err := ChooseColors(source, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if colors != chosen || colors.ContrastRatio < 7 {
+		t.Fatalf("drew %+v, chose %+v", colors, chosen)
+	}
+	// Inside the box's lower left corner, clear of the centered text.
+	if ratio := ContrastRatio(out.At(18, 187), text); ratio < 7 {
+		t.Fatalf("box over %s measures %g against the text", chosen.Text, ratio)
+	}
+}
+
+func TestPolaroidRecordsPaperAndInk(t *testing.T) {
+	options := Options{Caption: "polaroid", Layout: LayoutPolaroid, Contrast: ContrastAAA, Font: FontOptions{Family: FamilyGo}}
+	out, err := AnnotateImage(goldenSource(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors, err := ChooseColors(goldenSource(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paper, _ := parseHexColor(colors.Band)
+	ink, _ := parseHexColor(colors.Text)
+	if colors.Source != ColorSourceLayout || out.At(1, 1) != paper || colors.ContrastRatio < 7 || colors.ContrastRatio > ContrastRatio(paper, ink) {
+		t.Fatalf("unexpected polaroid colors %+v", colors)
+	}
+}
@@ -0,0 +1,251 @@
+package annotate
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+const (
+	// FamilyDefault tries the system monospace fonts the annotator has always
+	// used and falls back to the embedded Go Mono font when neither exists.
+	FamilyDefault = ""
+	FamilySystem  = "system"
+	FamilyGo      = "go"
+	FamilyGoMono  = "gomono"
+
+	WeightRegular = "regular"
+	WeightMedium  = "medium"
+	WeightBold    = "bold"
+
+	defaultLineSpacing = 1.5
+)
+
+// systemFontPaths are the fonts the annotator used before fonts were
+// configurable, in order of preference.
+var systemFontPaths = []string{
+	"/usr/share/fonts/truetype/dejavu/DejaVuSansMono.ttf", // Linux
+	"/System/Library/Fonts/Monaco.ttf",                    // macOS
+}
+
+// FontOptions selects and sizes the annotation font. Family is one of the
+// embedded Go fonts ("go", "gomono"), "system", or the name of a TTF/OTF font
+// in the font directory (looked up as <family>-<weight>.ttf, then
+// <family>.ttf, and likewise .otf). File names a font file in the font
+// directory directly and wins over Family. MinSize and MaxSize bound the
+// fitted font size in points (by default 1/96 and 1/16 of the image width),
+// SizeScale multiplies both bounds and LineSpacing replaces the default of
+// 1.5 lines.
+type FontOptions struct {
+	Family      string  `json:"family,omitempty"`
+	File        string  `json:"file,omitempty"`
+	Weight      string  `json:"weight,omitempty"`
+	MinSize     float64 `json:"minSize,omitempty"`
+	MaxSize     float64 `json:"maxSize,omitempty"`
+	SizeScale   float64 `json:"sizeScale,omitempty"`
+	LineSpacing float64 `json:"lineSpacing,omitempty"`
+}
+
+// Merge returns options with every field set in override replacing the
+// corresponding field of options.
+func (options FontOptions) Merge(override FontOptions) FontOptions {
+	if override.Family != "" {
+		options.Family = override.Family
+	}
+	if override.File != "" {
+		options.File = override.File
+	}
+	if override.Weight != "" {
+		options.Weight = override.Weight
+	}
+	if override.MinSize != 0 {
+		options.MinSize = override.MinSize
+	}
+	if override.MaxSize != 0 {
+		options.MaxSize = override.MaxSize
+	}
+	if override.SizeScale != 0 {
+		options.SizeScale = override.SizeScale
+	}
+	if override.LineSpacing != 0 {
+		options.LineSpacing = override.LineSpacing
+	}
+	return options
+}
+
+// Validate reports options that can never load, without touching the disk.
+func (options FontOptions) Validate() error {
+	switch strings.ToLower(options.Weight) {
+	case "", WeightRegular, WeightMedium, WeightBold:
+	default:
+		return fmt.Errorf("unknown font weight %q", options.Weight)
+	}
+	if options.SizeScale < 0 || options.SizeScale > 10 {
+		return fmt.Errorf("font size scale %g is out of range", options.SizeScale)
+	}
+	if options.MinSize < 0 || options.MaxSize < 0 || options.MaxSize > 1000 {
+		return fmt.Errorf("font size range %g-%g is out of range", options.MinSize, options.MaxSize)
+	}
+	if options.MinSize > 0 && options.MaxSize > 0 && options.MinSize > options.MaxSize {
+		return fmt.Errorf("minimum font size %g is larger than the maximum %g", options.MinSize, options.MaxSize)
+	}
+	if options.LineSpacing < 0 || options.LineSpacing > 5 {
+		return fmt.Errorf("line spacing %g is out of range", options.LineSpacing)
+	}
+	if options.File != "" {
+		if _, err := fontDirPath("", options.File); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (options FontOptions) sizeScale() float64 {
+	if options.SizeScale <= 0 {
+		return 1
+	}
+	return options.SizeScale
+}
+
+// sizeRange returns the font size bounds in points for an image width.
+func (options FontOptions) sizeRange(width int) (float64, float64) {
+	minSize, maxSize := options.MinSize, options.MaxSize
+	if minSize <= 0 {
+		minSize = math.Max(8, float64(width)/96)
+	}
+	if maxSize <= 0 {
+		maxSize = math.Max(minSize, float64(width)/16)
+	}
+	if minSize > maxSize {
+		minSize = maxSize
+	}
+	scale := options.sizeScale()
+	return minSize * scale, maxSize * scale
+}
+
+func (options FontOptions) lineSpacing() float64 {
+	if options.LineSpacing <= 0 {
+		return defaultLineSpacing
+	}
+	return options.LineSpacing
+}
+
+// loadFont resolves options to a parsed font. fontDir holds user fonts; it
+// may be empty when only embedded and system fonts are wanted.
+func loadFont(options FontOptions, fontDir string) (*opentype.Font, error) {
+	weight := strings.ToLower(options.Weight)
+	if options.File != "" {
+		path, err := fontDirPath(fontDir, options.File)
+		if err != nil {
+			return nil, err
+		}
+		return loadFontFile(path)
+	}
+	switch family := strings.ToLower(strings.TrimSpace(options.Family)); family {
+	case FamilyDefault:
+		for _, path := range systemFontPaths {
+			if parsed, err := loadFontFile(path); err == nil {
+				return parsed, nil
+			}
+		}
+		return opentype.Parse(embeddedFont(FamilyGoMono, weight))
+	case FamilySystem:
+		var lastErr error
+		for _, path := range systemFontPaths {
+			parsed, err := loadFontFile(path)
+			if err == nil {
+				return parsed, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	case FamilyGo, FamilyGoMono:
+		return opentype.Parse(embeddedFont(family, weight))
+	default:
+		if fontDir == "" {
+			return nil, fmt.Errorf("font family %q needs a font directory", options.Family)
+		}
+		candidates := []string{}
+		if weight != "" {
+			candidates = append(candidates, options.Family+"-"+weight+".ttf", options.Family+"-"+weight+".otf")
+		}
+		candidates = append(candidates, options.Family+".ttf", options.Family+".otf")
+		for _, name := range candidates {
+			path, err := fontDirPath(fontDir, name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := os.Stat(path); err == nil {
+				return loadFontFile(path)
+			}
+		}
+		return nil, fmt.Errorf("font family %q not found in %s", options.Family, fontDir)
+	}
+}
+
+// loadFontFace resolves options to a face at the given size.
+func loadFontFace(options FontOptions, fontDir string, points float64) (font.Face, error) {
+	parsed, err := loadFont(options, fontDir)
+	if err != nil {
+		return nil, err
+	}
+	return newFace(parsed, points)
+}
+
+func newFace(parsed *opentype.Font, points float64) (font.Face, error) {
+	return opentype.NewFace(parsed, &opentype.FaceOptions{Size: points, DPI: 72})
+}
+
+func embeddedFont(family, weight string) []byte {
+	if family == FamilyGoMono {
+		if weight == WeightBold {
+			return gomonobold.TTF
+		}
+		return gomono.TTF
+	}
+	switch weight {
+	case WeightBold:
+		return gobold.TTF
+	case WeightMedium:
+		return gomedium.TTF
+	default:
+		return goregular.TTF
+	}
+}
+
+// fontDirPath joins a user font name onto the font directory, refusing names
+// that would leave it or that are not TrueType/OpenType files.
+func fontDirPath(fontDir, name string) (string, error) {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("font file %q must be inside the font directory", name)
+	}
+	switch strings.ToLower(filepath.Ext(clean)) {
+	case ".ttf", ".otf":
+	default:
+		return "", fmt.Errorf("font file %q is not a .ttf or .otf file", name)
+	}
+	return filepath.Join(fontDir, clean), nil
+}
+
+func loadFontFile(path string) (*opentype.Font, error) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := opentype.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse font %s: %w", filepath.Base(path), err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,95 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+)
+
+func TestLoadFontFaceEmbeddedFamilies(t *testing.T) {
+	for _, options := range []FontOptions{
+		{},
+		{Family: FamilyGo},
+		{Family: FamilyGo, Weight: WeightBold},
+		{Family: FamilyGoMono, Weight: WeightBold},
+	} {
+		face, err := loadFontFace(options, "", 24)
+		if err != nil {
+			t.Fatalf("loadFontFace(%#v): %v", options, err)
+		}
+		if face.Metrics().Height <= 0 {
+			t.Fatalf("loadFontFace(%#v) returned an empty face", options)
+		}
+	}
+}
+
+func TestLoadFontFaceFromFontDir(t *testing.T) {
+	fontDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fontDir, "Brand-bold.ttf"), gobold.TTF, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFontFace(FontOptions{Family: "Brand", Weight: WeightBold}, fontDir, 18); err != nil {
+		t.Fatalf("family lookup: %v", err)
+	}
+	if _, err := loadFontFace(FontOptions{File: "Brand-bold.ttf"}, fontDir, 18); err != nil {
+		t.Fatalf("file lookup: %v", err)
+	}
+	if _, err := loadFontFace(FontOptions{Family: "Missing"}, fontDir, 18); err == nil {
+		t.Fatal("expected a missing family to fail")
+	}
+	for _, name := range []string{"../Brand-bold.ttf", "/etc/fonts/x.ttf", "brand.woff"} {
+		if err := (FontOptions{File: name}).Validate(); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if err := (FontOptions{Weight: "heavy"}).Validate(); err == nil {
+		t.Error("expected an unknown weight to be rejected")
+	}
+}
+
+func TestFontOptionsMerge(t *testing.T) {
+	series := FontOptions{Family: FamilyGo, SizeScale: 1.2, LineSpacing: 1.3}
+	merged := series.Merge(FontOptions{Weight: WeightBold, SizeScale: 0.8})
+	want := FontOptions{Family: FamilyGo, Weight: WeightBold, SizeScale: 0.8, LineSpacing: 1.3}
+	if merged != want {
+		t.Fatalf("Merge = %#v, want %#v", merged, want)
+	}
+}
+
+func TestAnnotateWithEmbeddedFont(t *testing.T) {
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "generated", "image.png")
+	if err := os.MkdirAll(filepath.Dir(generated), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "annotated"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 200, 120))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{R: 40, G: 80, B: 160, A: 255}}, image.Point{}, draw.Src)
+	file, err := os.Create(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	out, err := AnnotateWithOptions("a cheerful octopus", generated, "bottom", 0.2, Options{Font: FontOptions{Family: FamilyGo}})
+	if err != nil {
+		t.Fatalf("AnnotateWithOptions: %v", err)
+	}
+	if out != filepath.Join(dir, "annotated", "image.png") {
+		t.Fatalf("unexpected output path %s", out)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("annotated image missing: %v", err)
+	}
+}
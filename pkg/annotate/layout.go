@@ -0,0 +1,196 @@
+package annotate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"git.sr.ht/~sbinet/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+)
+
+const ellipsis = "…"
+
+// textLayout is annotation text wrapped and sized to fit a box, measured with
+// the glyph advances of the font that will draw it.
+type textLayout struct {
+	Face        font.Face
+	FontSize    float64
+	Lines       []string
+	LineHeight  float64
+	Ascent      float64
+	LineSpacing float64
+	Height      float64
+	Truncated   bool
+}
+
+// layoutText finds the largest font size between minSize and maxSize at which
+// text, wrapped to width, fits in height. Words wider than the box are broken
+// with a hyphen. When even minSize does not fit, the text is cut to the lines
+// that do and the last line ends in an ellipsis.
+func layoutText(parsed *opentype.Font, text string, width, height, minSize, maxSize, lineSpacing float64) (textLayout, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	if minSize > maxSize {
+		minSize = maxSize
+	}
+	measure := func(size float64) (textLayout, bool, error) {
+		face, err := newFace(parsed, size)
+		if err != nil {
+			return textLayout{}, false, err
+		}
+		gc := gg.NewContext(1, 1)
+		gc.SetFontFace(face)
+		layout := textLayout{
+			Face:        face,
+			FontSize:    size,
+			Lines:       wrapText(gc, text, width),
+			LineHeight:  gc.FontHeight(),
+			Ascent:      float64(face.Metrics().Ascent) / 64,
+			LineSpacing: lineSpacing,
+		}
+		layout.Height = layout.heightOf(len(layout.Lines))
+		return layout, layout.Height <= height, nil
+	}
+
+	best, fits, err := measure(maxSize)
+	if err != nil || fits {
+		return best, err
+	}
+	best, fits, err = measure(minSize)
+	if err != nil {
+		return textLayout{}, err
+	}
+	if !fits {
+		best.truncate(height, width)
+		return best, nil
+	}
+	// Binary search to half a point; the wrapped height only grows with size.
+	low, high := minSize, maxSize
+	for high-low > 0.5 {
+		middle := (low + high) / 2
+		candidate, fits, err := measure(middle)
+		if err != nil {
+			return textLayout{}, err
+		}
+		if fits {
+			low, best = middle, candidate
+		} else {
+			high = middle
+		}
+	}
+	return best, nil
+}
+
+func (layout textLayout) heightOf(lines int) float64 {
+	if lines == 0 {
+		return 0
+	}
+	return layout.LineHeight * (1 + float64(lines-1)*layout.LineSpacing)
+}
+
+// truncate keeps the lines that fit in height (at least one) and ends the
+// last of them with an ellipsis.
+func (layout *textLayout) truncate(height, width float64) {
+	keep := 1
+	for keep < len(layout.Lines) && layout.heightOf(keep+1) <= height {
+		keep++
+	}
+	if keep >= len(layout.Lines) {
+		return
+	}
+	gc := gg.NewContext(1, 1)
+	gc.SetFontFace(layout.Face)
+	last := []rune(strings.TrimSuffix(layout.Lines[keep-1], "-"))
+	for len(last) > 0 {
+		if w, _ := gc.MeasureString(string(last) + ellipsis); w <= width {
+			break
+		}
+		last = last[:len(last)-1]
+	}
+	layout.Lines = append(layout.Lines[:keep-1], strings.TrimRightFunc(string(last), unicode.IsSpace)+ellipsis)
+	layout.Height = layout.heightOf(keep)
+	layout.Truncated = true
+}
+
+// wrapText greedily fills lines no wider than width. Unlike gg's WordWrap it
+// also breaks words that are wider than a line on their own.
+func wrapText(gc *gg.Context, text string, width float64) []string {
+	lines := []string{}
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for _, piece := range breakWord(gc, word, width) {
+			candidate := piece
+			if line != "" {
+				candidate = line + " " + piece
+			}
+			if w, _ := gc.MeasureString(candidate); w <= width || line == "" {
+				line = candidate
+				continue
+			}
+			lines = append(lines, line)
+			line = piece
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// breakWord splits a word wider than width at rune boundaries. Breaks inside
+// alphabetic scripts get a hyphen; others (CJK, digits, symbols) break bare.
+func breakWord(gc *gg.Context, word string, width float64) []string {
+	if w, _ := gc.MeasureString(word); w <= width {
+		return []string{word}
+	}
+	pieces := []string{}
+	runes := []rune(word)
+	for len(runes) > 0 {
+		if w, _ := gc.MeasureString(string(runes)); w <= width {
+			pieces = append(pieces, string(runes))
+			break
+		}
+		n, piece := 1, string(runes[:1])
+		for i := 2; i < len(runes); i++ {
+			candidate := string(runes[:i])
+			if hyphenates(runes[i-1]) && hyphenates(runes[i]) {
+				candidate += "-"
+			}
+			if w, _ := gc.MeasureString(candidate); w > width {
+				break
+			}
+			n, piece = i, candidate
+		}
+		pieces = append(pieces, piece)
+		runes = runes[n:]
+	}
+	return pieces
+}
+
+// hyphenates reports whether a break next to r takes a hyphen: letters of the
+// Latin, Greek and Cyrillic scripts do.
+func hyphenates(r rune) bool {
+	return unicode.IsLetter(r) && r < 0x0530
+}
+
+// drawLines draws a layout centered horizontally on centerX with its first
+// line's top at top.
+func drawLines(gc *gg.Context, layout textLayout, centerX, top float64) {
+	gc.SetFontFace(layout.Face)
+	for i, line := range layout.Lines {
+		baseline := top + layout.Ascent + float64(i)*layout.LineHeight*layout.LineSpacing
+		gc.DrawStringAnchored(line, centerX, baseline, 0.5, 0)
+	}
+}
+
+// fitText loads the font and lays text out in a box, with the font size
+// bounds for imageWidth multiplied by scale.
+func fitText(text string, fontOptions FontOptions, fontDir string, imageWidth int, scale, width, height float64) (textLayout, error) {
+	parsed, err := loadFont(fontOptions, fontDir)
+	if err != nil {
+		return textLayout{}, fmt.Errorf("load font: %w", err)
+	}
+	minSize, maxSize := fontOptions.sizeRange(imageWidth)
+	return layoutText(parsed, text, width, height, minSize*scale, maxSize*scale, fontOptions.lineSpacing())
+}
@@ -0,0 +1,186 @@
+package annotate
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"git.sr.ht/~sbinet/gg"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+func goRegular(t *testing.T) *opentype.Font {
+	t.Helper()
+	parsed, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestBreakWordHyphenatesAtRuneBoundaries(t *testing.T) {
+	face, err := newFace(goRegular(t), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc := gg.NewContext(1, 1)
+	gc.SetFontFace(face)
+	for _, word := range []string{"pneumonoultramicroscopicsilicovolcanoconiosis", "Überschallgeschwindigkeitsflugzeug", "Ελληνικάκείμενοχωρίςκενά"} {
+		pieces := breakWord(gc, word, 80)
+		if len(pieces) < 2 {
+			t.Fatalf("%s was not broken: %q", word, pieces)
+		}
+		joined := ""
+		for i, piece := range pieces {
+			if !utf8.ValidString(piece) {
+				t.Fatalf("piece %q is not valid UTF-8", piece)
+			}
+			if w, _ := gc.MeasureString(piece); w > 80 {
+				t.Fatalf("piece %q is %g wide", piece, w)
+			}
+			if i < len(pieces)-1 {
+				if !strings.HasSuffix(piece, "-") {
+					t.Fatalf("piece %q has no hyphen", piece)
+				}
+				piece = strings.TrimSuffix(piece, "-")
+			}
+			joined += piece
+		}
+		if joined != word {
+			t.Fatalf("pieces %q do not rejoin to %s", pieces, word)
+		}
+	}
+}
+
+func TestLayoutTextFitsBand(t *testing.T) {
+	parsed := goRegular(t)
+	short, err := layoutText(parsed, "a cheerful octopus", 400, 80, 8, 32, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short.FontSize != 32 || len(short.Lines) != 1 || short.Truncated {
+		t.Fatalf("short text: size %g, lines %q", short.FontSize, short.Lines)
+	}
+
+	long := strings.Repeat("a cheerful octopus juggling teacups on a rainy pier ", 4)
+	fitted, err := layoutText(parsed, long, 400, 80, 8, 32, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fitted.FontSize >= 32 || fitted.FontSize < 8 || fitted.Height > 80 || fitted.Truncated {
+		t.Fatalf("long text: size %g, height %g, truncated %v", fitted.FontSize, fitted.Height, fitted.Truncated)
+	}
+	larger, err := layoutText(parsed, long, 400, 80, fitted.FontSize+1, fitted.FontSize+1, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !larger.Truncated {
+		t.Fatalf("size %g was not the largest that fits", fitted.FontSize)
+	}
+
+	truncated, err := layoutText(parsed, strings.Repeat(long, 10), 400, 80, 8, 32, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated.Truncated || truncated.FontSize != 8 || truncated.Height > 80 {
+		t.Fatalf("overlong text: size %g, height %g, truncated %v", truncated.FontSize, truncated.Height, truncated.Truncated)
+	}
+	if last := truncated.Lines[len(truncated.Lines)-1]; !strings.HasSuffix(last, ellipsis) {
+		t.Fatalf("last line %q has no ellipsis", last)
+	}
+}
+
+func TestRenderAnnotationGolden(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+	}{
+		{"short", "a cheerful octopus"},
+		{"long", strings.Repeat("a melancholy lighthouse keeper painting storms in gouache ", 3)},
+		{"overflow", strings.Repeat("an anxious heron reading tea leaves at dawn ", 20)},
+		{"multibyte", "Ünïcödé café naïve — Ελληνικά κείμενο και Кириллица pneumonoultramicroscopicsilicovolcanoconiosis"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := AnnotateImage(goldenSource(), Options{Caption: tc.text, BandPct: 0.25, Font: FontOptions{Family: FamilyGo}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", "layout-"+tc.name+".png"), got)
+		})
+	}
+}
+
+// goldenSource is a deterministic gradient so that the band color is stable.
+func goldenSource() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 320; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x / 40 * 30), G: 90, B: uint8(y / 50 * 50), A: 255})
+		}
+	}
+	return img
+}
+
+// compareGolden allows a sliver of antialiasing drift so that the goldens
+// survive floating point differences between platforms.
+func compareGolden(t *testing.T, path string, got image.Image) {
+	t.Helper()
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := png.Encode(file, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	defer file.Close()
+	want, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds %v, want %v", got.Bounds(), want.Bounds())
+	}
+	differing := 0
+	bounds := got.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := got.At(x, y).RGBA()
+			r2, g2, b2, _ := want.At(x, y).RGBA()
+			if channelDiff(r1, r2) > 8 || channelDiff(g1, g2) > 8 || channelDiff(b1, b2) > 8 {
+				differing++
+			}
+		}
+	}
+	if limit := bounds.Dx() * bounds.Dy() / 200; differing > limit {
+		t.Fatalf("%d pixels differ from %s (limit %d)", differing, path, limit)
+	}
+}
+
+func channelDiff(a, b uint32) uint32 {
+	a, b = a>>8, b>>8
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
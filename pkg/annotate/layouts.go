@@ -0,0 +1,262 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"git.sr.ht/~sbinet/gg"
+)
+
+const (
+	LayoutBottomBand = "bottom-band"
+	LayoutTopBand    = "top-band"
+	LayoutOverlay    = "overlay"
+	LayoutSidePanel  = "side-panel"
+	LayoutPolaroid   = "polaroid"
+	LayoutCard       = "card"
+
+	// titleScale enlarges the title font relative to the caption font.
+	titleScale = 1.25
+	// overlayOpacity is the alpha of the box drawn behind overlay text.
+	// ChooseColors measures contrast against the box blended over the
+	// lightest or darkest pixel it can cover.
+	overlayOpacity = 0.85
+)
+
+// Layouts lists the annotation layouts in the order they are documented.
+var Layouts = []string{LayoutBottomBand, LayoutTopBand, LayoutOverlay, LayoutSidePanel, LayoutPolaroid, LayoutCard}
+
+// ValidateLayout reports a layout name that is not one of Layouts. The empty
+// name is the default bottom band.
+func ValidateLayout(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, layout := range Layouts {
+		if name == layout {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown annotation layout %q (want one of %s)", name, strings.Join(Layouts, ", "))
+}
+
+// textBlocks is a title laid out above a caption.
+type textBlocks struct {
+	title   textLayout
+	caption textLayout
+	gap     float64
+}
+
+func (blocks textBlocks) height() float64 {
+	return blocks.title.Height + blocks.gap + blocks.caption.Height
+}
+
+// fitTitle lays the title out in the title weight (bold unless the font
+// options name one) and a larger size range than the caption.
+func fitTitle(title string, options Options, imageWidth int, width, height float64) (textLayout, error) {
+	font := options.Font
+	if font.Weight == "" {
+		font.Weight = WeightBold
+	}
+	return fitText(title, font, options.FontDir, imageWidth, titleScale, width, height)
+}
+
+// fitBlocks fits the title and caption into one box. The title is given at
+// most two fifths of the height when there is a caption to share it with.
+func fitBlocks(options Options, imageWidth int, width, height float64) (textBlocks, error) {
+	title, caption := options.Title, options.Caption
+	blocks := textBlocks{}
+	if strings.TrimSpace(title) != "" {
+		titleHeight := height
+		if strings.TrimSpace(caption) != "" {
+			titleHeight = height * 0.4
+		}
+		layout, err := fitTitle(title, options, imageWidth, width, titleHeight)
+		if err != nil {
+			return textBlocks{}, err
+		}
+		blocks.title = layout
+		if strings.TrimSpace(caption) != "" {
+			blocks.gap = layout.LineHeight * 0.5
+		}
+	}
+	if strings.TrimSpace(caption) != "" {
+		layout, err := fitText(caption, options.Font, options.FontDir, imageWidth, 1, width, height-blocks.title.Height-blocks.gap)
+		if err != nil {
+			return textBlocks{}, err
+		}
+		blocks.caption = layout
+	}
+	return blocks, nil
+}
+
+func drawBlocks(gc *gg.Context, blocks textBlocks, centerX, top float64) {
+	if len(blocks.title.Lines) > 0 {
+		drawLines(gc, blocks.title, centerX, top)
+	}
+	if len(blocks.caption.Lines) > 0 {
+		drawLines(gc, blocks.caption, centerX, top+blocks.title.Height+blocks.gap)
+	}
+}
+
+// renderBand adds a band of the image's dominant color above or below it,
+// sized to the text it holds.
+func renderBand(img image.Image, top bool, annoPct float64, options Options, col, textColor color.Color) (image.Image, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	marginHeight := float64(height) * 0.025
+	blocks, err := fitBlocks(options, width, float64(width)*0.95, float64(height)*annoPct-marginHeight*2)
+	if err != nil {
+		return nil, err
+	}
+	bandHeight := int(math.Ceil(blocks.height() + marginHeight*2))
+
+	newImg := image.NewRGBA(image.Rect(0, 0, width, height+bandHeight))
+	imageTop, bandTop, edge := 0, height, height
+	if top {
+		imageTop, bandTop, edge = bandHeight, 0, bandHeight
+	}
+	draw.Draw(newImg, image.Rect(0, imageTop, width, imageTop+height), img, img.Bounds().Min, draw.Src)
+	draw.Draw(newImg, image.Rect(0, bandTop, width, bandTop+bandHeight), &image.Uniform{col}, image.Point{}, draw.Src)
+
+	gc := gg.NewContextForImage(newImg)
+	gc.SetColor(darkenColor(col))
+	gc.SetLineWidth(2)
+	gc.DrawLine(0, float64(edge), float64(width), float64(edge))
+	gc.Stroke()
+
+	gc.SetColor(textColor)
+	drawBlocks(gc, blocks, float64(width)/2, float64(bandTop)+marginHeight)
+	return gc.Image(), nil
+}
+
+// renderOverlay draws the text on a translucent rounded box inset at the
+// bottom of the image, leaving the image size unchanged.
+func renderOverlay(img image.Image, annoPct float64, options Options, col, textColor color.Color) (image.Image, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	inset := float64(height) * 0.025
+	boxWidth := float64(width) * 0.9
+	blocks, err := fitBlocks(options, width, boxWidth-inset*2, float64(height)*annoPct-inset*2)
+	if err != nil {
+		return nil, err
+	}
+	boxHeight := blocks.height() + inset*2
+	boxLeft := (float64(width) - boxWidth) / 2
+	boxTop := float64(height) - inset*2 - boxHeight
+
+	gc := gg.NewContextForImage(img)
+	r, g, b, _ := col.RGBA()
+	gc.SetRGBA(float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff, overlayOpacity)
+	gc.DrawRoundedRectangle(boxLeft, boxTop, boxWidth, boxHeight, inset)
+	gc.Fill()
+
+	gc.SetColor(textColor)
+	drawBlocks(gc, blocks, float64(width)/2, boxTop+inset)
+	return gc.Image(), nil
+}
+
+// renderSidePanel widens the image with a panel on the right, two fifths of
+// the image width, and centers the text in it vertically.
+func renderSidePanel(img image.Image, options Options, col, textColor color.Color) (image.Image, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	panelWidth := int(math.Round(float64(width) * 0.4))
+	padding := float64(panelWidth) * 0.08
+	blocks, err := fitBlocks(options, width, float64(panelWidth)-padding*2, float64(height)-padding*2)
+	if err != nil {
+		return nil, err
+	}
+
+	newImg := image.NewRGBA(image.Rect(0, 0, width+panelWidth, height))
+	draw.Draw(newImg, image.Rect(0, 0, width, height), img, img.Bounds().Min, draw.Src)
+	draw.Draw(newImg, image.Rect(width, 0, width+panelWidth, height), &image.Uniform{col}, image.Point{}, draw.Src)
+
+	gc := gg.NewContextForImage(newImg)
+	gc.SetColor(darkenColor(col))
+	gc.SetLineWidth(2)
+	gc.DrawLine(float64(width), 0, float64(width), float64(height))
+	gc.Stroke()
+
+	gc.SetColor(textColor)
+	drawBlocks(gc, blocks, float64(width)+float64(panelWidth)/2, (float64(height)-blocks.height())/2)
+	return gc.Image(), nil
+}
+
+var (
+	polaroidPaper = color.RGBA{R: 0xFA, G: 0xFA, B: 0xF7, A: 0xFF}
+	polaroidInk   = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xFF}
+)
+
+// renderPolaroid mounts the image on paper (off-white, see ChooseColors) with
+// a narrow border on three sides and the text on the deeper bottom strip.
+func renderPolaroid(img image.Image, annoPct float64, options Options, paper, ink color.Color) (image.Image, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	border := int(math.Round(float64(width) * 0.05))
+	marginHeight := float64(height) * 0.025
+	blocks, err := fitBlocks(options, width, float64(width), float64(height)*annoPct-marginHeight*2)
+	if err != nil {
+		return nil, err
+	}
+	strip := max(int(math.Ceil(blocks.height()+marginHeight*2)), border*3)
+
+	newImg := image.NewRGBA(image.Rect(0, 0, width+border*2, height+border+strip))
+	draw.Draw(newImg, newImg.Bounds(), &image.Uniform{paper}, image.Point{}, draw.Src)
+	draw.Draw(newImg, image.Rect(border, border, border+width, border+height), img, img.Bounds().Min, draw.Src)
+
+	gc := gg.NewContextForImage(newImg)
+	gc.SetColor(ink)
+	textTop := float64(border+height) + (float64(strip)-blocks.height())/2
+	drawBlocks(gc, blocks, float64(width)/2+float64(border), textTop)
+	return gc.Image(), nil
+}
+
+// renderCard frames the image in its dominant color with the title in a
+// header above it and the caption in a footer below.
+func renderCard(img image.Image, annoPct float64, options Options, col, textColor color.Color) (image.Image, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	border := int(math.Round(float64(width) * 0.04))
+	marginHeight := float64(height) * 0.025
+	textWidth := float64(width) * 0.95
+	title, err := fitTitle(options.Title, options, width, textWidth, float64(height)*annoPct*0.5-marginHeight*2)
+	if err != nil {
+		return nil, err
+	}
+	footer, err := fitText(options.Caption, options.Font, options.FontDir, width, 1, textWidth, float64(height)*annoPct-marginHeight*2)
+	if err != nil {
+		return nil, err
+	}
+	headerHeight, footerHeight := border, border
+	if len(title.Lines) > 0 {
+		headerHeight = max(border, int(math.Ceil(title.Height+marginHeight*2)))
+	}
+	if len(footer.Lines) > 0 {
+		footerHeight = max(border, int(math.Ceil(footer.Height+marginHeight*2)))
+	}
+
+	newImg := image.NewRGBA(image.Rect(0, 0, width+border*2, height+headerHeight+footerHeight))
+	draw.Draw(newImg, newImg.Bounds(), &image.Uniform{col}, image.Point{}, draw.Src)
+	draw.Draw(newImg, image.Rect(border, headerHeight, border+width, headerHeight+height), img, img.Bounds().Min, draw.Src)
+
+	gc := gg.NewContextForImage(newImg)
+	gc.SetColor(darkenColor(col))
+	gc.SetLineWidth(2)
+	gc.DrawRectangle(float64(border), float64(headerHeight), float64(width), float64(height))
+	gc.Stroke()
+
+	gc.SetColor(textColor)
+	centerX := float64(width)/2 + float64(border)
+	if len(title.Lines) > 0 {
+		drawLines(gc, title, centerX, (float64(headerHeight)-title.Height)/2)
+	}
+	if len(footer.Lines) > 0 {
+		drawLines(gc, footer, centerX, float64(headerHeight+height)+(float64(footerHeight)-footer.Height)/2)
+	}
+	return gc.Image(), nil
+}
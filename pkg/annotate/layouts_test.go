@@ -0,0 +1,74 @@
+package annotate
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	layoutTitle   = "The Cheerful Octopus"
+	layoutCaption = "a cheerful octopus juggling teacups on a rainy pier at dusk"
+)
+
+func TestRenderAnnotationLayoutsGolden(t *testing.T) {
+	for _, layout := range Layouts {
+		t.Run(layout, func(t *testing.T) {
+			options := Options{Caption: layoutCaption, Title: layoutTitle, Layout: layout, BandPct: 0.25, Font: FontOptions{Family: FamilyGo}}
+			got, err := AnnotateImage(goldenSource(), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", "layout-"+layout+".png"), got)
+		})
+	}
+}
+
+func TestRenderAnnotationLayoutSizes(t *testing.T) {
+	source := goldenSource()
+	size := func(layout string) image.Rectangle {
+		t.Helper()
+		out, err := AnnotateImage(source, Options{Caption: layoutCaption, Layout: layout, BandPct: 0.25, Font: FontOptions{Family: FamilyGo}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Bounds()
+	}
+	if got := size(LayoutOverlay); got != source.Bounds() {
+		t.Errorf("overlay changed the image size to %v", got)
+	}
+	if got := size(LayoutSidePanel); got.Dy() != 200 || got.Dx() != 320+128 {
+		t.Errorf("side panel size %v", got)
+	}
+	bottom, top := size(LayoutBottomBand), size(LayoutTopBand)
+	if bottom != top || bottom.Dx() != 320 || bottom.Dy() <= 200 {
+		t.Errorf("band sizes bottom %v, top %v", bottom, top)
+	}
+}
+
+// The top band used to paint its background at the top and the text at the
+// bottom; the image must now sit below the band, untouched.
+func TestRenderAnnotationTopBandMovesImageDown(t *testing.T) {
+	source := goldenSource()
+	out, err := AnnotateImage(source, Options{Caption: layoutCaption, Layout: LayoutTopBand, BandPct: 0.25, Font: FontOptions{Family: FamilyGo}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	band := out.Bounds().Dy() - 200
+	for _, point := range []image.Point{{0, 10}, {319, 190}, {160, 100}} {
+		if got, want := out.At(point.X, point.Y+band), source.At(point.X, point.Y); got != want {
+			t.Fatalf("pixel %v is %v, want %v", point, got, want)
+		}
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	for _, layout := range append([]string{""}, Layouts...) {
+		if err := ValidateLayout(layout); err != nil {
+			t.Errorf("ValidateLayout(%q): %v", layout, err)
+		}
+	}
+	if err := ValidateLayout("diagonal"); err == nil {
+		t.Error("expected an unknown layout to be rejected")
+	}
+}
@@ -25,7 +25,8 @@ import (
 
 var (
 	openFile     = os.OpenFile
-	annotateFunc = annotate.Annotate
+	annotateFunc = annotate.AnnotateFile
+	colorsFunc   = annotate.FileColors
 	httpGet      = http.Get
 	ioCopy       = io.Copy
 )
@@ -49,8 +50,14 @@ type ImageData struct {
 	Address         string `json:"-"`
 }
 
+// ImageOptions controls the steps after download. AnnotatedPath is where the
+// annotated PNG is written; empty means the file of the same name in the
+// "annotated" sibling of the output folder. The caption defaults to the terse
+// prompt.
 type ImageOptions struct {
-	Annotate bool
+	Annotate      bool
+	AnnotatedPath string
+	Annotation    annotate.Options
 }
 
 // msSince returns elapsed milliseconds since t.
@@ -74,11 +81,37 @@ Favor bold contrast, theatrical color relationships, eccentric character details
 The subject should feel odd, memorable, and slightly excessive, with the peculiar generated attributes visibly driving the scene.
 Honor any explicit color-palette or monochrome constraint in the prompt, but push that constraint as far as possible through contrast, composition, texture, and weirdness.`
 
+// ImageResult reports where RequestImageWithResult wrote the image and what
+// the provider returned. Payload is nil when no image was requested because
+// there is no API key. Colors are the ones the annotation was drawn in.
+type ImageResult struct {
+	GeneratedPath string
+	AnnotatedPath string
+	Payload       *Payload
+	Colors        *annotate.Colors
+}
+
 func RequestImageWithOptions(outputPath string, imageData *ImageData, config prompt.AiConfiguration, options ImageOptions) error {
+	_, err := RequestImageWithResult(outputPath, imageData, config, options)
+	return err
+}
+
+// RequestImageWithResult requests an image, checks that what comes back is
+// a complete image, stores it as PNG and annotates it when asked to.
+func RequestImageWithResult(outputPath string, imageData *ImageData, config prompt.AiConfiguration, options ImageOptions) (ImageResult, error) {
+	result := ImageResult{}
+	err := requestImage(outputPath, imageData, config, options, &result)
+	return result, err
+}
+
+func requestImage(outputPath string, imageData *ImageData, config prompt.AiConfiguration, options ImageOptions, result *ImageResult) error {
 	start := time.Now()
 	generated := outputPath
 	_ = os.MkdirAll(generated, 0o750)
 	annotated := strings.ReplaceAll(generated, "/generated", "/annotated")
+	if options.AnnotatedPath != "" {
+		annotated = filepath.Dir(options.AnnotatedPath)
+	}
 	if options.Annotate {
 		_ = os.MkdirAll(annotated, 0o750)
 	}
@@ -156,6 +189,9 @@ func RequestImageWithOptions(outputPath string, imageData *ImageData, config pro
 			placeholderDir = annotated
 		}
 		placeholder := filepath.Join(placeholderDir, fmt.Sprintf("%s.png", imageData.Filename))
+		if options.Annotate && options.AnnotatedPath != "" {
+			placeholder = options.AnnotatedPath
+		}
 		_ = os.WriteFile(placeholder, []byte{}, 0o600)
 		logger.Info("image.request.skip_no_api_key", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "durMs", msSince(start))
 		return nil
@@ -261,11 +297,18 @@ func RequestImageWithOptions(outputPath string, imageData *ImageData, config pro
 		if b64Data != "" {
 			decoded, decErr := base64.StdEncoding.DecodeString(b64Data)
 			if decErr == nil {
+				normalized, payload, err := normalizePayload(decoded)
+				if err != nil {
+					logger.InfoR("image.post.b64_invalid", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
+					return err
+				}
+				payload.Mode = "b64"
+				result.Payload = &payload
 				_ = os.Remove(fn)
-				if err := os.WriteFile(fn, decoded, 0o600); err != nil {
+				if err := os.WriteFile(fn, normalized, 0o600); err != nil {
 					return fmt.Errorf("write b64 image: %w", err)
 				}
-				logger.InfoG("image.post.b64_fallback", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "bytes", len(decoded))
+				logger.InfoG("image.post.b64_fallback", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "bytes", len(decoded), "format", payload.Format)
 				progressMgr.UpdateDress(imageData.Series, imageData.Address, func(dd *model.DalleDress) { dd.GeneratedPath = fn; dd.DownloadMode = "b64" })
 				progressMgr.Transition(imageData.Series, imageData.Address, progress.PhaseImageDownload)
 				logger.Info("image.post.mode", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "mode", "b64")
@@ -300,32 +343,67 @@ func RequestImageWithOptions(outputPath string, imageData *ImageData, config pro
 			return err
 		}
 		defer func() { _ = imageResp.Body.Close() }()
+		if err := checkDownloadStatus(imageResp); err != nil {
+			logger.InfoR("image.download.status", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "status", imageResp.StatusCode)
+			return err
+		}
+
+		// One byte past the limit is read so that normalizePayload can tell
+		// an oversized download from one that is exactly the limit.
+		var body bytes.Buffer
+		written, err := ioCopy(&body, io.LimitReader(imageResp.Body, int64(maxPayloadSize)+1))
+		if err != nil {
+			logger.InfoR("image.download.read_error", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
+			return err
+		}
+		normalized, payload, err := normalizePayload(body.Bytes())
+		if err != nil {
+			logger.InfoR("image.download.invalid", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
+			return err
+		}
+		payload.Mode = "url"
+		result.Payload = &payload
 
 		_ = os.Remove(fn)
 		file, err := openFile(fn, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
 		if err != nil {
 			return fmt.Errorf("failed to open file: %s", fn)
 		}
-		defer func() { _ = file.Close() }()
-
-		written, err := ioCopy(file, imageResp.Body)
-		if err != nil {
-			logger.InfoR("image.download.read_error", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
-			return err
+		if _, err := file.Write(normalized); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("write image: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("write image: %w", err)
 		}
-		logger.InfoG("image.download.end", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "status", imageResp.StatusCode, "durMs", time.Since(dlStart).Milliseconds(), "bytes", written)
+		logger.InfoG("image.download.end", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "status", imageResp.StatusCode, "durMs", time.Since(dlStart).Milliseconds(), "bytes", written, "format", payload.Format, "width", payload.Width, "height", payload.Height)
 	}
+	result.GeneratedPath = fn
 	if !options.Annotate {
 		progressMgr.UpdateDress(imageData.Series, imageData.Address, func(dd *model.DalleDress) { dd.GeneratedPath = fn })
 		logger.InfoG("image.request.end", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "durMs", msSince(start))
 		return nil
 	}
 
-	path, err := annotateFunc(imageData.TersePrompt, fn, "bottom", 0.2)
+	path := options.AnnotatedPath
+	if path == "" {
+		path = filepath.Join(annotated, filepath.Base(fn))
+	}
+	annotation := options.Annotation
+	if annotation.Caption == "" {
+		annotation.Caption = imageData.TersePrompt
+	}
+	if err := annotateFunc(fn, path, annotation); err != nil {
+		logger.Info("image.annotate.error", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
+		return fmt.Errorf("error annotating image: %v", err)
+	}
+	colors, err := colorsFunc(fn, annotation)
 	if err != nil {
 		logger.Info("image.annotate.error", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "error", err.Error())
 		return fmt.Errorf("error annotating image: %v", err)
 	}
+	result.AnnotatedPath = path
+	result.Colors = &colors
 	progressMgr.UpdateDress(imageData.Series, imageData.Address, func(dd *model.DalleDress) { dd.AnnotatedPath = path; dd.GeneratedPath = fn })
 	progressMgr.Transition(imageData.Series, imageData.Address, progress.PhaseAnnotate)
 	logger.InfoG("image.annotate.end", "series", imageData.Series, "addr", imageData.Address, "file", imageData.Filename, "path", strings.TrimSpace(path))
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/prompt"
 )
 
@@ -46,9 +47,11 @@ func TestRequestImage_MockSuccess(t *testing.T) {
 	// Patch file operations
 	oldOpenFile := openFile
 	oldAnnotate := annotateFunc
+	oldColors := colorsFunc
 	defer func() {
 		openFile = oldOpenFile
 		annotateFunc = oldAnnotate
+		colorsFunc = oldColors
 	}()
 
 	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
@@ -62,8 +65,11 @@ func TestRequestImage_MockSuccess(t *testing.T) {
 	}
 	defer func() { ioCopy = oldIoCopy }()
 
-	annotateFunc = func(text, fileName, location string, annoPct float64) (string, error) {
-		return strings.Replace(fileName, "generated/", "annotated/", 1), nil
+	annotateFunc = func(inPath, outPath string, _ annotate.Options) error {
+		return nil
+	}
+	colorsFunc = func(path string, _ annotate.Options) (annotate.Colors, error) {
+		return annotate.Colors{}, nil
 	}
 
 	// Patch OpenAI API endpoint to use our mock server
@@ -105,7 +111,7 @@ func TestRequestImageOmitsStyleByDefault(t *testing.T) {
 
 	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("PNGDATA"))
+		_, _ = w.Write(encodedImage(t, "png"))
 	}))
 	defer imageServer.Close()
 
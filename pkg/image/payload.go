@@ -0,0 +1,116 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stdimage "image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrInvalidPayload is wrapped by every error for a downloaded image that
+// cannot be used: a failed download, an error page, or bytes that do not
+// decode as an image.
+var ErrInvalidPayload = errors.New("invalid image payload")
+
+// maxPayloadSize and maxPayloadDimension bound what is accepted from the
+// provider: a download is read no further than maxPayloadSize bytes, and an
+// image wider or taller than maxPayloadDimension pixels is rejected before
+// its pixels are decoded. Provider images are a few megabytes and at most a
+// couple of thousand pixels on a side.
+var (
+	maxPayloadSize      = 64 << 20
+	maxPayloadDimension = 8192
+)
+
+// PayloadError describes why a payload was rejected.
+type PayloadError struct {
+	Reason      string
+	ContentType string
+	Size        int
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("%s: %s (%s, %d bytes)", ErrInvalidPayload, e.Reason, e.ContentType, e.Size)
+}
+
+func (e *PayloadError) Unwrap() error { return ErrInvalidPayload }
+
+// Payload records what the provider returned for an image. Format is the
+// decoded format before any transcoding to PNG.
+type Payload struct {
+	Format     string `json:"format"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Size       int    `json:"size"`
+	Transcoded bool   `json:"transcoded,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+}
+
+// normalizePayload checks that data is a complete image and returns it as
+// PNG bytes. PNGs are kept byte for byte; other formats are transcoded.
+func normalizePayload(data []byte) ([]byte, Payload, error) {
+	contentType := http.DetectContentType(data)
+	reject := func(reason string) ([]byte, Payload, error) {
+		return nil, Payload{}, &PayloadError{Reason: reason, ContentType: contentType, Size: len(data)}
+	}
+	if len(data) == 0 {
+		return reject("empty body")
+	}
+	if len(data) > maxPayloadSize {
+		return reject(fmt.Sprintf("larger than %d bytes", maxPayloadSize))
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case strings.HasPrefix(contentType, "text/html"), strings.HasPrefix(contentType, "text/xml"):
+		return reject("HTML error page")
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		return reject("JSON body")
+	case strings.HasPrefix(contentType, "text/"):
+		return reject("text body")
+	}
+	config, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return reject("does not decode: " + err.Error())
+	}
+	if config.Width > maxPayloadDimension || config.Height > maxPayloadDimension {
+		return reject(fmt.Sprintf("%dx%d is larger than %dx%d", config.Width, config.Height, maxPayloadDimension, maxPayloadDimension))
+	}
+	// A full decode, not just the header, so that truncated files are caught.
+	img, format, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return reject("does not decode: " + err.Error())
+	}
+	bounds := img.Bounds()
+	payload := Payload{Format: format, Width: bounds.Dx(), Height: bounds.Dy(), Size: len(data)}
+	if payload.Width == 0 || payload.Height == 0 {
+		return reject("image has no pixels")
+	}
+	if format == "png" {
+		return data, payload, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, Payload{}, fmt.Errorf("transcode %s to png: %w", format, err)
+	}
+	payload.Transcoded = true
+	return buf.Bytes(), payload, nil
+}
+
+// checkDownloadStatus rejects any image download that did not return 200.
+func checkDownloadStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	return &PayloadError{
+		Reason:      fmt.Sprintf("download returned HTTP %d", resp.StatusCode),
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        int(max(resp.ContentLength, 0)),
+	}
+}
@@ -0,0 +1,156 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/prompt"
+)
+
+func encodedImage(t *testing.T, format string) []byte {
+	t.Helper()
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 24, 16))
+	for x := 0; x < 24; x++ {
+		img.Set(x, x%16, color.RGBA{R: uint8(x * 10), G: 0x80, B: 0x40, A: 0xFF})
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizePayload(t *testing.T) {
+	source := encodedImage(t, "png")
+	kept, payload, err := normalizePayload(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(kept, source) || payload.Format != "png" || payload.Transcoded || payload.Width != 24 || payload.Height != 16 {
+		t.Fatalf("unexpected PNG payload %+v", payload)
+	}
+
+	transcoded, payload, err := normalizePayload(encodedImage(t, "jpeg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Format != "jpeg" || !payload.Transcoded || payload.Width != 24 || payload.Height != 16 {
+		t.Fatalf("unexpected JPEG payload %+v", payload)
+	}
+	if _, format, err := stdimage.DecodeConfig(bytes.NewReader(transcoded)); err != nil || format != "png" {
+		t.Fatalf("expected a transcoded PNG, got %q, %v", format, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"html":      []byte("<!DOCTYPE html><html><body>502 Bad Gateway</body></html>"),
+		"json":      []byte(`{"error":{"message":"expired"}}`),
+		"text":      []byte("Access denied"),
+		"truncated": source[:len(source)/2],
+	} {
+		if _, _, err := normalizePayload(data); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: expected ErrInvalidPayload, got %v", name, err)
+		}
+	}
+}
+
+func TestRequestImageWithResultTranscodesB64(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	b64 := base64.StdEncoding.EncodeToString(encodedImage(t, "jpeg"))
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"b64_json":"` + b64 + `"}]}`))
+	}))
+	defer openaiServer.Close()
+
+	config := prompt.DefaultAiConfiguration()
+	config.ImageURL = openaiServer.URL
+	outputPath := t.TempDir()
+	result, err := RequestImageWithResult(outputPath, &ImageData{Filename: "b64"}, config, ImageOptions{})
+	if err != nil {
+		t.Fatalf("RequestImageWithResult: %v", err)
+	}
+	if result.Payload == nil || result.Payload.Mode != "b64" || !result.Payload.Transcoded || result.GeneratedPath != filepath.Join(outputPath, "b64.png") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	file, err := os.Open(result.GeneratedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := png.Decode(file); err != nil {
+		t.Fatalf("stored image is not a PNG: %v", err)
+	}
+}
+
+func TestRequestImageRejectsBadDownloads(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	oldSize, oldDimension := maxPayloadSize, maxPayloadDimension
+	maxPayloadSize, maxPayloadDimension = 2048, 32
+	defer func() { maxPayloadSize, maxPayloadDimension = oldSize, oldDimension }()
+	limits := map[string]string{"oversized": "larger than 2048 bytes", "too many pixels": "64x1 is larger than 32x32"}
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"url":"http://mockimage.com/image.png"}]}`))
+	}))
+	defer openaiServer.Close()
+
+	for name, serve := range map[string]http.HandlerFunc{
+		"forbidden": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write(encodedImage(t, "png"))
+		},
+		"html": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("<html><body>AuthenticationFailed</body></html>"))
+		},
+		"oversized": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(append(encodedImage(t, "png"), make([]byte, 4096)...))
+		},
+		"too many pixels": func(w http.ResponseWriter, r *http.Request) {
+			img := stdimage.NewGray(stdimage.Rect(0, 0, 64, 1))
+			_ = png.Encode(w, img)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			imageServer := httptest.NewServer(serve)
+			defer imageServer.Close()
+			oldHTTPGet := httpGet
+			httpGet = func(url string) (*http.Response, error) {
+				if strings.Contains(url, "mockimage.com") {
+					return http.Get(imageServer.URL)
+				}
+				return http.Get(url)
+			}
+			defer func() { httpGet = oldHTTPGet }()
+
+			config := prompt.DefaultAiConfiguration()
+			config.ImageURL = openaiServer.URL
+			outputPath := t.TempDir()
+			_, err := RequestImageWithResult(outputPath, &ImageData{Filename: "bad"}, config, ImageOptions{})
+			if !errors.Is(err, ErrInvalidPayload) {
+				t.Fatalf("expected ErrInvalidPayload, got %v", err)
+			}
+			if reason := limits[name]; !strings.Contains(err.Error(), reason) {
+				t.Fatalf("expected %q, got %v", reason, err)
+			}
+			if _, err := os.Stat(filepath.Join(outputPath, "bad.png")); !os.IsNotExist(err) {
+				t.Fatalf("expected no file for a rejected payload, got %v", err)
+			}
+		})
+	}
+}
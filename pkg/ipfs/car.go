@@ -0,0 +1,170 @@
+package ipfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WriteCAR writes a CARv1 archive of blocks with the given roots. A block
+// that appears more than once is written once.
+func WriteCAR(w io.Writer, roots []CID, blocks []Block) error {
+	if len(roots) == 0 {
+		return fmt.Errorf("a CAR file needs at least one root")
+	}
+	// The header is the DAG-CBOR map {"roots": [...], "version": 1}; keys
+	// sort by length, so roots comes first.
+	header := []byte{0xa2, 0x65}
+	header = append(header, "roots"...)
+	header = cborHead(header, 4, uint64(len(roots)))
+	for _, root := range roots {
+		link := append([]byte{0x00}, root.Bytes()...)
+		header = append(header, 0xd8, 42)
+		header = append(cborHead(header, 2, uint64(len(link))), link...)
+	}
+	header = append(header, 0x67)
+	header = append(header, "version"...)
+	header = append(header, 0x01)
+
+	out := bufio.NewWriter(w)
+	if _, err := out.Write(appendBytes(nil, header)); err != nil {
+		return err
+	}
+	written := map[CID]bool{}
+	for _, block := range blocks {
+		if written[block.CID] {
+			continue
+		}
+		written[block.CID] = true
+		cid := block.CID.Bytes()
+		if _, err := out.Write(binary.AppendUvarint(nil, uint64(len(cid)+len(block.Data)))); err != nil {
+			return err
+		}
+		if _, err := out.Write(cid); err != nil {
+			return err
+		}
+		if _, err := out.Write(block.Data); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// ReadCAR reads an archive written by WriteCAR and checks that every block
+// hashes to its CID.
+func ReadCAR(r io.Reader) ([]CID, []Block, error) {
+	in := bufio.NewReader(r)
+	header, err := readSection(in)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read CAR header: %w", err)
+	}
+	roots, err := parseHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks := []Block{}
+	for {
+		section, err := readSection(in)
+		if errors.Is(err, io.EOF) {
+			return roots, blocks, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read CAR block: %w", err)
+		}
+		cid, data, err := splitBlock(section)
+		if err != nil {
+			return nil, nil, err
+		}
+		if Sum(cid.Codec(), data) != cid {
+			return nil, nil, fmt.Errorf("block %s does not match its CID", cid)
+		}
+		blocks = append(blocks, Block{CID: cid, Data: data})
+	}
+}
+
+func readSection(in *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(in)
+	if err != nil {
+		return nil, err
+	}
+	// The size comes from the file, so the section grows with the bytes that
+	// are actually there rather than being allocated up front.
+	var section bytes.Buffer
+	if n, err := io.CopyN(&section, in, int64(size)); err != nil || n != int64(size) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return section.Bytes(), nil
+}
+
+// splitBlock cuts a block section into its CID and data.
+func splitBlock(section []byte) (CID, []byte, error) {
+	_, n := binary.Uvarint(section)
+	if n <= 0 {
+		return CID{}, nil, fmt.Errorf("malformed CAR block")
+	}
+	_, m := binary.Uvarint(section[n:])
+	if m <= 0 || len(section) < n+m+2 {
+		return CID{}, nil, fmt.Errorf("malformed CAR block")
+	}
+	end := n + m + 2 + int(section[n+m+1])
+	if end > len(section) {
+		return CID{}, nil, fmt.Errorf("malformed CAR block")
+	}
+	cid, err := Cast(section[:end])
+	return cid, section[end:], err
+}
+
+// parseHeader reads the roots from the header WriteCAR writes.
+func parseHeader(header []byte) ([]CID, error) {
+	prefix := append([]byte{0xa2, 0x65}, "roots"...)
+	if len(header) < len(prefix)+1 || string(header[:len(prefix)]) != string(prefix) || header[len(prefix)]>>5 != 4 {
+		return nil, fmt.Errorf("unsupported CAR header")
+	}
+	count := int(header[len(prefix)] & 0x1f)
+	if count >= 24 {
+		return nil, fmt.Errorf("unsupported CAR header")
+	}
+	rest := header[len(prefix)+1:]
+	roots := []CID{}
+	for range count {
+		if len(rest) < 4 || rest[0] != 0xd8 || rest[1] != 42 || rest[2]>>5 != 2 {
+			return nil, fmt.Errorf("unsupported CAR root")
+		}
+		length, skip := int(rest[2]&0x1f), 3
+		if length == 24 {
+			length, skip = int(rest[3]), 4
+		}
+		if len(rest) < skip+length || length < 1 {
+			return nil, fmt.Errorf("malformed CAR root")
+		}
+		cid, err := Cast(rest[skip+1 : skip+length])
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, cid)
+		rest = rest[skip+length:]
+	}
+	if string(rest) != "\x67version\x01" {
+		return nil, fmt.Errorf("unsupported CAR version")
+	}
+	return roots, nil
+}
+
+// cborHead appends a CBOR item head of the given major type and argument.
+func cborHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n < 1<<8:
+		return append(b, major<<5|24, byte(n))
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n < 1<<32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+	}
+}
@@ -0,0 +1,90 @@
+// Package ipfs computes IPFS content identifiers offline and packages blocks
+// as CAR files. Files are chunked the way `ipfs add --cid-version=1` does by
+// default (256 KiB chunks, raw leaves, a balanced DAG of up to 174 links per
+// node), so the CIDs here match the ones a node reports for the same bytes.
+package ipfs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// CodecRaw marks a block that is plain bytes; CodecDagPB a UnixFS
+	// (dag-pb) node.
+	CodecRaw   = 0x55
+	CodecDagPB = 0x70
+
+	multihashSHA256 = 0x12
+)
+
+var base32Lower = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CID is a version 1 content identifier with a SHA-256 multihash. The zero
+// value is undefined.
+type CID struct {
+	binary string
+}
+
+// Sum returns the CID of data stored as a block of the given codec.
+func Sum(codec uint64, data []byte) CID {
+	digest := sha256.Sum256(data)
+	b := binary.AppendUvarint(nil, 1)
+	b = binary.AppendUvarint(b, codec)
+	b = append(b, multihashSHA256, byte(len(digest)))
+	return CID{binary: string(append(b, digest[:]...))}
+}
+
+// Parse reads a CID formatted by String.
+func Parse(s string) (CID, error) {
+	if !strings.HasPrefix(s, "b") {
+		return CID{}, fmt.Errorf("CID %q is not base32 (want a leading b)", s)
+	}
+	decoded, err := base32Lower.DecodeString(strings.ToUpper(s[1:]))
+	if err != nil {
+		return CID{}, fmt.Errorf("CID %q: %w", s, err)
+	}
+	return Cast(decoded)
+}
+
+// Cast reads a CID in its binary form.
+func Cast(b []byte) (CID, error) {
+	version, n := binary.Uvarint(b)
+	if n <= 0 || version != 1 {
+		return CID{}, fmt.Errorf("not a version 1 CID")
+	}
+	_, m := binary.Uvarint(b[n:])
+	if m <= 0 || len(b) < n+m+2 || int(b[n+m+1]) != len(b)-n-m-2 {
+		return CID{}, fmt.Errorf("malformed CID")
+	}
+	return CID{binary: string(b)}, nil
+}
+
+// Defined reports whether the CID is set.
+func (c CID) Defined() bool {
+	return c.binary != ""
+}
+
+// Bytes is the binary form of the CID.
+func (c CID) Bytes() []byte {
+	return []byte(c.binary)
+}
+
+// Codec is the codec of the block the CID names.
+func (c CID) Codec() uint64 {
+	b := []byte(c.binary)
+	_, n := binary.Uvarint(b)
+	codec, _ := binary.Uvarint(b[n:])
+	return codec
+}
+
+// String formats the CID in lowercase base32, as IPFS does for version 1.
+func (c CID) String() string {
+	if !c.Defined() {
+		return ""
+	}
+	return "b" + strings.ToLower(base32Lower.EncodeToString([]byte(c.binary)))
+}
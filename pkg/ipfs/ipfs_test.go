@@ -0,0 +1,197 @@
+package ipfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestKnownCIDs(t *testing.T) {
+	data := make([]byte, 2*ChunkSize+10)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	subdir := mustDirectory(t, []Entry{{Name: "empty", Node: File(nil)}})
+	for name, test := range map[string]struct {
+		node Node
+		want string
+	}{
+		"empty file":             {File(nil), "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+		"hello world":            {File([]byte("hello world")), "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"},
+		"empty directory":        {mustDirectory(t, nil), "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"},
+		"multi-chunk file":       {File(data), referenceFile(data)},
+		"directory with entries": {mustDirectory(t, []Entry{{Name: "sub", Node: subdir}, {Name: "hello.txt", Node: File([]byte("hello world"))}}), referenceDirectory()},
+	} {
+		if got := test.node.CID.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+	// The reference encoder agrees with the CIDs IPFS reports for single blocks.
+	if got := referenceString(referenceCID(0x55, []byte("hello world"))); got != "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e" {
+		t.Errorf("reference raw block: got %s", got)
+	}
+	if got := referenceString(referenceCID(0x70, protoBytes(1, protoVarint(1, 1)))); got != "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354" {
+		t.Errorf("reference empty directory: got %s", got)
+	}
+}
+
+// There is no IPFS node to run `ipfs add --cid-version=1` against here, so the
+// CIDs of multi-block DAGs are derived from the dag-pb and UnixFS specs with
+// the encoder below, written separately from unixfs.go: raw 256 KiB leaves
+// under a file node whose links carry an empty name and the child's size, and
+// directory links sorted by name.
+
+func referenceCID(codec byte, block []byte) []byte {
+	digest := sha256.Sum256(block)
+	return append([]byte{0x01, codec, 0x12, 0x20}, digest[:]...)
+}
+
+func referenceString(cid []byte) string {
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(cid))
+}
+
+func protoVarint(field byte, value uint64) []byte {
+	return binary.AppendUvarint([]byte{field << 3}, value)
+}
+
+func protoBytes(field byte, value []byte) []byte {
+	return append(binary.AppendUvarint([]byte{field<<3 | 2}, uint64(len(value))), value...)
+}
+
+func referenceLink(cid []byte, name string, size uint64) []byte {
+	link := append(protoBytes(1, cid), protoBytes(2, []byte(name))...)
+	return protoBytes(2, append(link, protoVarint(3, size)...))
+}
+
+func referenceFile(data []byte) string {
+	links, unixfs := []byte{}, protoVarint(1, 2)
+	unixfs = append(unixfs, protoVarint(3, uint64(len(data)))...)
+	for offset := 0; offset < len(data); offset += ChunkSize {
+		chunk := data[offset:min(offset+ChunkSize, len(data))]
+		links = append(links, referenceLink(referenceCID(0x55, chunk), "", uint64(len(chunk)))...)
+		unixfs = append(unixfs, protoVarint(4, uint64(len(chunk)))...)
+	}
+	return referenceString(referenceCID(0x70, append(links, protoBytes(1, unixfs)...)))
+}
+
+func referenceDirectory() string {
+	directory := protoBytes(1, protoVarint(1, 1))
+	emptyFile := referenceCID(0x55, nil)
+	sub := append(referenceLink(emptyFile, "empty", 0), directory...)
+	hello := []byte("hello world")
+	root := append(referenceLink(referenceCID(0x55, hello), "hello.txt", uint64(len(hello))), referenceLink(referenceCID(0x70, sub), "sub", uint64(len(sub)))...)
+	return referenceString(referenceCID(0x70, append(root, directory...)))
+}
+
+func mustDirectory(t *testing.T, entries []Entry) Node {
+	t.Helper()
+	node, err := Directory(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	cid := File([]byte("hello world")).CID
+	parsed, err := Parse(cid.String())
+	if err != nil || parsed != cid || parsed.Codec() != CodecRaw {
+		t.Fatalf("Parse(%s) = %v, %v", cid, parsed, err)
+	}
+	for _, bad := range []string{"", "Qmabc", "b!!!", "baaaa"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestFileChunking(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (MaxLinks*ChunkSize+ChunkSize/2)/16)
+	node := File(data)
+	if node.CID.Codec() != CodecDagPB || node.FileSize != uint64(len(data)) {
+		t.Fatalf("unexpected root %+v", node.CID)
+	}
+	leaves, size := 0, uint64(0)
+	for _, block := range node.Blocks {
+		size += uint64(len(block.Data))
+		if block.CID.Codec() == CodecRaw {
+			leaves++
+		}
+	}
+	// 174 full leaves plus half a chunk make a second level: a full node of
+	// 174 leaves and a node holding the last leaf, under a new root.
+	if leaves != MaxLinks+1 || len(node.Blocks) != leaves+3 {
+		t.Fatalf("expected %d leaves under 3 nodes, got %d blocks with %d leaves", MaxLinks+1, len(node.Blocks), leaves)
+	}
+	if size != node.Size {
+		t.Fatalf("expected the cumulative size %d to cover every block, got %d", size, node.Size)
+	}
+	if again := File(data); again.CID != node.CID {
+		t.Fatal("expected chunking to be deterministic")
+	}
+	// The root lists its two children's file sizes.
+	root := node.Blocks[0].Data
+	want := binary.AppendUvarint([]byte{0x20}, uint64(MaxLinks*ChunkSize))
+	if !bytes.Contains(root, want) {
+		t.Fatal("expected the root to record the size of its first child")
+	}
+}
+
+func TestDirectoryAndCAR(t *testing.T) {
+	image := File(bytes.Repeat([]byte{0xAB}, ChunkSize+1))
+	images := mustDirectory(t, []Entry{{Name: "1.png", Node: image}})
+	root := mustDirectory(t, []Entry{
+		{Name: "images", Node: images},
+		{Name: "contract.json", Node: File([]byte(`{"name":"x"}`))},
+		{Name: "1", Node: File([]byte(`{"name":"one"}`))},
+	})
+	if root.CID.Codec() != CodecDagPB || root.Size <= images.Size {
+		t.Fatalf("unexpected directory %+v", root.CID)
+	}
+	reordered := mustDirectory(t, []Entry{
+		{Name: "1", Node: File([]byte(`{"name":"one"}`))},
+		{Name: "images", Node: images},
+		{Name: "contract.json", Node: File([]byte(`{"name":"x"}`))},
+	})
+	if reordered.CID != root.CID {
+		t.Fatal("expected entries to be sorted by name")
+	}
+	for _, bad := range [][]Entry{
+		{{Name: "", Node: image}},
+		{{Name: "a/b", Node: image}},
+		{{Name: "x", Node: image}, {Name: "x", Node: image}},
+		{{Name: "x"}},
+	} {
+		if _, err := Directory(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+
+	var car bytes.Buffer
+	blocks := append(root.Blocks, root.Blocks...)
+	if err := WriteCAR(&car, []CID{root.CID}, blocks); err != nil {
+		t.Fatalf("WriteCAR: %v", err)
+	}
+	roots, read, err := ReadCAR(bytes.NewReader(car.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadCAR: %v", err)
+	}
+	if len(roots) != 1 || roots[0] != root.CID || len(read) != len(root.Blocks) || read[0].CID != root.CID {
+		t.Fatalf("unexpected CAR contents: %v roots, %d blocks", roots, len(read))
+	}
+	corrupt := append([]byte(nil), car.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0xFF
+	if _, _, err := ReadCAR(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("expected a corrupted block to be rejected")
+	}
+	// A section length far beyond the file must fail rather than allocate.
+	if _, _, err := ReadCAR(bytes.NewReader(binary.AppendUvarint(nil, 1<<40))); err == nil {
+		t.Fatal("expected a truncated section to be rejected")
+	}
+	if err := WriteCAR(&car, nil, blocks); err == nil {
+		t.Fatal("expected a CAR without roots to be rejected")
+	}
+}
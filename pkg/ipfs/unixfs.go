@@ -0,0 +1,142 @@
+package ipfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// ChunkSize is the size of the leaves a file is cut into.
+	ChunkSize = 256 * 1024
+	// MaxLinks is the most children a file node has.
+	MaxLinks = 174
+
+	unixfsDirectory = 1
+	unixfsFile      = 2
+)
+
+// Block is a block of a DAG: its bytes and the CID they hash to.
+type Block struct {
+	CID  CID
+	Data []byte
+}
+
+// Node is the root of a UnixFS DAG. Size is the cumulative size of every
+// block under it (the Tsize a parent records in its link) and FileSize the
+// bytes of file content it holds. Blocks are the whole DAG, root first.
+type Node struct {
+	CID      CID
+	Size     uint64
+	FileSize uint64
+	Blocks   []Block
+}
+
+// Entry is a named child of a directory.
+type Entry struct {
+	Name string
+	Node Node
+}
+
+// File chunks data into a UnixFS file. Data that fits in one chunk is a
+// single raw block.
+func File(data []byte) Node {
+	builder := &fileBuilder{data: data}
+	root := builder.leaf()
+	for depth := 1; !builder.done(); depth++ {
+		root = builder.fill([]Node{root}, depth)
+	}
+	return root
+}
+
+type fileBuilder struct {
+	data   []byte
+	offset int
+}
+
+func (builder *fileBuilder) done() bool {
+	return builder.offset >= len(builder.data)
+}
+
+func (builder *fileBuilder) leaf() Node {
+	end := min(builder.offset+ChunkSize, len(builder.data))
+	chunk := builder.data[builder.offset:end]
+	builder.offset = end
+	cid := Sum(CodecRaw, chunk)
+	return Node{CID: cid, Size: uint64(len(chunk)), FileSize: uint64(len(chunk)), Blocks: []Block{{CID: cid, Data: chunk}}}
+}
+
+// fill adds subtrees of the given depth to children until the node is full
+// or the data runs out, the balanced layout of go-unixfs.
+func (builder *fileBuilder) fill(children []Node, depth int) Node {
+	for len(children) < MaxLinks && !builder.done() {
+		if depth == 1 {
+			children = append(children, builder.leaf())
+		} else {
+			children = append(children, builder.fill(nil, depth-1))
+		}
+	}
+	fileSize := uint64(0)
+	data := binary.AppendUvarint([]byte{0x08}, unixfsFile)
+	for _, child := range children {
+		fileSize += child.FileSize
+	}
+	data = binary.AppendUvarint(append(data, 0x18), fileSize)
+	for _, child := range children {
+		data = binary.AppendUvarint(append(data, 0x20), child.FileSize)
+	}
+	links := make([]Entry, len(children))
+	for i, child := range children {
+		links[i] = Entry{Node: child}
+	}
+	node := dagPBNode(links, data)
+	node.FileSize = fileSize
+	return node
+}
+
+// Directory is a UnixFS directory of entries. Names must be unique, non-empty
+// and free of slashes. Directories are not sharded, so keep them to a few
+// thousand entries.
+func Directory(entries []Entry) (Node, error) {
+	sorted := append([]Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for i, entry := range sorted {
+		if entry.Name == "" || entry.Name == "." || entry.Name == ".." || strings.Contains(entry.Name, "/") {
+			return Node{}, fmt.Errorf("invalid directory entry name %q", entry.Name)
+		}
+		if i > 0 && sorted[i-1].Name == entry.Name {
+			return Node{}, fmt.Errorf("duplicate directory entry %q", entry.Name)
+		}
+		if !entry.Node.CID.Defined() {
+			return Node{}, fmt.Errorf("directory entry %q has no CID", entry.Name)
+		}
+	}
+	return dagPBNode(sorted, binary.AppendUvarint([]byte{0x08}, unixfsDirectory)), nil
+}
+
+// dagPBNode encodes a dag-pb node: its links, in order, then its UnixFS
+// data.
+func dagPBNode(links []Entry, data []byte) Node {
+	encoded := []byte{}
+	size := uint64(0)
+	for _, link := range links {
+		hash := link.Node.CID.Bytes()
+		pb := appendBytes([]byte{0x0a}, hash)
+		pb = appendBytes(append(pb, 0x12), []byte(link.Name))
+		pb = binary.AppendUvarint(append(pb, 0x18), link.Node.Size)
+		encoded = appendBytes(append(encoded, 0x12), pb)
+		size += link.Node.Size
+	}
+	encoded = appendBytes(append(encoded, 0x0a), data)
+	cid := Sum(CodecDagPB, encoded)
+	blocks := []Block{{CID: cid, Data: encoded}}
+	for _, link := range links {
+		blocks = append(blocks, link.Node.Blocks...)
+	}
+	return Node{CID: cid, Size: size + uint64(len(encoded)), Blocks: blocks}
+}
+
+func appendBytes(b, value []byte) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(value))), value...)
+}
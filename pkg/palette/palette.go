@@ -0,0 +1,284 @@
+// Package palette extracts the dominant colors of an image with k-means in
+// CIE L*a*b* and scores them against the colors an image was asked to use.
+package palette
+
+import (
+	"image"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// DefaultColors is the number of clusters Extract looks for.
+	DefaultColors = 8
+	// Tolerance is the CIEDE2000 distance (on go-colorful's 0..1 scale)
+	// within which two colors count as the same color.
+	Tolerance = 0.15
+	// MinShare is the smallest share of the image a color must cover to
+	// count towards the targets it matches and the color limit.
+	MinShare = 0.05
+
+	sampleSize = 64
+	iterations = 20
+)
+
+// Swatch is one extracted color and the share of the image it covers.
+type Swatch struct {
+	Hex   string  `json:"hex"`
+	Share float64 `json:"share"`
+}
+
+// TargetMatch is the extracted color nearest to one requested color.
+type TargetMatch struct {
+	Hex      string  `json:"hex"`
+	Closest  string  `json:"closest"`
+	Distance float64 `json:"distance"`
+	Present  bool    `json:"present"`
+}
+
+// Compliance scores a palette against the requested colors. Score runs
+// from 0 to 100 and weighs how much of the image is on-palette (half), how
+// many targets appear (three tenths) and whether the number of distinct
+// colors stays within the limit (one fifth). Limit zero means no limit.
+type Compliance struct {
+	Score          float64       `json:"score"`
+	OnPalette      float64       `json:"onPalette"`
+	TargetsPresent int           `json:"targetsPresent"`
+	Targets        []TargetMatch `json:"targets"`
+	DistinctColors int           `json:"distinctColors"`
+	Limit          int           `json:"limit,omitempty"`
+}
+
+type sample struct{ l, a, b float64 }
+
+// Extract returns up to k swatches for img, largest first. The result is
+// deterministic for a given image.
+func Extract(img image.Image, k int) []Swatch {
+	if k <= 0 {
+		k = DefaultColors
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, min(sampleSize, bounds.Dx()), min(sampleSize, bounds.Dy())))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	samples := make([]sample, 0, len(scaled.Pix)/4)
+	for offset := 0; offset < len(scaled.Pix); offset += 4 {
+		color := colorful.Color{
+			R: float64(scaled.Pix[offset]) / 255,
+			G: float64(scaled.Pix[offset+1]) / 255,
+			B: float64(scaled.Pix[offset+2]) / 255,
+		}
+		l, a, b := color.Lab()
+		samples = append(samples, sample{l, a, b})
+	}
+
+	centers := seedCenters(samples, k)
+	assignments := make([]int, len(samples))
+	for range iterations {
+		changed := false
+		for i, s := range samples {
+			if nearest := nearestCenter(s, centers); nearest != assignments[i] {
+				assignments[i], changed = nearest, true
+			}
+		}
+		sums := make([]sample, len(centers))
+		counts := make([]int, len(centers))
+		for i, s := range samples {
+			c := assignments[i]
+			sums[c].l += s.l
+			sums[c].a += s.a
+			sums[c].b += s.b
+			counts[c]++
+		}
+		for c := range centers {
+			if counts[c] > 0 {
+				n := float64(counts[c])
+				centers[c] = sample{sums[c].l / n, sums[c].a / n, sums[c].b / n}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	counts := make([]int, len(centers))
+	for _, c := range assignments {
+		counts[c]++
+	}
+	swatches := []Swatch{}
+	for c, center := range centers {
+		if counts[c] == 0 {
+			continue
+		}
+		share := float64(counts[c]) / float64(len(samples))
+		swatches = append(swatches, Swatch{
+			Hex:   colorful.Lab(center.l, center.a, center.b).Clamped().Hex(),
+			Share: math.Round(share*10000) / 10000,
+		})
+	}
+	sort.SliceStable(swatches, func(i, j int) bool { return swatches[i].Share > swatches[j].Share })
+	return swatches
+}
+
+// seedCenters picks up to k starting centers with k-means++ from a fixed
+// random source. It stops early when every sample is already a center, as
+// in a flat image.
+func seedCenters(samples []sample, k int) []sample {
+	random := rand.New(rand.NewPCG(1, uint64(len(samples))))
+	centers := []sample{samples[random.IntN(len(samples))]}
+	distances := make([]float64, len(samples))
+	for len(centers) < k {
+		total := 0.0
+		for i, s := range samples {
+			distances[i] = squaredDistance(s, centers[nearestCenter(s, centers)])
+			total += distances[i]
+		}
+		if total == 0 {
+			break
+		}
+		target := random.Float64() * total
+		chosen := len(samples) - 1
+		for i, d := range distances {
+			if target -= d; target <= 0 {
+				chosen = i
+				break
+			}
+		}
+		centers = append(centers, samples[chosen])
+	}
+	return centers
+}
+
+func nearestCenter(s sample, centers []sample) int {
+	best, bestDistance := 0, math.Inf(1)
+	for c, center := range centers {
+		if d := squaredDistance(s, center); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+func squaredDistance(x, y sample) float64 {
+	dl, da, db := x.l-y.l, x.a-y.a, x.b-y.b
+	return dl*dl + da*da + db*db
+}
+
+// Score compares swatches with the requested hex colors and color limit.
+// Entries that are not hex colors are ignored; with no targets there is
+// nothing to score and Score returns nil.
+func Score(swatches []Swatch, targets []string, limit int) *Compliance {
+	colors := []colorful.Color{}
+	hexes := []string{}
+	for _, target := range targets {
+		color, err := colorful.Hex(strings.TrimSpace(target))
+		if err != nil {
+			continue
+		}
+		colors = append(colors, color)
+		hexes = append(hexes, color.Hex())
+	}
+	if len(colors) == 0 || len(swatches) == 0 {
+		return nil
+	}
+	extracted := make([]colorful.Color, len(swatches))
+	for i, swatch := range swatches {
+		extracted[i], _ = colorful.Hex(swatch.Hex)
+	}
+
+	compliance := &Compliance{Targets: make([]TargetMatch, len(colors)), Limit: max(limit, 0)}
+	for t, target := range colors {
+		match := TargetMatch{Hex: hexes[t], Distance: math.Inf(1)}
+		for i, color := range extracted {
+			distance := target.DistanceCIEDE2000(color)
+			if distance < match.Distance {
+				match.Closest, match.Distance = swatches[i].Hex, distance
+			}
+			if distance <= Tolerance && swatches[i].Share >= MinShare {
+				match.Present = true
+			}
+		}
+		match.Distance = round(match.Distance)
+		if match.Present {
+			compliance.TargetsPresent++
+		}
+		compliance.Targets[t] = match
+	}
+	for i, color := range extracted {
+		for _, target := range colors {
+			if color.DistanceCIEDE2000(target) <= Tolerance {
+				compliance.OnPalette += swatches[i].Share
+				break
+			}
+		}
+	}
+	compliance.OnPalette = round(min(compliance.OnPalette, 1))
+	compliance.DistinctColors = distinctColors(swatches, extracted)
+
+	limitScore := 1.0
+	if compliance.Limit > 0 && compliance.DistinctColors > compliance.Limit {
+		limitScore = float64(compliance.Limit) / float64(compliance.DistinctColors)
+	}
+	presence := float64(compliance.TargetsPresent) / float64(len(colors))
+	compliance.Score = math.Round(1000*(0.5*compliance.OnPalette+0.3*presence+0.2*limitScore)) / 10
+	return compliance
+}
+
+// distinctColors counts the swatches of at least MinShare that are not
+// within Tolerance of a larger one.
+func distinctColors(swatches []Swatch, colors []colorful.Color) int {
+	kept := []colorful.Color{}
+	for i, swatch := range swatches {
+		if swatch.Share < MinShare {
+			continue
+		}
+		duplicate := false
+		for _, other := range kept {
+			if colors[i].DistanceCIEDE2000(other) <= Tolerance {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, colors[i])
+		}
+	}
+	return len(kept)
+}
+
+// ParseLimit reads a series color limit such as "3" or "three colors".
+// Anything else is no limit.
+func ParseLimit(text string) int {
+	words := map[string]int{
+		"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+		"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	}
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if n, ok := words[field]; ok {
+			return n
+		}
+		n := 0
+		for _, r := range field {
+			if r < '0' || r > '9' {
+				n = 0
+				break
+			}
+			n = n*10 + int(r-'0')
+		}
+		if n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
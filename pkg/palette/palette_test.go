@@ -0,0 +1,76 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// bands fills img with vertical stripes of the given colors in the given
+// proportions (out of 10).
+func bands(parts map[color.RGBA]int, order []color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 40))
+	x := 0
+	for _, c := range order {
+		width := parts[c] * 10
+		for ; width > 0; width-- {
+			for y := 0; y < 40; y++ {
+				img.Set(x, y, c)
+			}
+			x++
+		}
+	}
+	return img
+}
+
+var (
+	red   = color.RGBA{R: 0xE0, G: 0x20, B: 0x20, A: 0xFF}
+	blue  = color.RGBA{R: 0x20, G: 0x40, B: 0xD0, A: 0xFF}
+	green = color.RGBA{R: 0x20, G: 0xB0, B: 0x40, A: 0xFF}
+)
+
+func TestExtractFindsDominantColors(t *testing.T) {
+	img := bands(map[color.RGBA]int{red: 7, blue: 3}, []color.RGBA{red, blue})
+	swatches := Extract(img, 4)
+	if len(swatches) < 2 || swatches[0].Share < 0.6 {
+		t.Fatalf("expected red to dominate, got %+v", swatches)
+	}
+	if !reflect.DeepEqual(swatches, Extract(img, 4)) {
+		t.Fatal("expected extraction to be deterministic")
+	}
+	flat := bands(map[color.RGBA]int{green: 10}, []color.RGBA{green})
+	if got := Extract(flat, 8); len(got) != 1 || got[0].Hex != "#20b040" || got[0].Share != 1 {
+		t.Fatalf("expected a flat image to give one swatch, got %+v", got)
+	}
+}
+
+func TestScore(t *testing.T) {
+	onPalette := Extract(bands(map[color.RGBA]int{red: 6, blue: 4}, []color.RGBA{red, blue}), DefaultColors)
+	offPalette := Extract(bands(map[color.RGBA]int{green: 10}, []color.RGBA{green}), DefaultColors)
+	targets := []string{"#e02020", "#2040d0", "not a color"}
+
+	good := Score(onPalette, targets, 2)
+	if good == nil || good.TargetsPresent != 2 || good.OnPalette < 0.95 || good.Score < 95 || good.DistinctColors != 2 {
+		t.Fatalf("expected an on-palette image to score high, got %+v", good)
+	}
+	bad := Score(offPalette, targets, 0)
+	if bad == nil || bad.TargetsPresent != 0 || bad.OnPalette != 0 || bad.Score > 25 {
+		t.Fatalf("expected an off-palette image to score low, got %+v", bad)
+	}
+	mixed := Extract(bands(map[color.RGBA]int{red: 4, blue: 3, green: 3}, []color.RGBA{red, blue, green}), DefaultColors)
+	if limited := Score(mixed, targets, 2); limited.DistinctColors != 3 || limited.Score >= Score(mixed, targets, 0).Score {
+		t.Fatalf("expected exceeding the color limit to cost points, got %+v", limited)
+	}
+	if Score(onPalette, []string{"none"}, 0) != nil {
+		t.Fatal("expected no score without target colors")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	for text, want := range map[string]int{"3": 3, "five": 5, "Three colors": 3, "": 0, "few": 0, "only 4 tones": 4} {
+		if got := ParseLimit(text); got != want {
+			t.Errorf("ParseLimit(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package phash computes 64-bit perceptual hashes of images. Images that
+// look alike have hashes a small Hamming distance apart, whatever their size
+// or encoding.
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Hash is a 64-bit perceptual hash.
+type Hash uint64
+
+// String formats the hash as 16 hex digits.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse reads a hash formatted by String.
+func Parse(s string) (Hash, error) {
+	value, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || len(s) != 16 {
+		return 0, fmt.Errorf("invalid perceptual hash %q", s)
+	}
+	return Hash(value), nil
+}
+
+// Distance is the number of bits in which a and b differ, from 0 (alike) to
+// 64.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+// DHash is the difference hash: each bit says whether a pixel of a 9x8
+// grayscale thumbnail is brighter than its right-hand neighbour.
+func DHash(img image.Image) Hash {
+	gray := grayscale(img, 9, 8)
+	var hash Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash is the DCT hash: each bit says whether one of the 64 lowest
+// frequency DCT coefficients of a 32x32 grayscale thumbnail is above their
+// median. It is more robust than DHash to gamma and contrast changes.
+func PHash(img image.Image) Hash {
+	const size, low = 32, 8
+	gray := grayscale(img, size, size)
+	coefficients := dct2(gray, low)
+	values := make([]float64, 0, low*low-1)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			if u == 0 && v == 0 {
+				// The DC term is the mean brightness, which says nothing
+				// about structure.
+				continue
+			}
+			values = append(values, coefficients[v][u])
+		}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash Hash
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			hash <<= 1
+			if coefficients[v][u] > median {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// grayscale scales img to width x height and returns its luma, row by row.
+func grayscale(img image.Image, width, height int) [][]float64 {
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+	rows := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		rows[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			offset := scaled.PixOffset(x, y)
+			r, g, b := scaled.Pix[offset], scaled.Pix[offset+1], scaled.Pix[offset+2]
+			rows[y][x] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return rows
+}
+
+// dct2 returns the lowest n x n coefficients of the two-dimensional DCT-II
+// of a square block.
+func dct2(block [][]float64, n int) [][]float64 {
+	size := len(block)
+	cosines := make([][]float64, n)
+	for u := 0; u < n; u++ {
+		cosines[u] = make([]float64, size)
+		for x := 0; x < size; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*size))
+		}
+	}
+	// Rows first, then columns.
+	rows := make([][]float64, size)
+	for y := 0; y < size; y++ {
+		rows[y] = make([]float64, n)
+		for u := 0; u < n; u++ {
+			sum := 0.0
+			for x := 0; x < size; x++ {
+				sum += block[y][x] * cosines[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	out := make([][]float64, n)
+	for v := 0; v < n; v++ {
+		out[v] = make([]float64, n)
+		for u := 0; u < n; u++ {
+			sum := 0.0
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			out[v][u] = sum
+		}
+	}
+	return out
+}
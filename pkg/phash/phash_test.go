@@ -0,0 +1,67 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// scene draws a few soft shapes; shift moves them, which changes the
+// image's structure.
+func scene(width, height int, shift float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			v := 128 + 60*math.Sin((fx+shift)*7) + 50*math.Cos((fy-shift)*5)
+			if math.Hypot(fx-0.3-shift, fy-0.6) < 0.2 {
+				v = 240
+			}
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.8), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	return img
+}
+
+func TestHashesMatchLookAlikes(t *testing.T) {
+	original := scene(256, 256, 0)
+	resized := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), original, original.Bounds(), draw.Src, nil)
+	brighter := image.NewRGBA(original.Bounds())
+	for i := range original.Pix {
+		brighter.Pix[i] = uint8(min(255, int(original.Pix[i])+12))
+	}
+	different := scene(256, 256, 0.45)
+
+	for name, hash := range map[string]func(image.Image) Hash{"dhash": DHash, "phash": PHash} {
+		base := hash(original)
+		if d := Distance(base, hash(original)); d != 0 {
+			t.Errorf("%s: the same image is %d apart", name, d)
+		}
+		if d := Distance(base, hash(resized)); d > 6 {
+			t.Errorf("%s: a resized copy is %d apart", name, d)
+		}
+		if d := Distance(base, hash(brighter)); d > 6 {
+			t.Errorf("%s: a brighter copy is %d apart", name, d)
+		}
+		if d := Distance(base, hash(different)); d < 16 {
+			t.Errorf("%s: a different image is only %d apart", name, d)
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	hash := PHash(scene(64, 64, 0.1))
+	parsed, err := Parse(hash.String())
+	if err != nil || parsed != hash {
+		t.Fatalf("Parse(%s) = %s, %v", hash, parsed, err)
+	}
+	for _, bad := range []string{"", "xyz", "0123"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
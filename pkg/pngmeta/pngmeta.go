@@ -0,0 +1,270 @@
+// Package pngmeta reads and writes international text (iTXt) and physical
+// pixel size (pHYs) chunks in PNG files without decoding or re-encoding the
+// image data.
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// XMPKeyword is the iTXt keyword under which XMP packets are stored.
+const XMPKeyword = "XML:com.adobe.xmp"
+
+var signature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// ErrNotPNG is returned for data that does not start with the PNG signature
+// or whose chunks are cut short.
+var ErrNotPNG = errors.New("not a PNG file")
+
+// Text is one uncompressed iTXt chunk.
+type Text struct {
+	Keyword string
+	Text    string
+}
+
+type chunk struct {
+	kind string
+	data []byte
+}
+
+// ReadText returns the uncompressed iTXt chunks in the PNG in file order.
+// Compressed chunks are skipped.
+func ReadText(r io.Reader) ([]Text, error) {
+	chunks, err := readChunks(r)
+	if err != nil {
+		return nil, err
+	}
+	texts := []Text{}
+	for _, c := range chunks {
+		if c.kind != "iTXt" {
+			continue
+		}
+		if text, ok := parseText(c.data); ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts, nil
+}
+
+// ReadTextFile is ReadText on the file at path.
+func ReadTextFile(path string) ([]Text, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadText(file)
+}
+
+// WriteText copies the PNG from r to w with texts inserted as iTXt chunks
+// ahead of the image data. Existing iTXt chunks with the same keywords are
+// dropped, so writing the same keywords again replaces them.
+func WriteText(w io.Writer, r io.Reader, texts []Text) error {
+	replaced := map[string]bool{}
+	inserted := []chunk{}
+	for _, text := range texts {
+		if len(text.Keyword) == 0 || len(text.Keyword) > 79 || bytes.IndexByte([]byte(text.Keyword), 0) >= 0 {
+			return fmt.Errorf("invalid iTXt keyword %q", text.Keyword)
+		}
+		replaced[text.Keyword] = true
+		inserted = append(inserted, chunk{kind: "iTXt", data: encodeText(text)})
+	}
+	return rewrite(w, r, inserted, func(c chunk) bool {
+		if c.kind != "iTXt" {
+			return false
+		}
+		text, ok := parseText(c.data)
+		return ok && replaced[text.Keyword]
+	})
+}
+
+// ReadDPI returns the resolution recorded in the PNG's pHYs chunk, in dots
+// per inch. ok is false when there is no pHYs chunk or its unit is not the
+// meter.
+func ReadDPI(r io.Reader) (dpi int, ok bool, err error) {
+	chunks, err := readChunks(r)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, c := range chunks {
+		if c.kind != "pHYs" || len(c.data) != 9 || c.data[8] != 1 {
+			continue
+		}
+		perMeter := binary.BigEndian.Uint32(c.data[:4])
+		return int(math.Round(float64(perMeter) * 0.0254)), true, nil
+	}
+	return 0, false, nil
+}
+
+// WriteDPI copies the PNG from r to w with a pHYs chunk recording dpi dots
+// per inch on both axes, replacing any pHYs chunk already there.
+func WriteDPI(w io.Writer, r io.Reader, dpi int) error {
+	if dpi <= 0 {
+		return fmt.Errorf("invalid resolution %d dpi", dpi)
+	}
+	perMeter := uint32(math.Round(float64(dpi) / 0.0254))
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint32(data[:4], perMeter)
+	binary.BigEndian.PutUint32(data[4:8], perMeter)
+	data[8] = 1 // the unit is the meter
+	return rewrite(w, r, []chunk{{kind: "pHYs", data: data}}, func(c chunk) bool {
+		return c.kind == "pHYs"
+	})
+}
+
+// rewrite copies the PNG from r to w without the chunks drop selects and
+// with inserted placed ahead of the image data.
+func rewrite(w io.Writer, r io.Reader, inserted []chunk, drop func(chunk) bool) error {
+	chunks, err := readChunks(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+	written := false
+	for _, c := range chunks {
+		if drop(c) {
+			continue
+		}
+		if !written && (c.kind == "IDAT" || c.kind == "IEND") {
+			for _, extra := range inserted {
+				if err := writeChunk(w, extra); err != nil {
+					return err
+				}
+			}
+			written = true
+		}
+		if err := writeChunk(w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTextFile rewrites the PNG at path in place with texts added. The
+// file is replaced atomically.
+func WriteTextFile(path string, texts []Text) error {
+	path = filepath.Clean(path)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := WriteText(&out, bytes.NewReader(contents), texts); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pngmeta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readChunks(r io.Reader) ([]chunk, error) {
+	header := make([]byte, len(signature))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, signature) {
+		return nil, ErrNotPNG
+	}
+	chunks := []chunk{}
+	for {
+		var prefix [8]byte
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated chunk header", ErrNotPNG)
+		}
+		length := binary.BigEndian.Uint32(prefix[:4])
+		if length > 1<<31-1 {
+			return nil, fmt.Errorf("%w: chunk length %d", ErrNotPNG, length)
+		}
+		// The length is not trusted for an allocation: the buffer only grows
+		// with the data actually read, so a forged length on a short file
+		// fails as truncated.
+		c := chunk{kind: string(prefix[4:8])}
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(length)); err != nil {
+			return nil, fmt.Errorf("%w: truncated %s chunk", ErrNotPNG, c.kind)
+		}
+		c.data = data.Bytes()
+		var crc [4]byte
+		if _, err := io.ReadFull(r, crc[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated %s chunk", ErrNotPNG, c.kind)
+		}
+		if binary.BigEndian.Uint32(crc[:]) != checksum(c) {
+			return nil, fmt.Errorf("%w: bad checksum on %s chunk", ErrNotPNG, c.kind)
+		}
+		chunks = append(chunks, c)
+		if c.kind == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+func writeChunk(w io.Writer, c chunk) error {
+	var prefix [8]byte
+	binary.BigEndian.PutUint32(prefix[:4], uint32(len(c.data)))
+	copy(prefix[4:], c.kind)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], checksum(c))
+	for _, part := range [][]byte{prefix[:], c.data, crc[:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checksum(c chunk) uint32 {
+	hash := crc32.NewIEEE()
+	_, _ = hash.Write([]byte(c.kind))
+	_, _ = hash.Write(c.data)
+	return hash.Sum32()
+}
+
+// encodeText lays out an uncompressed iTXt chunk with no language tag:
+// keyword, NUL, compression flag and method, empty language tag and
+// translated keyword (each NUL terminated), then the UTF-8 text.
+func encodeText(text Text) []byte {
+	data := make([]byte, 0, len(text.Keyword)+5+len(text.Text))
+	data = append(data, text.Keyword...)
+	data = append(data, 0, 0, 0, 0, 0)
+	return append(data, text.Text...)
+}
+
+func parseText(data []byte) (Text, bool) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 2 || rest[0] != 0 {
+		return Text{}, false
+	}
+	rest = rest[2:]
+	if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+		return Text{}, false
+	}
+	if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+		return Text{}, false
+	}
+	return Text{Keyword: string(keyword), Text: string(rest)}, true
+}
@@ -0,0 +1,123 @@
+package pngmeta
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func encodedPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xFF})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteTextRoundTrip(t *testing.T) {
+	source := encodedPNG(t)
+	texts := []Text{{Keyword: "dalle:seed", Text: "0xabc"}, {Keyword: "dalle:prompt", Text: "an octopus — juggling ☕"}}
+	var out bytes.Buffer
+	if err := WriteText(&out, bytes.NewReader(source), texts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadText(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, texts) {
+		t.Fatalf("texts %v, want %v", got, texts)
+	}
+	decoded, err := png.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("rewritten PNG does not decode: %v", err)
+	}
+	if got := color.RGBAModel.Convert(decoded.At(1, 1)); got != (color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xFF}) {
+		t.Fatalf("pixel changed to %v", got)
+	}
+}
+
+func TestWriteTextFileReplacesKeywords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(path, encodedPNG(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTextFile(path, []Text{{Keyword: "a", Text: "1"}, {Keyword: "b", Text: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTextFile(path, []Text{{Keyword: "a", Text: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTextFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Text{{Keyword: "b", Text: "2"}, {Keyword: "a", Text: "3"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("texts %v, want %v", got, want)
+	}
+}
+
+func TestReadTextRejectsOtherData(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"html":      []byte("<html><body>rate limited</body></html>"),
+		"truncated": encodedPNG(t)[:40],
+	} {
+		if _, err := ReadText(bytes.NewReader(data)); !errors.Is(err, ErrNotPNG) {
+			t.Errorf("%s: expected ErrNotPNG, got %v", name, err)
+		}
+	}
+	if err := WriteText(&bytes.Buffer{}, bytes.NewReader(encodedPNG(t)), []Text{{Keyword: ""}}); err == nil {
+		t.Error("expected an empty keyword to be rejected")
+	}
+}
+
+func TestWriteDPIRoundTrip(t *testing.T) {
+	source := encodedPNG(t)
+	if _, ok, err := ReadDPI(bytes.NewReader(source)); err != nil || ok {
+		t.Fatalf("expected no pHYs chunk in a fresh PNG, got %v, %v", ok, err)
+	}
+	var first, second bytes.Buffer
+	if err := WriteDPI(&first, bytes.NewReader(source), 150); err != nil {
+		t.Fatalf("WriteDPI: %v", err)
+	}
+	if err := WriteDPI(&second, bytes.NewReader(first.Bytes()), 300); err != nil {
+		t.Fatalf("WriteDPI: %v", err)
+	}
+	if dpi, ok, err := ReadDPI(bytes.NewReader(second.Bytes())); err != nil || !ok || dpi != 300 {
+		t.Fatalf("ReadDPI = %d, %v, %v; want 300", dpi, ok, err)
+	}
+	if len(second.Bytes()) != len(first.Bytes()) {
+		t.Fatal("expected the second write to replace the pHYs chunk")
+	}
+	if _, err := png.Decode(bytes.NewReader(second.Bytes())); err != nil {
+		t.Fatalf("expected the PNG to stay valid: %v", err)
+	}
+	if err := WriteDPI(&bytes.Buffer{}, bytes.NewReader(source), 0); err == nil {
+		t.Fatal("expected a zero resolution to be rejected")
+	}
+}
+
+// A chunk length is read from the file, so a 20-byte file must not make the
+// reader allocate the 2 GiB it claims.
+func TestReadTextDoesNotTrustChunkLengths(t *testing.T) {
+	forged := append(append([]byte{}, signature...), 0x7F, 0xFF, 0xFF, 0xFF, 'i', 'T', 'X', 't', 'a', 'b', 'c', 'd')
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := ReadText(bytes.NewReader(forged)); !errors.Is(err, ErrNotPNG) {
+		t.Fatalf("expected ErrNotPNG, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("reading a forged chunk allocated %d bytes", allocated)
+	}
+}
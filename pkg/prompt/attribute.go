@@ -4,14 +4,15 @@ import "strconv"
 
 // Attribute represents a data attribute with metadata used for prompt generation.
 type Attribute struct {
-	Database string  `json:"database"`
-	Name     string  `json:"name"`
-	Bytes    string  `json:"bytes"`
-	Number   uint64  `json:"number"`
-	Factor   float64 `json:"factor"`
-	Count    uint64  `json:"count"`
-	Selector uint64  `json:"selector"`
-	Value    string  `json:"value"`
+	Database   string  `json:"database"`
+	Name       string  `json:"name"`
+	Bytes      string  `json:"bytes"`
+	Number     uint64  `json:"number"`
+	Factor     float64 `json:"factor"`
+	Count      uint64  `json:"count"`
+	Selector   uint64  `json:"selector"`
+	Value      string  `json:"value"`
+	Overridden bool    `json:"overridden,omitempty"`
 }
 
 // DatabaseNames lists the databases used to derive attributes from a seed.
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeccak256KnownVectors(t *testing.T) {
+	cases := map[string]string{
+		"":            "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"abc":         "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		"hello world": "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad",
+	}
+	for input, want := range cases {
+		if got := hex.EncodeToString(Keccak256([]byte(input))); got != want {
+			t.Errorf("Keccak256(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestKeccak256SpansBlocks(t *testing.T) {
+	input := bytes.Repeat([]byte("a"), 300)
+	whole := Keccak256(input)
+	split := Keccak256(input[:70], input[70:200], input[200:])
+	if !bytes.Equal(whole, split) {
+		t.Fatalf("split input changed the digest: %x != %x", split, whole)
+	}
+}
@@ -0,0 +1,214 @@
+package dalle
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/pngmeta"
+)
+
+// provenancePrefix starts the keyword of every provenance iTXt chunk.
+const provenancePrefix = "dalle:"
+
+// Provenance is the part of an image's metadata that travels inside its PNG
+// artifacts, enough to tell where an image came from and to regenerate it.
+type Provenance struct {
+	ImageID             string `json:"imageId"`
+	Input               string `json:"input,omitempty"`
+	Seed                string `json:"seed,omitempty"`
+	SeriesName          string `json:"seriesName,omitempty"`
+	SeriesHash          string `json:"seriesHash,omitempty"`
+	Recipe              string `json:"recipe,omitempty"`
+	RecipeVersion       string `json:"recipeVersion,omitempty"`
+	SeedScheme          string `json:"seedScheme,omitempty"`
+	DatabaseVersion     string `json:"databaseVersion,omitempty"`
+	DatabaseArchiveHash string `json:"databaseArchiveHash,omitempty"`
+	Prompt              string `json:"prompt,omitempty"`
+	DataPrompt          string `json:"dataPrompt,omitempty"`
+	TitlePrompt         string `json:"titlePrompt,omitempty"`
+	TersePrompt         string `json:"tersePrompt,omitempty"`
+	EnhancedPrompt      string `json:"enhancedPrompt,omitempty"`
+	MetadataVersion     string `json:"metadataVersion,omitempty"`
+}
+
+// ImageInspection is what `images inspect` reports about a PNG: the
+// provenance read from it and, when the image ID is known locally, the
+// metadata record and any provenance fields that disagree with it.
+type ImageInspection struct {
+	Path       string               `json:"path"`
+	Provenance *Provenance          `json:"provenance,omitempty"`
+	XMP        bool                 `json:"xmp"`
+	Record     *ImageMetadataRecord `json:"record,omitempty"`
+	Mismatches []string             `json:"mismatches,omitempty"`
+}
+
+// ProvenanceOf returns the provenance recorded for metadata.
+func ProvenanceOf(metadata ImageMetadata) Provenance {
+	return Provenance{
+		ImageID:             metadata.ImageID,
+		Input:               metadata.Input,
+		Seed:                metadata.Seed,
+		SeriesName:          metadata.Series.Name,
+		SeriesHash:          metadata.Series.Hash,
+		Recipe:              metadata.Recipe.Name,
+		RecipeVersion:       metadata.Recipe.Version,
+		SeedScheme:          metadata.Recipe.SeedSchemeReference(),
+		DatabaseVersion:     metadata.Database.Version,
+		DatabaseArchiveHash: metadata.Database.ArchiveHash,
+		Prompt:              metadata.Prompts.Prompt,
+		DataPrompt:          metadata.Prompts.DataPrompt,
+		TitlePrompt:         metadata.Prompts.TitlePrompt,
+		TersePrompt:         metadata.Prompts.TersePrompt,
+		EnhancedPrompt:      metadata.Prompts.EnhancedPrompt,
+		MetadataVersion:     metadata.MetadataVersion,
+	}
+}
+
+// fields pairs each provenance field with its chunk keyword suffix, in the
+// order the chunks are written.
+func (provenance *Provenance) fields() []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{"imageId", &provenance.ImageID},
+		{"input", &provenance.Input},
+		{"seed", &provenance.Seed},
+		{"seriesName", &provenance.SeriesName},
+		{"seriesHash", &provenance.SeriesHash},
+		{"recipe", &provenance.Recipe},
+		{"recipeVersion", &provenance.RecipeVersion},
+		{"seedScheme", &provenance.SeedScheme},
+		{"databaseVersion", &provenance.DatabaseVersion},
+		{"databaseArchiveHash", &provenance.DatabaseArchiveHash},
+		{"prompt", &provenance.Prompt},
+		{"dataPrompt", &provenance.DataPrompt},
+		{"titlePrompt", &provenance.TitlePrompt},
+		{"tersePrompt", &provenance.TersePrompt},
+		{"enhancedPrompt", &provenance.EnhancedPrompt},
+		{"metadataVersion", &provenance.MetadataVersion},
+	}
+}
+
+// texts returns the iTXt chunks for the provenance: one per non-empty field
+// and an XMP packet carrying the same fields.
+func (provenance Provenance) texts() []pngmeta.Text {
+	texts := []pngmeta.Text{}
+	for _, field := range provenance.fields() {
+		if *field.value != "" {
+			texts = append(texts, pngmeta.Text{Keyword: provenancePrefix + field.name, Text: *field.value})
+		}
+	}
+	return append(texts, pngmeta.Text{Keyword: pngmeta.XMPKeyword, Text: provenance.xmp()})
+}
+
+// xmp renders an XMP packet with the title and terse prompt as Dublin Core
+// title and description and every field in the dalle namespace.
+func (provenance Provenance) xmp() string {
+	var b strings.Builder
+	escape := func(value string) string {
+		var escaped strings.Builder
+		_ = xml.EscapeText(&escaped, []byte(value))
+		return escaped.String()
+	}
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:dalle=\"https://trueblocks.io/ns/dalle/1.0/\">\n")
+	for _, dc := range []struct{ name, value string }{{"title", provenance.TitlePrompt}, {"description", provenance.TersePrompt}} {
+		if dc.value != "" {
+			b.WriteString("   <dc:" + dc.name + "><rdf:Alt><rdf:li xml:lang=\"x-default\">" + escape(dc.value) + "</rdf:li></rdf:Alt></dc:" + dc.name + ">\n")
+		}
+	}
+	for _, field := range provenance.fields() {
+		if *field.value != "" {
+			b.WriteString("   <dalle:" + field.name + ">" + escape(*field.value) + "</dalle:" + field.name + ">\n")
+		}
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return b.String()
+}
+
+// embedProvenance writes the provenance chunks into every PNG artifact of
+// metadata. Artifacts that are missing or are not PNGs, such as the empty
+// placeholders written when no provider key is set, are left alone.
+func embedProvenance(metadata ImageMetadata) error {
+	texts := ProvenanceOf(metadata).texts()
+	for _, artifact := range metadata.Artifacts.Named() {
+		if err := pngmeta.WriteTextFile(artifact.Path, texts); err != nil && !os.IsNotExist(err) && !errors.Is(err, pngmeta.ErrNotPNG) {
+			return WrapError(ErrArtifactMissing, "embed provenance", err)
+		}
+	}
+	return nil
+}
+
+// readProvenance reads the provenance chunks from a PNG, returning nil when
+// it carries none, and reports whether it has an XMP packet.
+func readProvenance(path string) (*Provenance, bool, error) {
+	texts, err := pngmeta.ReadTextFile(path)
+	if err != nil {
+		if errors.Is(err, pngmeta.ErrNotPNG) {
+			return nil, false, WrapError(ErrInvalidInput, "read provenance", err)
+		}
+		return nil, false, WrapError(ErrArtifactMissing, "read provenance", err)
+	}
+	provenance, found, xmp := Provenance{}, false, false
+	byName := map[string]*string{}
+	for _, field := range provenance.fields() {
+		byName[provenancePrefix+field.name] = field.value
+	}
+	for _, text := range texts {
+		if text.Keyword == pngmeta.XMPKeyword {
+			xmp = true
+		}
+		if value, ok := byName[text.Keyword]; ok {
+			*value, found = text.Text, true
+		}
+	}
+	if !found {
+		return nil, xmp, nil
+	}
+	return &provenance, xmp, nil
+}
+
+// InspectImage reads the provenance embedded in a PNG and resolves it
+// against the local metadata records by image ID.
+func (engine *Engine) InspectImage(path string) (ImageInspection, error) {
+	if engine == nil {
+		return ImageInspection{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if strings.TrimSpace(path) == "" {
+		return ImageInspection{}, NewError(ErrInvalidInput, "PNG path is required")
+	}
+	provenance, xmp, err := readProvenance(filepath.Clean(path))
+	if err != nil {
+		return ImageInspection{}, err
+	}
+	inspection := ImageInspection{Path: path, Provenance: provenance, XMP: xmp}
+	if provenance == nil || provenance.ImageID == "" {
+		return inspection, nil
+	}
+	record, err := engine.GetImage(provenance.ImageID)
+	if err != nil {
+		if ErrorCodeOf(err) == ErrArtifactMissing {
+			return inspection, nil
+		}
+		return ImageInspection{}, err
+	}
+	inspection.Record = &record
+	recorded := ProvenanceOf(record.Metadata)
+	recordedFields := recorded.fields()
+	for i, field := range provenance.fields() {
+		// Fields left out of the PNG are not compared.
+		if *field.value != "" && *field.value != *recordedFields[i].value {
+			inspection.Mismatches = append(inspection.Mismatches, field.name)
+		}
+	}
+	return inspection, nil
+}
@@ -0,0 +1,92 @@
+package dalle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/pngmeta"
+)
+
+func TestEngineGenerateEmbedsProvenance(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	want := ProvenanceOf(result.Metadata)
+	for _, path := range []string{result.GeneratedPath, result.AnnotatedPath} {
+		inspection, err := engine.InspectImage(path)
+		if err != nil {
+			t.Fatalf("InspectImage(%s): %v", path, err)
+		}
+		if inspection.Provenance == nil || !reflect.DeepEqual(*inspection.Provenance, want) {
+			t.Fatalf("provenance %+v, want %+v", inspection.Provenance, want)
+		}
+		if !inspection.XMP || inspection.Record == nil || inspection.Record.Metadata.ImageID != result.Metadata.ImageID || len(inspection.Mismatches) != 0 {
+			t.Fatalf("unexpected inspection: %+v", inspection)
+		}
+	}
+
+	texts, err := pngmeta.ReadTextFile(result.GeneratedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp := ""
+	for _, text := range texts {
+		if text.Keyword == pngmeta.XMPKeyword {
+			xmp = text.Text
+		}
+	}
+	if !strings.Contains(xmp, "<dalle:imageId>"+result.Metadata.ImageID+"</dalle:imageId>") || !strings.Contains(xmp, "<dc:title>") {
+		t.Fatalf("unexpected XMP packet:\n%s", xmp)
+	}
+
+	if err := pngmeta.WriteTextFile(result.AnnotatedPath, []pngmeta.Text{{Keyword: "dalle:seed", Text: "tampered"}}); err != nil {
+		t.Fatal(err)
+	}
+	inspection, err := engine.InspectImage(result.AnnotatedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inspection.Mismatches, []string{"seed"}) {
+		t.Fatalf("mismatches %v, want [seed]", inspection.Mismatches)
+	}
+}
+
+func TestEngineInspectImageWithoutProvenance(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	result, err := midToneImages(imageRequest{generatedPath: filepath.Join(dataDir, "plain.png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inspection, err := engine.InspectImage(result.generatedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.Provenance != nil || inspection.XMP || inspection.Record != nil {
+		t.Fatalf("unexpected inspection of a plain PNG: %+v", inspection)
+	}
+
+	notPNG := filepath.Join(dataDir, "page.png")
+	if err := os.WriteFile(notPNG, []byte("<html></html>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.InspectImage(notPNG); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput for a non-PNG, got %v", err)
+	}
+	if _, err := engine.InspectImage(filepath.Join(dataDir, "missing.png")); ErrorCodeOf(err) != ErrArtifactMissing {
+		t.Fatalf("expected ErrArtifactMissing for a missing file, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package dalle
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/utils"
+)
+
+const (
+	SeedSchemeSHA256     = "sha256"
+	SeedSchemeKeccak256  = "keccak256"
+	SeedSchemeAddress    = "address"
+	SeedSchemeHKDFSHA256 = "hkdf-sha256"
+
+	DefaultSeedScheme        = SeedSchemeSHA256
+	DefaultSeedSchemeVersion = "1"
+)
+
+// SeedScheme turns an input into a seed and a seed into the six-hex-digit
+// chunks that select one database row per attribute. Schemes are versioned:
+// once a version has been used to mint images its output must never change,
+// so a behavioral change ships as a new version alongside the old one.
+type SeedScheme interface {
+	Name() string
+	Version() string
+	// Seed derives the seed from a trimmed, non-empty input.
+	Seed(input string) (string, error)
+	// Chunks returns the dress seed (as stored on the DalleDress) and at most
+	// count chunks derived from seed.
+	Chunks(seed string, count int) (string, []string, error)
+}
+
+var (
+	seedSchemesMutex sync.RWMutex
+	seedSchemes      = map[string]SeedScheme{}
+	currentSchemes   = map[string]string{}
+)
+
+func init() {
+	RegisterSeedScheme(sha256Scheme{})
+	RegisterSeedScheme(keccak256Scheme{})
+	RegisterSeedScheme(addressScheme{})
+	RegisterSeedScheme(hkdfScheme{})
+}
+
+// RegisterSeedScheme makes a scheme selectable by name. The most recently
+// registered version of a name is used when a request names no version.
+func RegisterSeedScheme(scheme SeedScheme) {
+	seedSchemesMutex.Lock()
+	defer seedSchemesMutex.Unlock()
+	seedSchemes[scheme.Name()+"@"+scheme.Version()] = scheme
+	currentSchemes[scheme.Name()] = scheme.Version()
+}
+
+// LookupSeedScheme resolves "name" or "name@version". An empty reference is
+// the default scheme, which is also what metadata written before schemes were
+// recorded used.
+func LookupSeedScheme(reference string) (SeedScheme, error) {
+	name, version, _ := strings.Cut(strings.ToLower(strings.TrimSpace(reference)), "@")
+	if name == "" {
+		name = DefaultSeedScheme
+	}
+	seedSchemesMutex.RLock()
+	defer seedSchemesMutex.RUnlock()
+	if version == "" {
+		current, ok := currentSchemes[name]
+		if !ok {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown seed scheme %q", name))
+		}
+		version = current
+	}
+	scheme, ok := seedSchemes[name+"@"+version]
+	if !ok {
+		return nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown seed scheme %s version %s", name, version))
+	}
+	return scheme, nil
+}
+
+// SeedSchemes lists the registered schemes as "name@version".
+func SeedSchemes() []string {
+	seedSchemesMutex.RLock()
+	defer seedSchemesMutex.RUnlock()
+	names := make([]string, 0, len(seedSchemes))
+	for key := range seedSchemes {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func seedSchemeReference(scheme SeedScheme) string {
+	return scheme.Name() + "@" + scheme.Version()
+}
+
+func isDefaultSeedScheme(name, version string) bool {
+	return (name == "" || name == DefaultSeedScheme) && (version == "" || version == DefaultSeedSchemeVersion)
+}
+
+// legacyChunks is the original DalleDress construction: the seed is followed by
+// its reverse, a leading 0x is dropped and the first 64 characters are kept,
+// and chunks are read at offsets 0, 4, 8, 12, ... (pairs at stride 8).
+func legacyChunks(seed string, count int) (string, []string, error) {
+	seed = seed + utils.Reverse(seed)
+	if len(seed) < 66 {
+		return "", nil, fmt.Errorf("seed length is less than 66")
+	}
+	if strings.HasPrefix(seed, "0x") {
+		seed = seed[2:66]
+	}
+	chunks := []string{}
+	for i := 0; i+6 <= len(seed) && len(chunks) < count; i += 8 {
+		chunks = append(chunks, seed[i:i+6])
+		if len(chunks) < count && i+4+6 <= len(seed) {
+			chunks = append(chunks, seed[i+4:i+4+6])
+		}
+	}
+	return seed, chunks, nil
+}
+
+type sha256Scheme struct{}
+
+func (sha256Scheme) Name() string    { return SeedSchemeSHA256 }
+func (sha256Scheme) Version() string { return "1" }
+func (sha256Scheme) Seed(input string) (string, error) {
+	return stableSeed(input), nil
+}
+func (sha256Scheme) Chunks(seed string, count int) (string, []string, error) {
+	return legacyChunks(seed, count)
+}
+
+// keccak256Scheme hashes the input the way Solidity's keccak256 would: hex
+// input (an address, a hash) is hashed as bytes, anything else as UTF-8.
+type keccak256Scheme struct{}
+
+func (keccak256Scheme) Name() string    { return SeedSchemeKeccak256 }
+func (keccak256Scheme) Version() string { return "1" }
+func (keccak256Scheme) Seed(input string) (string, error) {
+	data := []byte(input)
+	if hexInput.MatchString(input) && len(input)%2 == 0 {
+		data, _ = hex.DecodeString(input[2:])
+	}
+	return hex.EncodeToString(utils.Keccak256(data)), nil
+}
+func (keccak256Scheme) Chunks(seed string, count int) (string, []string, error) {
+	return legacyChunks(seed, count)
+}
+
+var (
+	hexInput       = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	addressPattern = regexp.MustCompile(`^0[xX][0-9a-fA-F]{40}$`)
+)
+
+// addressScheme passes an Ethereum address through unhashed, reproducing the
+// original DalleDress images that were seeded directly from the address (and
+// therefore select only the first fifteen attributes).
+type addressScheme struct{}
+
+func (addressScheme) Name() string    { return SeedSchemeAddress }
+func (addressScheme) Version() string { return "1" }
+func (addressScheme) Seed(input string) (string, error) {
+	if !addressPattern.MatchString(input) {
+		return "", NewError(ErrInvalidInput, fmt.Sprintf("seed scheme %s requires a 0x-prefixed 20-byte address", SeedSchemeAddress))
+	}
+	return "0x" + strings.ToLower(input[2:]), nil
+}
+func (addressScheme) Chunks(seed string, count int) (string, []string, error) {
+	return legacyChunks(seed, count)
+}
+
+// hkdfScheme keeps the SHA-256 seed but expands it with HKDF-SHA256 into one
+// independent chunk per attribute instead of reading overlapping windows of
+// the seed. It removes the seed length as a bound but does not add
+// attributes: a dress still has one per entry of prompt.AttributeNames, and
+// more attributes need new entries there (with their databases and prompt
+// templates). Chunks yields the same leading chunks whatever the count, so
+// such entries would extend hkdf dresses without changing existing ones.
+type hkdfScheme struct{}
+
+const hkdfInfo = "trueblocks-dalle/attributes/v1"
+
+func (hkdfScheme) Name() string    { return SeedSchemeHKDFSHA256 }
+func (hkdfScheme) Version() string { return "1" }
+func (hkdfScheme) Seed(input string) (string, error) {
+	return stableSeed(input), nil
+}
+func (hkdfScheme) Chunks(seed string, count int) (string, []string, error) {
+	if count <= 0 {
+		return seed, nil, nil
+	}
+	expanded, err := hkdf.Key(sha256.New, []byte(seed), nil, hkdfInfo, 3*count)
+	if err != nil {
+		return "", nil, err
+	}
+	chunks := make([]string, count)
+	for i := range chunks {
+		chunks[i] = hex.EncodeToString(expanded[3*i : 3*i+3])
+	}
+	return seed, chunks, nil
+}
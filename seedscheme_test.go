@@ -0,0 +1,116 @@
+package dalle
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/utils"
+)
+
+const testAddress = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+
+func TestLegacyChunksMatchOriginalConstruction(t *testing.T) {
+	seed := stableSeed("Person Tour Coordinates")
+	dressSeed, chunks, err := legacyChunks(seed, 17)
+	if err != nil {
+		t.Fatalf("legacyChunks: %v", err)
+	}
+	if dressSeed != seed+utils.Reverse(seed) || len(chunks) != 17 {
+		t.Fatalf("unexpected legacy chunks: %d from %s", len(chunks), dressSeed)
+	}
+	for index, chunk := range chunks {
+		offset := (index/2)*8 + (index%2)*4
+		if chunk != dressSeed[offset:offset+6] {
+			t.Fatalf("chunk %d = %s, want %s", index, chunk, dressSeed[offset:offset+6])
+		}
+	}
+	if _, _, err := legacyChunks("0x12", 17); err == nil {
+		t.Fatalf("expected short seeds to be rejected")
+	}
+}
+
+func TestSeedSchemesDeriveSeeds(t *testing.T) {
+	address, err := LookupSeedScheme(SeedSchemeAddress)
+	if err != nil {
+		t.Fatalf("LookupSeedScheme: %v", err)
+	}
+	seed, err := address.Seed(testAddress)
+	if err != nil || seed != strings.ToLower(testAddress) {
+		t.Fatalf("address seed = %q, %v", seed, err)
+	}
+	if _, err := address.Seed("not an address"); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected invalid input, got %v", err)
+	}
+
+	keccak, err := LookupSeedScheme("keccak256@1")
+	if err != nil {
+		t.Fatalf("LookupSeedScheme: %v", err)
+	}
+	raw, _ := hex.DecodeString(testAddress[2:])
+	if seed, _ := keccak.Seed(testAddress); seed != hex.EncodeToString(utils.Keccak256(raw)) {
+		t.Fatalf("keccak seed should hash the address bytes, got %s", seed)
+	}
+
+	hkdf, err := LookupSeedScheme(SeedSchemeHKDFSHA256)
+	if err != nil {
+		t.Fatalf("LookupSeedScheme: %v", err)
+	}
+	_, chunks, err := hkdf.Chunks(stableSeed("x"), 40)
+	if err != nil || len(chunks) != 40 {
+		t.Fatalf("expected 40 HKDF chunks, got %d (%v)", len(chunks), err)
+	}
+	_, again, _ := hkdf.Chunks(stableSeed("x"), 17)
+	if again[16] != chunks[16] {
+		t.Fatalf("HKDF chunks must not depend on the requested count")
+	}
+
+	for _, reference := range []string{"md5", "sha256@9"} {
+		if _, err := LookupSeedScheme(reference); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Fatalf("expected %s to be rejected, got %v", reference, err)
+		}
+	}
+}
+
+func TestEnginePreviewRecordsSeedScheme(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	base, err := engine.Preview(GenerateRequest{Input: testAddress})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if base.Metadata.Recipe.SeedScheme != SeedSchemeSHA256 || base.Metadata.Recipe.SeedSchemeVersion != "1" {
+		t.Fatalf("default scheme not recorded: %#v", base.Metadata.Recipe)
+	}
+	legacy := base.Metadata
+	legacy.Recipe.SeedScheme, legacy.Recipe.SeedSchemeVersion = "", ""
+	if ComputeImageID(legacy) != base.Metadata.ImageID {
+		t.Fatalf("recording the default scheme must not change image IDs")
+	}
+
+	hkdf, err := engine.Preview(GenerateRequest{Input: testAddress, SeedScheme: SeedSchemeHKDFSHA256})
+	if err != nil {
+		t.Fatalf("Preview hkdf: %v", err)
+	}
+	if hkdf.Metadata.Seed != base.Metadata.Seed || hkdf.Metadata.ImageID == base.Metadata.ImageID || hkdf.MetadataPath == base.MetadataPath {
+		t.Fatalf("hkdf image must be distinct from the default at the same seed")
+	}
+	if len(hkdf.Metadata.SelectedRecords) != len(base.Metadata.SelectedRecords) {
+		t.Fatalf("expected one record per attribute, got %d", len(hkdf.Metadata.SelectedRecords))
+	}
+
+	address, err := engine.Preview(GenerateRequest{Input: testAddress, SeedScheme: SeedSchemeAddress})
+	if err != nil {
+		t.Fatalf("Preview address: %v", err)
+	}
+	if address.Metadata.Seed != strings.ToLower(testAddress) || len(address.Metadata.SelectedRecords) != len(base.Metadata.SelectedRecords)-2 {
+		// Legacy address seeds are 64 characters, enough for 15 of the 17 attributes.
+		t.Fatalf("address scheme should pass the address through like legacy images: %s (%d records)", address.Metadata.Seed, len(address.Metadata.SelectedRecords))
+	}
+	record, err := engine.GetImage(address.Metadata.ImageID)
+	if err != nil || record.Metadata.Recipe.SeedSchemeReference() != "address@1" {
+		t.Fatalf("scheme not persisted: %v %#v", err, record.Metadata.Recipe)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"reflect"
 
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
 	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/storage"
 )
 
@@ -26,27 +27,29 @@ type SeriesModel struct {
 
 // Series represents a collection of prompt attributes and their values.
 type Series struct {
-	Last         int          `json:"last,omitempty"`
-	Suffix       string       `json:"suffix"`
-	Purpose      string       `json:"purpose,omitempty"`
-	Deleted      bool         `json:"deleted,omitempty"`
-	Adverbs      []string     `json:"adverbs"`
-	Adjectives   []string     `json:"adjectives"`
-	Nouns        []string     `json:"nouns"`
-	Emotions     []string     `json:"emotions"`
-	Occupations  []string     `json:"occupations"`
-	Actions      []string     `json:"actions"`
-	Artstyles    []string     `json:"artstyles"`
-	Litstyles    []string     `json:"litstyles"`
-	Colors       []string     `json:"colors"`
-	Viewpoints   []string     `json:"viewpoints"`
-	Gazes        []string     `json:"gazes"`
-	Backstyles   []string     `json:"backstyles"`
-	Compositions []string     `json:"compositions"`
-	ColorLimit   string       `json:"colorLimit,omitempty"`
-	ModifiedAt   string       `json:"modifiedAt,omitempty"`
-	Version      string       `json:"version,omitempty"`
-	Source       SeriesSource `json:"source,omitempty"`
+	Last         int                   `json:"last,omitempty"`
+	Suffix       string                `json:"suffix"`
+	Purpose      string                `json:"purpose,omitempty"`
+	Deleted      bool                  `json:"deleted,omitempty"`
+	Adverbs      []string              `json:"adverbs"`
+	Adjectives   []string              `json:"adjectives"`
+	Nouns        []string              `json:"nouns"`
+	Emotions     []string              `json:"emotions"`
+	Occupations  []string              `json:"occupations"`
+	Actions      []string              `json:"actions"`
+	Artstyles    []string              `json:"artstyles"`
+	Litstyles    []string              `json:"litstyles"`
+	Colors       []string              `json:"colors"`
+	Viewpoints   []string              `json:"viewpoints"`
+	Gazes        []string              `json:"gazes"`
+	Backstyles   []string              `json:"backstyles"`
+	Compositions []string              `json:"compositions"`
+	ColorLimit   string                `json:"colorLimit,omitempty"`
+	Font         *annotate.FontOptions `json:"font,omitempty"`
+	Badge        *BadgeConfig          `json:"badge,omitempty"`
+	ModifiedAt   string                `json:"modifiedAt,omitempty"`
+	Version      string                `json:"version,omitempty"`
+	Source       SeriesSource          `json:"source,omitempty"`
 }
 
 func (s *Series) Model(chain, format string, verbose bool, extraOpts map[string]any) SeriesModel {
@@ -71,6 +74,8 @@ func (s *Series) Model(chain, format string, verbose bool, extraOpts map[string]
 			"backstyles":   s.Backstyles,
 			"compositions": s.Compositions,
 			"colorLimit":   s.ColorLimit,
+			"font":         s.Font,
+			"badge":        s.Badge,
 			"version":      s.Version,
 			"source":       string(s.Source),
 		},
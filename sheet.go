@@ -0,0 +1,447 @@
+package dalle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/annotate"
+	"golang.org/x/image/draw"
+)
+
+const (
+	SheetCaptionTitle = "title"
+	SheetCaptionTerse = "terse"
+	SheetCaptionNone  = "none"
+
+	SheetSortInput  = "input"
+	SheetSortSeries = "series"
+	SheetSortTitle  = "title"
+	SheetSortNewest = "newest"
+
+	DefaultSheetColumns  = 4
+	DefaultSheetCellSize = 256
+
+	maxSheetCells  = 400
+	maxSheetSide   = 16384
+	sheetGutter    = 8
+	sheetBandShare = 0.2
+)
+
+// SheetRequest selects the images of a contact sheet and how to lay it out.
+// Images come from IDs when given, else from every image in Series (all
+// series when empty); Latest keeps only the N most recently written. Each
+// cell is CellSize pixels square with a caption band below it taken from
+// the title or terse prompt.
+//
+// With Compare, the sheet has one column per series in Series (at least
+// two) and one row per input found in any of them, so each row shows what
+// each series does with the same input. IDs then pick the inputs, and
+// Columns is ignored.
+type SheetRequest struct {
+	Series   []string
+	IDs      []string
+	Latest   int
+	Columns  int
+	CellSize int
+	Caption  string
+	Sort     string
+	Compare  bool
+	Out      string
+}
+
+// SheetCell is one cell of a sheet in row order. In comparison sheets an
+// input missing from a series leaves an empty cell with no ImageID.
+type SheetCell struct {
+	ImageID string `json:"imageId,omitempty"`
+	Series  string `json:"series"`
+	Input   string `json:"input"`
+	Caption string `json:"caption,omitempty"`
+}
+
+type SheetResult struct {
+	Path    string      `json:"path"`
+	Columns int         `json:"columns"`
+	Rows    int         `json:"rows"`
+	Series  []string    `json:"series,omitempty"`
+	Cells   []SheetCell `json:"cells"`
+	Skipped []string    `json:"skipped,omitempty"`
+}
+
+// sheetImage is a candidate cell. Images are only decoded when the sheet is
+// drawn, one at a time, so selecting from a large series stays cheap.
+type sheetImage struct {
+	record   ImageMetadataRecord
+	source   string
+	modified int64
+}
+
+// ImageSheet composes the selected images into one PNG.
+func (engine *Engine) ImageSheet(request SheetRequest) (SheetResult, error) {
+	if engine == nil {
+		return SheetResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if err := normalizeSheetRequest(&request); err != nil {
+		return SheetResult{}, err
+	}
+	records, err := engine.sheetRecords(request)
+	if err != nil {
+		return SheetResult{}, err
+	}
+	result := SheetResult{Cells: []SheetCell{}}
+	images := []sheetImage{}
+	for _, record := range records {
+		source := sheetSource(record.Metadata.Artifacts)
+		if !decodableImage(source) {
+			// Placeholders and missing files have nothing to show.
+			result.Skipped = append(result.Skipped, record.Metadata.ImageID)
+			continue
+		}
+		modified := int64(0)
+		if info, err := os.Stat(record.Path); err == nil {
+			modified = info.ModTime().UnixNano()
+		}
+		images = append(images, sheetImage{record: record, source: source, modified: modified})
+	}
+	if len(images) == 0 {
+		return SheetResult{}, NewError(ErrArtifactMissing, "no images to put on the sheet")
+	}
+
+	var grid []*sheetImage
+	var inputs []string
+	if request.Compare {
+		grid, inputs = compareGrid(images, request)
+		result.Series = request.Series
+		result.Columns = len(result.Series)
+	} else {
+		sortSheetImages(images, request.Sort)
+		if request.Latest > 0 && len(images) > request.Latest {
+			if request.Sort != SheetSortNewest {
+				sortSheetImages(images, SheetSortNewest)
+				images = images[:request.Latest]
+				sortSheetImages(images, request.Sort)
+			} else {
+				images = images[:request.Latest]
+			}
+		}
+		for i := range images {
+			grid = append(grid, &images[i])
+		}
+		result.Columns = min(request.Columns, len(grid))
+	}
+	if len(grid) > maxSheetCells {
+		return SheetResult{}, NewError(ErrInvalidInput, fmt.Sprintf("sheet would have %d cells; narrow it to %d with --latest, --series or --id", len(grid), maxSheetCells))
+	}
+	result.Rows = (len(grid) + result.Columns - 1) / result.Columns
+	for i, cell := range grid {
+		if cell == nil {
+			result.Cells = append(result.Cells, SheetCell{Series: result.Series[i%result.Columns], Input: inputs[i/result.Columns]})
+			continue
+		}
+		metadata := cell.record.Metadata
+		result.Cells = append(result.Cells, SheetCell{ImageID: metadata.ImageID, Series: metadata.Series.Name, Input: metadata.Input, Caption: sheetCaption(metadata.Prompts, request.Caption)})
+	}
+
+	sheet, err := engine.drawSheet(grid, &result, request)
+	if err != nil {
+		return SheetResult{}, err
+	}
+	result.Path = strings.TrimSpace(request.Out)
+	if result.Path == "" {
+		result.Path = engine.sheetPath(result, request)
+	}
+	if hasLeadingTilde(result.Path) {
+		return SheetResult{}, NewError(ErrInvalidInput, "sheet path must not start with '~'")
+	}
+	if !filepath.IsAbs(result.Path) {
+		result.Path = filepath.Join(engine.dataDir, result.Path)
+	}
+	result.Path = filepath.Clean(result.Path)
+	if err := os.MkdirAll(filepath.Dir(result.Path), 0o750); err != nil {
+		return SheetResult{}, WrapError(ErrMetadataInvalid, "create sheet directory", err)
+	}
+	if err := writePNG(result.Path, sheet); err != nil {
+		return SheetResult{}, WrapError(ErrMetadataInvalid, "write sheet", err)
+	}
+	return result, nil
+}
+
+func normalizeSheetRequest(request *SheetRequest) error {
+	request.Caption = strings.ToLower(strings.TrimSpace(request.Caption))
+	request.Sort = strings.ToLower(strings.TrimSpace(request.Sort))
+	if request.Caption == "" {
+		request.Caption = SheetCaptionTitle
+	}
+	if request.Sort == "" {
+		request.Sort = SheetSortInput
+	}
+	if request.Columns == 0 {
+		request.Columns = DefaultSheetColumns
+	}
+	if request.CellSize == 0 {
+		request.CellSize = DefaultSheetCellSize
+	}
+	switch request.Caption {
+	case SheetCaptionTitle, SheetCaptionTerse, SheetCaptionNone:
+	default:
+		return NewError(ErrInvalidInput, fmt.Sprintf("unknown sheet caption %q (want title, terse or none)", request.Caption))
+	}
+	switch request.Sort {
+	case SheetSortInput, SheetSortSeries, SheetSortTitle, SheetSortNewest:
+	default:
+		return NewError(ErrInvalidInput, fmt.Sprintf("unknown sheet sort %q (want input, series, title or newest)", request.Sort))
+	}
+	if request.Columns < 1 || request.Columns > 32 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("sheet columns %d is outside 1-32", request.Columns))
+	}
+	if request.CellSize < 32 || request.CellSize > 2048 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("sheet cell size %d is outside 32-2048", request.CellSize))
+	}
+	if request.Latest < 0 {
+		return NewError(ErrInvalidInput, "sheet latest count must not be negative")
+	}
+	series := []string{}
+	seen := map[string]bool{}
+	for _, name := range request.Series {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			series = append(series, name)
+			seen[name] = true
+		}
+	}
+	request.Series = series
+	if request.Compare && len(request.Series) < 2 {
+		return NewError(ErrInvalidInput, "a comparison sheet needs at least two series")
+	}
+	return nil
+}
+
+// sheetRecords returns the records the request selects. For comparison
+// sheets that is every record of the compared series whose input is one of
+// the chosen inputs.
+func (engine *Engine) sheetRecords(request SheetRequest) ([]ImageMetadataRecord, error) {
+	series := map[string]bool{}
+	for _, name := range request.Series {
+		series[name] = true
+	}
+	if len(request.IDs) > 0 && !request.Compare {
+		records := []ImageMetadataRecord{}
+		for _, id := range request.IDs {
+			record, err := engine.GetImage(strings.TrimSpace(id))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+	inputs := map[string]bool{}
+	for _, id := range request.IDs {
+		record, err := engine.GetImage(strings.TrimSpace(id))
+		if err != nil {
+			return nil, err
+		}
+		inputs[record.Metadata.Input] = true
+	}
+	all, err := engine.ListImages(ImageFilter{})
+	if err != nil {
+		return nil, err
+	}
+	records := []ImageMetadataRecord{}
+	for _, record := range all {
+		if len(series) > 0 && !series[record.Metadata.Series.Name] {
+			continue
+		}
+		if len(inputs) > 0 && !inputs[record.Metadata.Input] {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// decodableImage reports whether path holds an image, reading only its
+// header.
+func decodableImage(path string) bool {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	_, _, err = image.DecodeConfig(file)
+	return err == nil
+}
+
+func sheetSource(set ArtifactSet) string {
+	if strings.TrimSpace(set.Generated) != "" {
+		return set.Generated
+	}
+	return set.Annotated
+}
+
+func sheetCaption(prompts PromptSet, caption string) string {
+	switch caption {
+	case SheetCaptionNone:
+		return ""
+	case SheetCaptionTerse:
+		if strings.TrimSpace(prompts.TersePrompt) != "" {
+			return prompts.TersePrompt
+		}
+	}
+	return prompts.TitlePrompt
+}
+
+func sortSheetImages(images []sheetImage, order string) {
+	sort.SliceStable(images, func(left, right int) bool {
+		a, b := images[left].record.Metadata, images[right].record.Metadata
+		switch order {
+		case SheetSortNewest:
+			return images[left].modified > images[right].modified
+		case SheetSortSeries:
+			if a.Series.Name != b.Series.Name {
+				return a.Series.Name < b.Series.Name
+			}
+		case SheetSortTitle:
+			if a.Prompts.TitlePrompt != b.Prompts.TitlePrompt {
+				return a.Prompts.TitlePrompt < b.Prompts.TitlePrompt
+			}
+		}
+		return a.Input < b.Input
+	})
+}
+
+// compareGrid lays images out with one row per input and one column per
+// series, and returns the grid and the input of each row. Latest keeps the
+// inputs with the newest images. An input with several images in a series
+// shows the one with no overrides, else the first.
+func compareGrid(images []sheetImage, request SheetRequest) ([]*sheetImage, []string) {
+	series := request.Series
+	column := map[string]int{}
+	for i, name := range series {
+		column[name] = i
+	}
+	rows := map[string][]*sheetImage{}
+	newest := map[string]int64{}
+	inputs := []string{}
+	for i := range images {
+		entry := &images[i]
+		metadata := entry.record.Metadata
+		row, ok := rows[metadata.Input]
+		if !ok {
+			row = make([]*sheetImage, len(series))
+			rows[metadata.Input] = row
+			inputs = append(inputs, metadata.Input)
+		}
+		at := column[metadata.Series.Name]
+		if row[at] == nil || (derivedImage(row[at].record.Metadata) && !derivedImage(metadata)) {
+			row[at] = entry
+		}
+		newest[metadata.Input] = max(newest[metadata.Input], entry.modified)
+	}
+	sort.SliceStable(inputs, func(left, right int) bool {
+		if request.Sort == SheetSortNewest {
+			return newest[inputs[left]] > newest[inputs[right]]
+		}
+		return inputs[left] < inputs[right]
+	})
+	if request.Latest > 0 && len(inputs) > request.Latest {
+		sort.SliceStable(inputs, func(left, right int) bool { return newest[inputs[left]] > newest[inputs[right]] })
+		inputs = inputs[:request.Latest]
+		if request.Sort != SheetSortNewest {
+			sort.Strings(inputs)
+		}
+	}
+	grid := []*sheetImage{}
+	for _, input := range inputs {
+		grid = append(grid, rows[input]...)
+	}
+	return grid, inputs
+}
+
+// drawSheet renders the grid on white: each image fitted to its square cell
+// with its caption band below, and for comparison sheets a header row naming
+// the series. An image that fails to decode leaves an empty cell and is
+// moved to the skipped list.
+func (engine *Engine) drawSheet(grid []*sheetImage, result *SheetResult, request SheetRequest) (*image.RGBA, error) {
+	cell := request.CellSize
+	band := 0
+	if request.Caption != SheetCaptionNone {
+		band = int(float64(cell) * sheetBandShare)
+	}
+	header := 0
+	if request.Compare {
+		header = int(float64(cell)*sheetBandShare) + sheetGutter
+	}
+	width := result.Columns*cell + (result.Columns+1)*sheetGutter
+	height := header + result.Rows*(cell+band) + (result.Rows+1)*sheetGutter
+	if width > maxSheetSide || height > maxSheetSide {
+		return nil, NewError(ErrInvalidInput, fmt.Sprintf("sheet would be %dx%d pixels; use a smaller cell size or fewer images", width, height))
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	options := annotate.CaptionOptions{FontDir: filepath.Join(engine.dataDir, "fonts")}
+	empty := image.NewUniform(color.RGBA{R: 0xEE, G: 0xEE, B: 0xEE, A: 0xFF})
+	for i, name := range result.Series {
+		x := sheetGutter + i*(cell+sheetGutter)
+		box := image.Rect(x, sheetGutter, x+cell, header)
+		bold := options
+		bold.Font.Weight = annotate.WeightBold
+		if err := annotate.DrawCaption(sheet, box, name, bold); err != nil {
+			return nil, WrapError(ErrInvalidInput, "draw sheet header", err)
+		}
+	}
+	for i, entry := range grid {
+		x := sheetGutter + (i%result.Columns)*(cell+sheetGutter)
+		y := header + sheetGutter + (i/result.Columns)*(cell+band+sheetGutter)
+		box := image.Rect(x, y, x+cell, y+cell)
+		if entry == nil {
+			draw.Draw(sheet, box, empty, image.Point{}, draw.Src)
+			continue
+		}
+		img, err := decodeImageFile(entry.source)
+		if err != nil {
+			result.Skipped = append(result.Skipped, result.Cells[i].ImageID)
+			result.Cells[i].ImageID, result.Cells[i].Caption = "", ""
+			draw.Draw(sheet, box, empty, image.Point{}, draw.Src)
+			continue
+		}
+		bounds := img.Bounds()
+		scale := min(float64(cell)/float64(bounds.Dx()), float64(cell)/float64(bounds.Dy()))
+		w, h := max(1, int(float64(bounds.Dx())*scale+0.5)), max(1, int(float64(bounds.Dy())*scale+0.5))
+		target := image.Rect(0, 0, w, h).Add(image.Pt(x+(cell-w)/2, y+(cell-h)/2))
+		draw.CatmullRom.Scale(sheet, target, img, bounds, draw.Over, nil)
+		if band > 0 {
+			if err := annotate.DrawCaption(sheet, image.Rect(x, y+cell, x+cell, y+cell+band), result.Cells[i].Caption, options); err != nil {
+				return nil, WrapError(ErrInvalidInput, "draw sheet caption", err)
+			}
+		}
+	}
+	return sheet, nil
+}
+
+// sheetPath is output/<series>/sheets/<id>.png for a sheet of one series and
+// output/sheets/<id>.png otherwise, where the id is stable for the same cells
+// and layout.
+func (engine *Engine) sheetPath(result SheetResult, request SheetRequest) string {
+	parts := []string{request.Caption, strconv.Itoa(request.CellSize), strconv.Itoa(result.Columns), strconv.FormatBool(request.Compare)}
+	series := map[string]bool{}
+	for _, cell := range result.Cells {
+		parts = append(parts, cell.Series+"/"+cell.ImageID)
+		series[cell.Series] = true
+	}
+	digest := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	name := "sheet-" + hex.EncodeToString(digest[:8]) + ".png"
+	if request.Compare {
+		name = "compare-" + hex.EncodeToString(digest[:8]) + ".png"
+	}
+	if len(series) == 1 {
+		return filepath.Join(engine.dataDir, "output", safePathPart(result.Cells[0].Series), "sheets", name)
+	}
+	return filepath.Join(engine.dataDir, "output", "sheets", name)
+}
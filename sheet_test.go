@@ -0,0 +1,125 @@
+package dalle
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineImageSheet(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := engine.SaveSeries(Series{Suffix: "noir"}); err != nil {
+		t.Fatalf("SaveSeries: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	ids := map[string]string{}
+	for _, input := range []string{"alpha", "bravo", "charlie"} {
+		result, err := engine.Generate(GenerateRequest{Input: input, Image: true})
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		ids[input] = result.Metadata.ImageID
+	}
+	if _, err := engine.Generate(GenerateRequest{Input: "alpha", Series: "noir", Image: true}); err != nil {
+		t.Fatalf("Generate noir: %v", err)
+	}
+
+	sheet, err := engine.ImageSheet(SheetRequest{Series: []string{"empty"}, Columns: 2, CellSize: 64})
+	if err != nil {
+		t.Fatalf("ImageSheet: %v", err)
+	}
+	if sheet.Columns != 2 || sheet.Rows != 2 || len(sheet.Cells) != 3 || sheet.Cells[0].Input != "alpha" || sheet.Cells[0].Caption == "" {
+		t.Fatalf("unexpected sheet %+v", sheet)
+	}
+	if filepath.Base(filepath.Dir(sheet.Path)) != "sheets" {
+		t.Fatalf("unexpected sheet path %s", sheet.Path)
+	}
+	img, err := decodeImageFile(sheet.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cell := 64
+	band := int(float64(cell) * sheetBandShare)
+	if img.Bounds().Dx() != 2*64+3*sheetGutter || img.Bounds().Dy() != 2*(64+band)+3*sheetGutter {
+		t.Fatalf("unexpected sheet size %v", img.Bounds())
+	}
+	if got := color.RGBAModel.Convert(img.At(sheetGutter+32, sheetGutter+32)).(color.RGBA); got == (color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}) {
+		t.Fatal("expected an image in the first cell")
+	}
+
+	picked, err := engine.ImageSheet(SheetRequest{IDs: []string{ids["charlie"], ids["bravo"]}, Sort: SheetSortTitle, Caption: SheetCaptionNone, CellSize: 32})
+	if err != nil || len(picked.Cells) != 2 || picked.Cells[0].Caption != "" {
+		t.Fatalf("expected two uncaptioned cells, got %+v, %v", picked, err)
+	}
+	if latest, err := engine.ImageSheet(SheetRequest{Series: []string{"empty"}, Latest: 1, CellSize: 32}); err != nil || len(latest.Cells) != 1 {
+		t.Fatalf("expected one cell, got %+v, %v", latest, err)
+	}
+
+	compare, err := engine.ImageSheet(SheetRequest{Series: []string{"empty", "noir"}, Compare: true, CellSize: 64})
+	if err != nil {
+		t.Fatalf("ImageSheet compare: %v", err)
+	}
+	if compare.Columns != 2 || compare.Rows != 3 || len(compare.Cells) != 6 {
+		t.Fatalf("unexpected comparison %+v", compare)
+	}
+	if first := compare.Cells[:2]; first[0].Input != "alpha" || first[1].Series != "noir" || first[1].ImageID == "" {
+		t.Fatalf("expected alpha in both series, got %+v", first)
+	}
+	if missing := compare.Cells[3]; missing.ImageID != "" || missing.Input != "bravo" || missing.Series != "noir" {
+		t.Fatalf("expected an empty cell for bravo in noir, got %+v", missing)
+	}
+	if only, err := engine.ImageSheet(SheetRequest{Series: []string{"empty", "noir"}, IDs: []string{ids["alpha"]}, Compare: true, CellSize: 32}); err != nil || only.Rows != 1 {
+		t.Fatalf("expected the IDs to pick the compared inputs, got %+v, %v", only, err)
+	}
+
+	for name, request := range map[string]SheetRequest{
+		"one series": {Series: []string{"empty"}, Compare: true},
+		"caption":    {Caption: "seed"},
+		"sort":       {Sort: "size"},
+		"columns":    {Columns: 64},
+		"cell size":  {CellSize: 8},
+	} {
+		if _, err := engine.ImageSheet(request); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("%s: expected invalid input, got %v", name, err)
+		}
+	}
+}
+
+// Images are decoded only when drawn: one whose header reads but whose
+// pixels do not is still selected, then left as an empty, skipped cell.
+func TestEngineImageSheetDecodesOnlyDrawnCells(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	ids := []string{}
+	for _, input := range []string{"alpha", "bravo"} {
+		result, err := engine.Generate(GenerateRequest{Input: input, Image: true})
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		ids = append(ids, result.Metadata.ImageID)
+		if input == "bravo" {
+			contents, err := os.ReadFile(result.Metadata.Artifacts.Generated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Keep the signature and IHDR chunk only.
+			if err := os.WriteFile(result.Metadata.Artifacts.Generated, contents[:33], 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	sheet, err := engine.ImageSheet(SheetRequest{IDs: ids, CellSize: 32})
+	if err != nil {
+		t.Fatalf("ImageSheet: %v", err)
+	}
+	if len(sheet.Cells) != 2 || sheet.Cells[0].ImageID != ids[0] || sheet.Cells[1].ImageID != "" || len(sheet.Skipped) != 1 || sheet.Skipped[0] != ids[1] {
+		t.Fatalf("unexpected sheet %+v", sheet)
+	}
+}
@@ -0,0 +1,434 @@
+package dalle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestVersion is the format of signed image manifests.
+	ManifestVersion = "1"
+
+	signingKeyFile       = "signing.key"
+	signingPublicKeyFile = "signing.pub"
+)
+
+// SigningKey describes the data directory's signing key pair. PublicKey is
+// the raw ed25519 public key in base64, as recorded in manifests.
+type SigningKey struct {
+	PublicKey      string `json:"publicKey"`
+	PrivateKeyPath string `json:"privateKeyPath"`
+	PublicKeyPath  string `json:"publicKeyPath"`
+}
+
+// ManifestArtifact is the hash of one artifact at signing time. Path is
+// relative to the data directory when the artifact is inside it.
+type ManifestArtifact struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SignedManifest is a detached signature over an image's metadata record
+// and artifacts. Signature is the base64 ed25519 signature of the manifest's
+// compact JSON with Signature left empty.
+type SignedManifest struct {
+	ManifestVersion string             `json:"manifestVersion"`
+	ImageID         string             `json:"imageId"`
+	MetadataSHA256  string             `json:"metadataSha256"`
+	Artifacts       []ManifestArtifact `json:"artifacts"`
+	SignedAt        string             `json:"signedAt"`
+	PublicKey       string             `json:"publicKey"`
+	Signature       string             `json:"signature"`
+}
+
+// ArtifactCheck compares one signed artifact with the file on disk.
+type ArtifactCheck struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Status   string `json:"status"`
+}
+
+// ImageVerification reports whether an image still matches its signed
+// manifest. Tampered is set when the signature, the signing key, the
+// metadata or any artifact fails to check. File is set when a PNG was verified; FileArtifact names the
+// signed artifact it matches, or is empty when it matches none.
+type ImageVerification struct {
+	ImageID          string          `json:"imageId"`
+	ManifestPath     string          `json:"manifestPath"`
+	SignatureValid   bool            `json:"signatureValid"`
+	KeyTrusted       bool            `json:"keyTrusted"`
+	MetadataMatches  bool            `json:"metadataMatches"`
+	Artifacts        []ArtifactCheck `json:"artifacts"`
+	File             string          `json:"file,omitempty"`
+	FileArtifact     string          `json:"fileArtifact,omitempty"`
+	Tampered         bool            `json:"tampered"`
+	Problems         []string        `json:"problems,omitempty"`
+	SignedAt         string          `json:"signedAt"`
+	ManifestVersion  string          `json:"manifestVersion"`
+	SigningPublicKey string          `json:"signingPublicKey"`
+}
+
+// CreateSigningKey creates the ed25519 key pair used to sign image
+// manifests in the keys folder of the data directory. An existing key is
+// never replaced.
+func (engine *Engine) CreateSigningKey() (SigningKey, error) {
+	if engine == nil {
+		return SigningKey{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	privatePath, publicPath := engine.signingKeyPaths()
+	if _, err := os.Stat(privatePath); err == nil {
+		return SigningKey{}, NewError(ErrInvalidInput, "signing key already exists at "+privatePath)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "generate signing key", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "encode signing key", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "encode signing key", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(privatePath), 0o700); err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "create keys directory", err)
+	}
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600); err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "write signing key", err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o600); err != nil {
+		return SigningKey{}, WrapError(ErrInvalidInput, "write signing key", err)
+	}
+	return SigningKey{PublicKey: base64.StdEncoding.EncodeToString(public), PrivateKeyPath: privatePath, PublicKeyPath: publicPath}, nil
+}
+
+// SignImage writes a signed manifest for an image record, replacing any
+// earlier one.
+func (engine *Engine) SignImage(id string) (SignedManifest, error) {
+	if engine == nil {
+		return SignedManifest{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	record, err := engine.GetImage(id)
+	if err != nil {
+		return SignedManifest{}, err
+	}
+	return engine.signRecord(record)
+}
+
+// VerifyImage checks an image against its signed manifest. target is an
+// image ID, a seed, or the path of a PNG carrying provenance; a PNG is also
+// checked against the signed artifact hashes.
+func (engine *Engine) VerifyImage(target string) (ImageVerification, error) {
+	if engine == nil {
+		return ImageVerification{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if strings.TrimSpace(target) == "" {
+		return ImageVerification{}, NewError(ErrInvalidInput, "image ID or PNG path is required")
+	}
+	file := ""
+	id := target
+	if strings.EqualFold(filepath.Ext(target), ".png") {
+		provenance, _, err := readProvenance(filepath.Clean(target))
+		if err != nil {
+			return ImageVerification{}, err
+		}
+		if provenance == nil || provenance.ImageID == "" {
+			return ImageVerification{}, NewError(ErrMetadataInvalid, "PNG carries no image ID")
+		}
+		file, id = target, provenance.ImageID
+	}
+	record, err := engine.GetImage(id)
+	if err != nil {
+		return ImageVerification{}, err
+	}
+	manifestPath := manifestPathFor(record.Path)
+	contents, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ImageVerification{}, NewError(ErrArtifactMissing, "image has no signed manifest")
+		}
+		return ImageVerification{}, WrapError(ErrArtifactMissing, "read signed manifest", err)
+	}
+	var manifest SignedManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return ImageVerification{}, WrapError(ErrMetadataInvalid, "decode signed manifest", err)
+	}
+
+	verification := ImageVerification{
+		ImageID:          record.Metadata.ImageID,
+		ManifestPath:     manifestPath,
+		SignedAt:         manifest.SignedAt,
+		ManifestVersion:  manifest.ManifestVersion,
+		SigningPublicKey: manifest.PublicKey,
+		Artifacts:        []ArtifactCheck{},
+	}
+	// Every problem is tampering except a missing local key, which only
+	// means there is nothing to check the manifest's key against.
+	problem := func(format string, args ...any) {
+		verification.Problems = append(verification.Problems, fmt.Sprintf(format, args...))
+		verification.Tampered = true
+	}
+	verification.SignatureValid = manifest.verify()
+	if !verification.SignatureValid {
+		problem("signature does not match the manifest")
+	}
+	if trusted, err := engine.signingPublicKey(); err == nil {
+		verification.KeyTrusted = base64.StdEncoding.EncodeToString(trusted) == manifest.PublicKey
+		if !verification.KeyTrusted {
+			problem("manifest was signed with a key other than this data directory's")
+		}
+	} else {
+		verification.Problems = append(verification.Problems, "no signing key in the data directory to trust")
+	}
+	if manifest.ImageID != record.Metadata.ImageID {
+		problem("manifest is for image %s", manifest.ImageID)
+	}
+	digest, err := metadataDigest(record.Metadata)
+	if err != nil {
+		return ImageVerification{}, err
+	}
+	verification.MetadataMatches = digest == manifest.MetadataSHA256
+	if !verification.MetadataMatches {
+		problem("metadata record changed since signing")
+	}
+	for _, artifact := range manifest.Artifacts {
+		check := ArtifactCheck{Name: artifact.Name, Path: artifact.Path, Expected: artifact.SHA256, Status: ArtifactStatusOK}
+		sum, _, err := fileSHA256(engine.resolveDataPath(artifact.Path))
+		switch {
+		case os.IsNotExist(err):
+			check.Status = ArtifactStatusMissing
+			problem("%s artifact is missing", artifact.Name)
+		case err != nil:
+			return ImageVerification{}, WrapError(ErrArtifactMissing, "hash "+artifact.Name+" artifact", err)
+		case sum != artifact.SHA256:
+			check.Actual, check.Status = sum, ArtifactStatusChanged
+			problem("%s artifact changed since signing", artifact.Name)
+		default:
+			check.Actual = sum
+		}
+		verification.Artifacts = append(verification.Artifacts, check)
+	}
+	if file != "" {
+		verification.File = file
+		sum, _, err := fileSHA256(file)
+		if err != nil {
+			return ImageVerification{}, WrapError(ErrArtifactMissing, "hash PNG", err)
+		}
+		for _, artifact := range manifest.Artifacts {
+			if artifact.SHA256 == sum {
+				verification.FileArtifact = artifact.Name
+			}
+		}
+		if verification.FileArtifact == "" {
+			problem("PNG matches none of the signed artifacts")
+		}
+	}
+	return verification, nil
+}
+
+func (engine *Engine) signRecord(record ImageMetadataRecord) (SignedManifest, error) {
+	private, err := engine.signingPrivateKey()
+	if err != nil {
+		return SignedManifest{}, err
+	}
+	digest, err := metadataDigest(record.Metadata)
+	if err != nil {
+		return SignedManifest{}, err
+	}
+	manifest := SignedManifest{
+		ManifestVersion: ManifestVersion,
+		ImageID:         record.Metadata.ImageID,
+		MetadataSHA256:  digest,
+		Artifacts:       []ManifestArtifact{},
+		SignedAt:        time.Now().UTC().Format(time.RFC3339),
+		PublicKey:       base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)),
+	}
+	for _, artifact := range record.Metadata.Artifacts.Named() {
+		sum, size, err := fileSHA256(artifact.Path)
+		if err != nil {
+			return SignedManifest{}, WrapError(ErrArtifactMissing, "hash "+artifact.Name+" artifact", err)
+		}
+		manifest.Artifacts = append(manifest.Artifacts, ManifestArtifact{Name: artifact.Name, Path: engine.relativeDataPath(artifact.Path), Size: size, SHA256: sum})
+	}
+	payload, err := manifest.payload()
+	if err != nil {
+		return SignedManifest{}, err
+	}
+	manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, payload))
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return SignedManifest{}, WrapError(ErrMetadataInvalid, "encode signed manifest", err)
+	}
+	path := manifestPathFor(record.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return SignedManifest{}, WrapError(ErrMetadataInvalid, "create manifest directory", err)
+	}
+	if err := os.WriteFile(path, append(encoded, '\n'), 0o600); err != nil {
+		return SignedManifest{}, WrapError(ErrMetadataInvalid, "write signed manifest", err)
+	}
+	return manifest, nil
+}
+
+// signIfRequested signs the record just written to metadataPath when asked
+// to, or when it was signed before so that its manifest stays current.
+func (engine *Engine) signIfRequested(metadataPath string, sign bool) error {
+	if !sign && !fileExists(manifestPathFor(metadataPath)) {
+		return nil
+	}
+	// Sign the record as stored, with the defaults WriteImageMetadata fills in.
+	metadata, err := ReadImageMetadata(metadataPath)
+	if err != nil {
+		return err
+	}
+	_, err = engine.signRecord(ImageMetadataRecord{Path: metadataPath, Metadata: metadata})
+	return err
+}
+
+// payload is the byte string the signature covers.
+func (manifest SignedManifest) payload() ([]byte, error) {
+	manifest.Signature = ""
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, WrapError(ErrMetadataInvalid, "encode signed manifest", err)
+	}
+	return encoded, nil
+}
+
+func (manifest SignedManifest) verify() bool {
+	public, err := base64.StdEncoding.DecodeString(manifest.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return false
+	}
+	payload, err := manifest.payload()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(public), payload, signature)
+}
+
+// metadataDigest is the SHA-256 of the record's canonical JSON: compact,
+// with fields in declaration order and map keys sorted, and without the
+// per-call cache hit flag.
+func metadataDigest(metadata ImageMetadata) (string, error) {
+	metadata.Status.CacheHit = false
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return "", WrapError(ErrMetadataInvalid, "encode image metadata", err)
+	}
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// manifestPathFor puts a record's manifest in a manifests folder beside its
+// metadata folder, under the same name, so metadata listings never see it.
+func manifestPathFor(metadataPath string) string {
+	seriesDir := filepath.Dir(filepath.Dir(metadataPath))
+	return filepath.Join(seriesDir, "manifests", filepath.Base(metadataPath))
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func (engine *Engine) signingKeyPaths() (string, string) {
+	dir := filepath.Join(engine.dataDir, "keys")
+	return filepath.Join(dir, signingKeyFile), filepath.Join(dir, signingPublicKeyFile)
+}
+
+func (engine *Engine) signingPrivateKey() (ed25519.PrivateKey, error) {
+	privatePath, _ := engine.signingKeyPaths()
+	block, err := readPEM(privatePath, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, WrapError(ErrSigningKeyUnavailable, "parse signing key", err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, NewError(ErrSigningKeyUnavailable, "signing key is not an ed25519 key")
+	}
+	return private, nil
+}
+
+func (engine *Engine) signingPublicKey() (ed25519.PublicKey, error) {
+	_, publicPath := engine.signingKeyPaths()
+	block, err := readPEM(publicPath, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, WrapError(ErrSigningKeyUnavailable, "parse signing public key", err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, NewError(ErrSigningKeyUnavailable, "signing public key is not an ed25519 key")
+	}
+	return public, nil
+}
+
+func readPEM(path, kind string) (*pem.Block, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, NewError(ErrSigningKeyUnavailable, "no signing key at "+path+" (create one with `dalle keys create`)")
+		}
+		return nil, WrapError(ErrSigningKeyUnavailable, "read signing key", err)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != kind {
+		return nil, NewError(ErrSigningKeyUnavailable, path+" is not a PEM "+strings.ToLower(kind))
+	}
+	return block, nil
+}
+
+// relativeDataPath returns path relative to the data directory when it is
+// inside it, so manifests survive moving the data directory.
+func (engine *Engine) relativeDataPath(path string) string {
+	relative, err := filepath.Rel(engine.dataDir, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+		return path
+	}
+	return filepath.ToSlash(relative)
+}
+
+func (engine *Engine) resolveDataPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(engine.dataDir, filepath.FromSlash(path))
+}
@@ -0,0 +1,154 @@
+package dalle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineSignAndVerifyImage(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	request := GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true, Sign: true}
+	if _, err := engine.Generate(request); ErrorCodeOf(err) != ErrSigningKeyUnavailable {
+		t.Fatalf("expected signing without a key to fail, got %v", err)
+	}
+	if _, err := engine.CreateSigningKey(); err != nil {
+		t.Fatalf("CreateSigningKey: %v", err)
+	}
+	if _, err := engine.CreateSigningKey(); ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected an existing key to be kept, got %v", err)
+	}
+	request.Force = true
+	result, err := engine.Generate(request)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	id := result.Metadata.ImageID
+
+	verification, err := engine.VerifyImage(id)
+	if err != nil {
+		t.Fatalf("VerifyImage: %v", err)
+	}
+	if verification.Tampered || !verification.SignatureValid || !verification.KeyTrusted || !verification.MetadataMatches || len(verification.Artifacts) != 2 {
+		t.Fatalf("unexpected verification of a fresh image: %+v", verification)
+	}
+	if verification, err = engine.VerifyImage(result.AnnotatedPath); err != nil || verification.FileArtifact != "annotated" || verification.Tampered {
+		t.Fatalf("unexpected verification of the annotated PNG: %+v, %v", verification, err)
+	}
+
+	contents, err := os.ReadFile(result.GeneratedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(result.GeneratedPath, append(contents, 0), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	verification, err = engine.VerifyImage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Tampered || verification.Artifacts[0].Status != ArtifactStatusChanged || verification.Artifacts[1].Status != ArtifactStatusOK {
+		t.Fatalf("expected a changed generated artifact: %+v", verification)
+	}
+
+	if _, err := engine.RegenerateImage(id); err != nil {
+		t.Fatalf("RegenerateImage: %v", err)
+	}
+	if verification, err = engine.VerifyImage(id); err != nil || verification.Tampered {
+		t.Fatalf("expected regeneration to re-sign the image: %+v, %v", verification, err)
+	}
+
+	record, err := engine.GetImage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Metadata.Prompts.TersePrompt = "a forged caption"
+	encoded, _ := json.MarshalIndent(record.Metadata, "", "  ")
+	if err := os.WriteFile(record.Path, encoded, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if verification, err = engine.VerifyImage(id); err != nil || verification.MetadataMatches || !verification.Tampered {
+		t.Fatalf("expected an edited record to be reported: %+v, %v", verification, err)
+	}
+}
+
+func TestEngineSignsLineageAddedToCachedImages(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	if _, err := engine.CreateSigningKey(); err != nil {
+		t.Fatalf("CreateSigningKey: %v", err)
+	}
+	for _, test := range []struct {
+		input       string
+		signFirst   bool
+		signReached bool
+	}{
+		{"signed", true, false},
+		{"unsigned", false, true},
+	} {
+		first, err := engine.Generate(GenerateRequest{Input: test.input, Image: true, Sign: test.signFirst})
+		if err != nil {
+			t.Fatalf("%s: Generate: %v", test.input, err)
+		}
+		lineage := &MetadataLineage{StoryboardID: "board", Panel: 1}
+		if _, err := engine.generate(GenerateRequest{Input: test.input, Image: true, Sign: test.signReached}, lineage); err != nil {
+			t.Fatalf("%s: generate: %v", test.input, err)
+		}
+		verification, err := engine.VerifyImage(first.Metadata.ImageID)
+		if err != nil {
+			t.Fatalf("%s: VerifyImage: %v", test.input, err)
+		}
+		if verification.Tampered || !verification.MetadataMatches {
+			t.Fatalf("%s: expected the recorded lineage to be signed: %+v", test.input, verification)
+		}
+	}
+}
+
+func TestEngineVerifyImageRejectsForeignKey(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = annotatedMidTones
+	if _, err := engine.CreateSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Generate(GenerateRequest{Input: "foreign", Image: true, Sign: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dataDir, "keys")); err != nil {
+		t.Fatal(err)
+	}
+	verification, err := engine.VerifyImage(result.Metadata.ImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Tampered || verification.KeyTrusted || len(verification.Problems) != 1 {
+		t.Fatalf("expected only an untrusted-key note without a local key: %+v", verification)
+	}
+	if _, err := engine.CreateSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if verification, err = engine.VerifyImage(result.Metadata.ImageID); err != nil || !verification.Tampered || verification.KeyTrusted || !verification.SignatureValid {
+		t.Fatalf("expected a foreign key to be reported: %+v, %v", verification, err)
+	}
+
+	unsigned, err := engine.Generate(GenerateRequest{Input: "unsigned", Image: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.VerifyImage(unsigned.Metadata.ImageID); ErrorCodeOf(err) != ErrArtifactMissing {
+		t.Fatalf("expected an unsigned image to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package dalle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrueBlocks/trueblocks-dalle/v6/pkg/prompt"
+	"golang.org/x/image/draw"
+)
+
+const (
+	DefaultStoryboardPanels = 6
+	MinStoryboardPanels     = 6
+	MaxStoryboardPanels     = 12
+
+	StoryboardCompositeStrip = "strip"
+	StoryboardCompositeGrid  = "grid"
+
+	storyboardCellWidth = 512
+	storyboardGutter    = 8
+)
+
+// DefaultStoryboardVaried lists the attributes that change from panel to panel
+// when a storyboard request does not name its own fixed set. Everything else
+// (creature, occupation, emotion, styles, colors) is held from the base seed.
+var DefaultStoryboardVaried = []string{"action", "place", "viewpoint", "composition"}
+
+// StoryboardRequest describes a sequence of panels over one base seed. Fixed
+// names the attributes held across every panel; the remaining attributes are
+// varied per panel. When Fixed is empty every attribute except
+// DefaultStoryboardVaried is held. Overrides pin attributes for all panels.
+// Composite, when "strip" or "grid", renders the panel images into one PNG.
+type StoryboardRequest struct {
+	Input      string            `json:"input"`
+	InputKind  string            `json:"inputKind,omitempty"`
+	Seed       string            `json:"seed,omitempty"`
+	Series     string            `json:"series,omitempty"`
+	Recipe     string            `json:"recipe,omitempty"`
+	Backstyle  string            `json:"backstyle,omitempty"`
+	Overrides  map[string]string `json:"overrides,omitempty"`
+	SeedScheme string            `json:"seedScheme,omitempty"`
+	Panels     int               `json:"panels,omitempty"`
+	Fixed      []string          `json:"fixed,omitempty"`
+	Composite  string            `json:"composite,omitempty"`
+	Preview    bool              `json:"preview,omitempty"`
+	Enhance    bool              `json:"enhance,omitempty"`
+	Image      bool              `json:"image,omitempty"`
+	Annotate   bool              `json:"annotate,omitempty"`
+}
+
+type StoryboardResult struct {
+	StoryboardID  string           `json:"storyboardId"`
+	Fixed         []string         `json:"fixed"`
+	Varied        []string         `json:"varied"`
+	Panels        []GenerateResult `json:"panels"`
+	CompositePath string           `json:"compositePath,omitempty"`
+}
+
+// Storyboard generates a linked set of panels that share a storyboard id. Each
+// panel keeps the fixed attributes of the base seed and picks every varied
+// attribute from a hash of the seed and panel number, so the same request
+// always yields the same panels. The varied picks are recorded as reseeds, so
+// only the request's own Overrides are marked as pinned.
+func (engine *Engine) Storyboard(request StoryboardRequest) (StoryboardResult, error) {
+	if engine == nil {
+		return StoryboardResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if request.Panels == 0 {
+		request.Panels = DefaultStoryboardPanels
+	}
+	if request.Panels < MinStoryboardPanels || request.Panels > MaxStoryboardPanels {
+		return StoryboardResult{}, NewError(ErrInvalidInput, fmt.Sprintf("storyboard panels must be between %d and %d", MinStoryboardPanels, MaxStoryboardPanels))
+	}
+	composite := strings.ToLower(strings.TrimSpace(request.Composite))
+	if composite != "" && composite != StoryboardCompositeStrip && composite != StoryboardCompositeGrid {
+		return StoryboardResult{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown storyboard composite %q", request.Composite))
+	}
+	if composite != "" && (request.Preview || !request.Image) {
+		return StoryboardResult{}, NewError(ErrInvalidInput, "storyboard composite requires image generation")
+	}
+	fixed, varied, err := storyboardAttributes(request.Fixed)
+	if err != nil {
+		return StoryboardResult{}, err
+	}
+	overrides, err := NormalizeOverrides(request.Overrides)
+	if err != nil {
+		return StoryboardResult{}, err
+	}
+	base, err := engine.NewMetadata(GenerateRequest{Input: request.Input, InputKind: request.InputKind, Seed: request.Seed, Series: request.Series, Recipe: request.Recipe, SeedScheme: request.SeedScheme})
+	if err != nil {
+		return StoryboardResult{}, err
+	}
+	ctx, err := engine.seriesContext(base.Series.Name)
+	if err != nil {
+		return StoryboardResult{}, err
+	}
+
+	storyboardID := storyboardIdentifier(base, fixed, overrides, request.Panels)
+	result := StoryboardResult{StoryboardID: storyboardID, Fixed: fixed, Varied: varied}
+	for panel := 1; panel <= request.Panels; panel++ {
+		reseeds := make(map[string]int, len(varied))
+		for _, name := range varied {
+			if _, pinned := overrides[name]; pinned {
+				continue
+			}
+			size := len(ctx.Databases[attributeDatabase(name)])
+			if size == 0 {
+				return result, NewError(ErrInvalidInput, fmt.Sprintf("database for %s is empty in series %s", name, base.Series.Name))
+			}
+			reseeds[name] = reseedRow(base.Seed, "storyboard/"+name, panel, size)
+		}
+		generateRequest := GenerateRequest{
+			Input:      base.Input,
+			InputKind:  storedInputKind(base),
+			Seed:       base.Seed,
+			Series:     base.Series.Name,
+			Recipe:     base.Recipe.Name,
+			Backstyle:  request.Backstyle,
+			Overrides:  overrides,
+			reseeds:    reseeds,
+			SeedScheme: base.Recipe.SeedSchemeReference(),
+			Enhance:    request.Enhance,
+			Image:      request.Image,
+			Annotate:   request.Annotate,
+		}
+		lineage := &MetadataLineage{StoryboardID: storyboardID, Panel: panel}
+		var panelResult GenerateResult
+		if request.Preview {
+			panelResult, err = engine.preview(generateRequest, lineage)
+		} else {
+			panelResult, err = engine.generate(generateRequest, lineage)
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Panels = append(result.Panels, panelResult)
+	}
+
+	if composite != "" {
+		path := filepath.Join(engine.dataDir, "output", safePathPart(base.Series.Name), "storyboards", storyboardID+"-"+composite+".png")
+		if err := writeStoryboardComposite(path, composite, result.Panels); err != nil {
+			return result, err
+		}
+		result.CompositePath = path
+	}
+	return result, nil
+}
+
+// storyboardAttributes splits the attribute names into the fixed and varied
+// sets, both in attribute order.
+func storyboardAttributes(requested []string) ([]string, []string, error) {
+	hold := map[string]bool{}
+	if len(requested) == 0 {
+		for _, name := range prompt.AttributeNames() {
+			hold[name] = true
+		}
+		for _, name := range DefaultStoryboardVaried {
+			delete(hold, name)
+		}
+	}
+	for _, name := range requested {
+		canonical, ok := canonicalAttributeName(name)
+		if !ok {
+			return nil, nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown storyboard attribute %q", name))
+		}
+		hold[canonical] = true
+	}
+	fixed := []string{}
+	varied := []string{}
+	for _, name := range prompt.AttributeNames() {
+		if hold[name] {
+			fixed = append(fixed, name)
+		} else {
+			varied = append(varied, name)
+		}
+	}
+	if len(varied) == 0 {
+		return nil, nil, NewError(ErrInvalidInput, "storyboard must vary at least one attribute")
+	}
+	return fixed, varied, nil
+}
+
+func attributeDatabase(name string) string {
+	for index, candidate := range prompt.AttributeNames() {
+		if candidate == name {
+			return prompt.DatabaseNames[index]
+		}
+	}
+	return ""
+}
+
+// storyboardIdentifier is stable for a given base image, fixed set, pinned
+// overrides and panel count, so re-running a storyboard links to the same set.
+func storyboardIdentifier(base ImageMetadata, fixed []string, overrides map[string]string, panels int) string {
+	sorted := append([]string(nil), fixed...)
+	sort.Strings(sorted)
+	digest := sha256.Sum256([]byte(strings.Join([]string{
+		base.Seed,
+		base.Series.Name,
+		base.Recipe.Name,
+		base.Recipe.SeedSchemeReference(),
+		strings.Join(sorted, ","),
+		canonicalOverrides(overrides),
+		strconv.Itoa(panels),
+	}, "\n")))
+	return hex.EncodeToString(digest[:8])
+}
+
+// writeStoryboardComposite lays the panel images out left to right, either in
+// one row (strip) or in a near-square grid. Panels are scaled to a common cell
+// size taken from the first panel.
+func writeStoryboardComposite(path, layout string, panels []GenerateResult) error {
+	images := make([]image.Image, 0, len(panels))
+	for _, panel := range panels {
+		source := panel.AnnotatedPath
+		if source == "" {
+			source = panel.GeneratedPath
+		}
+		if source == "" {
+			return NewError(ErrArtifactMissing, "storyboard panel has no image")
+		}
+		img, err := decodePNG(source)
+		if err != nil {
+			return WrapError(ErrArtifactMissing, "read storyboard panel", err)
+		}
+		images = append(images, img)
+	}
+
+	first := images[0].Bounds()
+	cellWidth := min(first.Dx(), storyboardCellWidth)
+	cellHeight := int(math.Round(float64(first.Dy()) * float64(cellWidth) / float64(first.Dx())))
+	columns := len(images)
+	if layout == StoryboardCompositeGrid {
+		columns = int(math.Ceil(math.Sqrt(float64(len(images)))))
+	}
+	rows := (len(images) + columns - 1) / columns
+	canvas := image.NewRGBA(image.Rect(0, 0,
+		columns*cellWidth+(columns+1)*storyboardGutter,
+		rows*cellHeight+(rows+1)*storyboardGutter))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for index, img := range images {
+		x := storyboardGutter + (index%columns)*(cellWidth+storyboardGutter)
+		y := storyboardGutter + (index/columns)*(cellHeight+storyboardGutter)
+		draw.CatmullRom.Scale(canvas, image.Rect(x, y, x+cellWidth, y+cellHeight), img, img.Bounds(), draw.Over, nil)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return WrapError(ErrMetadataInvalid, "create storyboard directory", err)
+	}
+	if err := writePNG(path, canvas); err != nil {
+		return WrapError(ErrMetadataInvalid, "write storyboard composite", err)
+	}
+	return nil
+}
+
+func decodePNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
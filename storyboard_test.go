@@ -0,0 +1,159 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineStoryboardHoldsFixedAttributes(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	request := StoryboardRequest{Input: "Person Tour Coordinates", Panels: 8, Preview: true}
+	result, err := engine.Storyboard(request)
+	if err != nil {
+		t.Fatalf("Storyboard: %v", err)
+	}
+	if result.StoryboardID == "" || len(result.Panels) != 8 {
+		t.Fatalf("unexpected storyboard: %#v", result)
+	}
+	if len(result.Varied) != len(DefaultStoryboardVaried) {
+		t.Fatalf("expected default varied set, got %v", result.Varied)
+	}
+	varied := map[string]bool{}
+	for _, name := range result.Varied {
+		varied[name] = true
+	}
+	first := result.Panels[0].Metadata
+	places := map[string]bool{}
+	for index, panel := range result.Panels {
+		metadata := panel.Metadata
+		if metadata.Lineage == nil || metadata.Lineage.StoryboardID != result.StoryboardID || metadata.Lineage.Panel != index+1 {
+			t.Fatalf("panel %d lineage: %#v", index+1, metadata.Lineage)
+		}
+		if len(metadata.Overrides) != 0 || len(metadata.Reseeds) != len(result.Varied) {
+			t.Fatalf("panel %d should record its varied rows as reseeds: %v %v", index+1, metadata.Overrides, metadata.Reseeds)
+		}
+		for i, record := range metadata.SelectedRecords {
+			if record.Overridden {
+				t.Fatalf("panel %d marks %s as pinned", index+1, record.Attribute)
+			}
+			if varied[record.Attribute] && record.RowIndex != metadata.Reseeds[record.Attribute] {
+				t.Fatalf("panel %d %s is row %d, reseeded %d", index+1, record.Attribute, record.RowIndex, metadata.Reseeds[record.Attribute])
+			}
+			if !varied[record.Attribute] && record.Record != first.SelectedRecords[i].Record {
+				t.Fatalf("fixed attribute %s changed on panel %d", record.Attribute, index+1)
+			}
+			if record.Attribute == "place" {
+				places[record.Record] = true
+			}
+		}
+	}
+	if len(places) < 2 {
+		t.Fatalf("expected places to vary across panels")
+	}
+
+	again, err := engine.Storyboard(request)
+	if err != nil {
+		t.Fatalf("Storyboard again: %v", err)
+	}
+	if again.StoryboardID != result.StoryboardID {
+		t.Fatalf("storyboard id is not deterministic")
+	}
+	for index := range again.Panels {
+		if again.Panels[index].Metadata.ImageID != result.Panels[index].Metadata.ImageID {
+			t.Fatalf("panel %d is not deterministic", index+1)
+		}
+	}
+}
+
+func TestEngineStoryboardPinsOnlyRequestedOverrides(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	result, err := engine.Storyboard(StoryboardRequest{Input: "Person Tour Coordinates", Overrides: map[string]string{"place": "0", "emotion": "1"}, Preview: true})
+	if err != nil {
+		t.Fatalf("Storyboard: %v", err)
+	}
+	for index, panel := range result.Panels {
+		metadata := panel.Metadata
+		if _, ok := metadata.Reseeds["place"]; ok || len(metadata.Overrides) != 2 {
+			t.Fatalf("panel %d: overrides %v, reseeds %v", index+1, metadata.Overrides, metadata.Reseeds)
+		}
+		for _, record := range metadata.SelectedRecords {
+			pinned := record.Attribute == "place" || record.Attribute == "emotion"
+			if record.Overridden != pinned {
+				t.Fatalf("panel %d: %s overridden=%v", index+1, record.Attribute, record.Overridden)
+			}
+		}
+		stored, err := engine.GetImage(metadata.ImageID)
+		if err != nil || stored.Metadata.Reseeds["action"] != metadata.Reseeds["action"] {
+			t.Fatalf("panel %d reseeds not persisted: %v", index+1, err)
+		}
+	}
+}
+
+func TestEngineStoryboardRejectsInvalidRequests(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, request := range []StoryboardRequest{
+		{Input: "x", Panels: 3, Preview: true},
+		{Input: "x", Panels: 13, Preview: true},
+		{Input: "x", Fixed: []string{"shoeSize"}, Preview: true},
+		{Input: "x", Composite: "grid", Preview: true},
+		{Input: "x", Composite: "mosaic", Image: true},
+	} {
+		if _, err := engine.Storyboard(request); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Fatalf("expected invalid input for %#v, got %v", request, err)
+		}
+	}
+}
+
+func TestEngineStoryboardComposite(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = func(request imageRequest) (imageResult, error) {
+		if err := os.MkdirAll(filepath.Dir(request.generatedPath), 0o750); err != nil {
+			return imageResult{}, err
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+		for x := 0; x < 40; x++ {
+			for y := 0; y < 30; y++ {
+				img.Set(x, y, color.RGBA{R: 200, A: 255})
+			}
+		}
+		file, err := os.Create(request.generatedPath)
+		if err != nil {
+			return imageResult{}, err
+		}
+		defer file.Close()
+		return imageResult{generatedPath: request.generatedPath}, png.Encode(file, img)
+	}
+	result, err := engine.Storyboard(StoryboardRequest{Input: "Person Tour Coordinates", Image: true, Composite: StoryboardCompositeGrid})
+	if err != nil {
+		t.Fatalf("Storyboard: %v", err)
+	}
+	file, err := os.Open(result.CompositePath)
+	if err != nil {
+		t.Fatalf("open composite: %v", err)
+	}
+	defer file.Close()
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("decode composite: %v", err)
+	}
+	// Six panels in a 3x2 grid of 40x30 cells with 8px gutters.
+	if config.Width != 3*40+4*storyboardGutter || config.Height != 2*30+3*storyboardGutter {
+		t.Fatalf("unexpected composite size %dx%d", config.Width, config.Height)
+	}
+}
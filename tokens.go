@@ -0,0 +1,382 @@
+package dalle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultTokenHost is where contracts/dalle.sol points _baseURI, followed
+	// by the series name.
+	DefaultTokenHost = "http://192.34.63.136:8080/dalle/"
+
+	DefaultCollectionName = "DalleDressV1"
+	tokenSymbol           = "DD"
+)
+
+// TokenExportOptions selects the images of a series to publish as tokens.
+// An image keeps the token id it was first exported with (see
+// tokenNumbering); images new to the series take the next free ids in
+// listing order, or in the order of IDs when given, starting from Start
+// (default 1, the contract's first token) in a series never exported
+// before. BaseURI is the
+// contract's base URI (DefaultTokenHost/<series>/ when empty) and
+// ImageBaseURI where the token images are served (BaseURI/images/ when
+// empty). Artifact picks the annotated (default) or generated image.
+type TokenExportOptions struct {
+	Series       string
+	IDs          []string
+	Out          string
+	Start        int
+	BaseURI      string
+	ImageBaseURI string
+	ExternalURL  string
+	Artifact     string
+	Name         string
+}
+
+// TokenAttribute is an OpenSea trait.
+type TokenAttribute struct {
+	TraitType string `json:"trait_type"`
+	Value     string `json:"value"`
+}
+
+// TokenMetadata is the ERC-721 metadata JSON served at tokenURI.
+type TokenMetadata struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Image       string           `json:"image"`
+	ExternalURL string           `json:"external_url,omitempty"`
+	Attributes  []TokenAttribute `json:"attributes"`
+}
+
+// CollectionMetadata is contract.json, the collection-level metadata
+// served at contractURI.
+type CollectionMetadata struct {
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	Description string `json:"description"`
+	Image       string `json:"image,omitempty"`
+	ExternalURL string `json:"external_link,omitempty"`
+}
+
+type TokenFile struct {
+	TokenID int    `json:"tokenId"`
+	ImageID string `json:"imageId"`
+	Path    string `json:"path"`
+	Image   string `json:"image"`
+	URI     string `json:"uri"`
+}
+
+type TokenExportResult struct {
+	Dir      string      `json:"dir"`
+	BaseURI  string      `json:"baseUri"`
+	Contract string      `json:"contract"`
+	Tokens   []TokenFile `json:"tokens"`
+	Skipped  []string    `json:"skipped,omitempty"`
+}
+
+// tokenPlan is the numbered list of images a token export publishes, with
+// the options filled in.
+type tokenPlan struct {
+	options      TokenExportOptions
+	series       string
+	baseURI      string
+	imageBaseURI string
+	numbering    tokenNumbering
+	tokens       []plannedToken
+	skipped      []string
+}
+
+// tokenNumbering is the token id of every image of a series ever exported,
+// saved as output/<series>/tokens.json. Ids are never reassigned, so the
+// tokenURI of a minted token keeps pointing at the same art however the
+// series changes; the ids of deleted images stay taken.
+type tokenNumbering struct {
+	path    string
+	changed bool
+	Series  string          `json:"series"`
+	Tokens  []tokenAssigned `json:"tokens"`
+}
+
+type tokenAssigned struct {
+	TokenID int    `json:"tokenId"`
+	ImageID string `json:"imageId"`
+}
+
+type plannedToken struct {
+	id       int
+	metadata ImageMetadata
+	source   string
+}
+
+// ExportTokens writes ERC-721 metadata for every selected image as
+// <dir>/<tokenId> (the contract appends the token id to its base URI), the
+// token images as <dir>/images/<tokenId>.png and the collection metadata as
+// <dir>/contract.json. Images with no artifact on disk are skipped and take
+// no token id.
+func (engine *Engine) ExportTokens(options TokenExportOptions) (TokenExportResult, error) {
+	if engine == nil {
+		return TokenExportResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	plan, err := engine.planTokens(options)
+	if err != nil {
+		return TokenExportResult{}, err
+	}
+	dir := strings.TrimSpace(plan.options.Out)
+	if dir == "" {
+		dir = filepath.Join(engine.dataDir, "output", safePathPart(plan.series), "tokens")
+	}
+	if hasLeadingTilde(dir) {
+		return TokenExportResult{}, NewError(ErrInvalidInput, "token directory must not start with '~'")
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(engine.dataDir, dir)
+	}
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "images"), 0o750); err != nil {
+		return TokenExportResult{}, WrapError(ErrMetadataInvalid, "create token directory", err)
+	}
+
+	result := TokenExportResult{Dir: dir, BaseURI: plan.baseURI, Contract: filepath.Join(dir, "contract.json"), Tokens: []TokenFile{}, Skipped: plan.skipped}
+	for _, token := range plan.tokens {
+		id := strconv.Itoa(token.id)
+		image := filepath.Join(dir, "images", token.imageName())
+		if err := publishAsset(token.source, image, false); err != nil {
+			return TokenExportResult{}, WrapError(ErrArtifactMissing, "copy token image", err)
+		}
+		path := filepath.Join(dir, id)
+		if err := writeTokenJSON(path, plan.token(token, plan.imageBaseURI)); err != nil {
+			return TokenExportResult{}, err
+		}
+		result.Tokens = append(result.Tokens, TokenFile{TokenID: token.id, ImageID: token.metadata.ImageID, Path: path, Image: image, URI: plan.baseURI + id})
+	}
+	if err := writeTokenJSON(result.Contract, plan.collection(plan.imageBaseURI)); err != nil {
+		return TokenExportResult{}, err
+	}
+	if err := plan.numbering.save(); err != nil {
+		return TokenExportResult{}, err
+	}
+	return result, nil
+}
+
+// planTokens checks the options and numbers the images that have an
+// artifact on disk, ordered by token id. New ids are only saved by
+// tokenNumbering.save once the export is written.
+func (engine *Engine) planTokens(options TokenExportOptions) (tokenPlan, error) {
+	series := strings.TrimSpace(options.Series)
+	if series == "" {
+		return tokenPlan{}, NewError(ErrInvalidInput, "token export series is required")
+	}
+	if options.Start < 0 {
+		return tokenPlan{}, NewError(ErrInvalidInput, "first token id must not be negative")
+	}
+	numbering, err := engine.loadTokenNumbering(series)
+	if err != nil {
+		return tokenPlan{}, err
+	}
+	switch {
+	case len(numbering.Tokens) == 0 && options.Start == 0:
+		options.Start = 1
+	case len(numbering.Tokens) > 0 && options.Start != 0 && options.Start != numbering.Tokens[0].TokenID:
+		return tokenPlan{}, NewError(ErrInvalidInput, fmt.Sprintf("series %s is already numbered from token %d; token ids are never reassigned", series, numbering.Tokens[0].TokenID))
+	}
+	switch options.Artifact {
+	case "":
+		options.Artifact = ArtifactAnnotated
+	case ArtifactAnnotated, ArtifactGenerated:
+	default:
+		return tokenPlan{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown token artifact %q (want annotated or generated)", options.Artifact))
+	}
+	if options.Name == "" {
+		options.Name = DefaultCollectionName
+	}
+	plan := tokenPlan{options: options, series: series, numbering: numbering}
+	plan.baseURI = strings.TrimSpace(options.BaseURI)
+	if plan.baseURI == "" {
+		plan.baseURI = DefaultTokenHost + series + "/"
+	}
+	plan.baseURI = strings.TrimSuffix(plan.baseURI, "/") + "/"
+	plan.imageBaseURI = strings.TrimSpace(options.ImageBaseURI)
+	if plan.imageBaseURI == "" {
+		plan.imageBaseURI = plan.baseURI + "images/"
+	}
+	plan.imageBaseURI = strings.TrimSuffix(plan.imageBaseURI, "/") + "/"
+
+	records, err := engine.tokenRecords(series, options.IDs)
+	if err != nil {
+		return tokenPlan{}, err
+	}
+	for _, record := range records {
+		source := tokenSource(record.Metadata.Artifacts, options.Artifact)
+		if source == "" {
+			plan.skipped = append(plan.skipped, record.Metadata.ImageID)
+			continue
+		}
+		id := plan.numbering.id(record.Metadata.ImageID, options.Start)
+		plan.tokens = append(plan.tokens, plannedToken{id: id, metadata: record.Metadata, source: source})
+	}
+	if len(plan.tokens) == 0 {
+		return tokenPlan{}, NewError(ErrArtifactMissing, fmt.Sprintf("series %s has no images on disk", series))
+	}
+	sort.SliceStable(plan.tokens, func(i, j int) bool { return plan.tokens[i].id < plan.tokens[j].id })
+	return plan, nil
+}
+
+func (engine *Engine) loadTokenNumbering(series string) (tokenNumbering, error) {
+	numbering := tokenNumbering{
+		path:   filepath.Join(engine.dataDir, "output", safePathPart(series), "tokens.json"),
+		Series: series,
+		Tokens: []tokenAssigned{},
+	}
+	contents, err := os.ReadFile(numbering.path)
+	if os.IsNotExist(err) {
+		return numbering, nil
+	}
+	if err != nil {
+		return tokenNumbering{}, WrapError(ErrMetadataInvalid, "read token ids", err)
+	}
+	if err := json.Unmarshal(contents, &numbering); err != nil {
+		return tokenNumbering{}, WrapError(ErrMetadataInvalid, "decode token ids", err)
+	}
+	sort.SliceStable(numbering.Tokens, func(i, j int) bool { return numbering.Tokens[i].TokenID < numbering.Tokens[j].TokenID })
+	return numbering, nil
+}
+
+// id returns the token id of an image, giving it the next free one (at
+// least start) when it has none yet.
+func (numbering *tokenNumbering) id(imageID string, start int) int {
+	for _, token := range numbering.Tokens {
+		if token.ImageID == imageID {
+			return token.TokenID
+		}
+	}
+	next := start
+	if count := len(numbering.Tokens); count > 0 {
+		next = max(next, numbering.Tokens[count-1].TokenID+1)
+	}
+	numbering.Tokens = append(numbering.Tokens, tokenAssigned{TokenID: next, ImageID: imageID})
+	numbering.changed = true
+	return next
+}
+
+func (numbering tokenNumbering) save() error {
+	if !numbering.changed {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(numbering.path), 0o750); err != nil {
+		return WrapError(ErrMetadataInvalid, "create token ids directory", err)
+	}
+	encoded, err := json.MarshalIndent(numbering, "", "  ")
+	if err != nil {
+		return WrapError(ErrMetadataInvalid, "encode token ids", err)
+	}
+	if err := os.WriteFile(numbering.path, append(encoded, '\n'), 0o600); err != nil {
+		return WrapError(ErrMetadataInvalid, "write token ids", err)
+	}
+	return nil
+}
+
+func (token plannedToken) imageName() string {
+	return strconv.Itoa(token.id) + strings.ToLower(filepath.Ext(token.source))
+}
+
+func (plan tokenPlan) token(token plannedToken, imageBaseURI string) TokenMetadata {
+	return tokenMetadata(token.metadata, imageBaseURI+token.imageName(), plan.options.ExternalURL)
+}
+
+func (plan tokenPlan) collection(imageBaseURI string) CollectionMetadata {
+	return CollectionMetadata{
+		Name:        plan.options.Name,
+		Symbol:      tokenSymbol,
+		Description: fmt.Sprintf("%s: %d DalleDress images from the %s series.", plan.options.Name, len(plan.tokens), plan.series),
+		Image:       imageBaseURI + plan.tokens[0].imageName(),
+		ExternalURL: plan.options.ExternalURL,
+	}
+}
+
+func (engine *Engine) tokenRecords(series string, ids []string) ([]ImageMetadataRecord, error) {
+	if len(ids) == 0 {
+		records, err := engine.ListImages(ImageFilter{Series: series})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, NewError(ErrArtifactMissing, fmt.Sprintf("series %s has no images", series))
+		}
+		return records, nil
+	}
+	records := []ImageMetadataRecord{}
+	for _, id := range ids {
+		record, err := engine.getImageInSeries(strings.TrimSpace(id), series)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// tokenSource is the artifact a token shows, falling back to the other of
+// annotated and generated when the preferred one is not on disk.
+func tokenSource(set ArtifactSet, preferred string) string {
+	candidates := []string{set.Annotated, set.Generated}
+	if preferred == ArtifactGenerated {
+		candidates = []string{set.Generated, set.Annotated}
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); strings.TrimSpace(path) != "" && err == nil && info.Size() > 0 {
+			return path
+		}
+	}
+	return ""
+}
+
+// tokenMetadata names the token after the title prompt, describes it with
+// the enhanced prompt (or the terse prompt when not enhanced) and lists
+// every selected attribute as a trait, followed by the series.
+func tokenMetadata(metadata ImageMetadata, image, externalURL string) TokenMetadata {
+	token := TokenMetadata{
+		Name:        metadata.Prompts.TitlePrompt,
+		Description: metadata.Prompts.EnhancedPrompt,
+		Image:       image,
+		ExternalURL: externalURL,
+		Attributes:  []TokenAttribute{},
+	}
+	if strings.TrimSpace(token.Name) == "" {
+		token.Name = metadata.Input
+	}
+	if strings.TrimSpace(token.Description) == "" {
+		token.Description = metadata.Prompts.TersePrompt
+	}
+	for _, record := range metadata.SelectedRecords {
+		value, _, _ := strings.Cut(record.Record, ",")
+		token.Attributes = append(token.Attributes, TokenAttribute{TraitType: record.Attribute, Value: value})
+	}
+	token.Attributes = append(token.Attributes, TokenAttribute{TraitType: "series", Value: metadata.Series.Name})
+	return token
+}
+
+func writeTokenJSON(path string, value any) error {
+	encoded, err := encodeTokenJSON(value)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encoded, 0o600); err != nil {
+		return WrapError(ErrMetadataInvalid, "write token metadata", err)
+	}
+	return nil
+}
+
+func encodeTokenJSON(value any) ([]byte, error) {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, WrapError(ErrMetadataInvalid, "encode token metadata", err)
+	}
+	return append(encoded, '\n'), nil
+}
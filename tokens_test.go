@@ -0,0 +1,120 @@
+package dalle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineExportTokens(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	first, err := engine.Generate(GenerateRequest{Input: "alpha", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	second, err := engine.Generate(GenerateRequest{Input: "bravo", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := engine.Generate(GenerateRequest{Input: "charlie"}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	result, err := engine.ExportTokens(TokenExportOptions{Series: first.Series})
+	if err != nil {
+		t.Fatalf("ExportTokens: %v", err)
+	}
+	if len(result.Tokens) != 2 || len(result.Skipped) != 1 || result.BaseURI != DefaultTokenHost+first.Series+"/" {
+		t.Fatalf("unexpected export %+v", result)
+	}
+	if token := result.Tokens[0]; token.TokenID != 1 || token.ImageID != first.Metadata.ImageID || filepath.Base(token.Path) != "1" || token.URI != result.BaseURI+"1" {
+		t.Fatalf("unexpected first token %+v", token)
+	}
+	data, err := os.ReadFile(result.Tokens[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := TokenMetadata{}
+	if err := json.Unmarshal(data, &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.Name != first.Metadata.Prompts.TitlePrompt || token.Description != first.Metadata.Prompts.TersePrompt || token.Image != result.BaseURI+"images/1.png" {
+		t.Fatalf("unexpected token metadata %+v", token)
+	}
+	if len(token.Attributes) != len(first.Metadata.SelectedRecords)+1 || token.Attributes[len(token.Attributes)-1] != (TokenAttribute{TraitType: "series", Value: first.Series}) {
+		t.Fatalf("unexpected attributes %+v", token.Attributes)
+	}
+	if info, err := os.Stat(result.Tokens[1].Image); err != nil || info.Size() == 0 {
+		t.Fatalf("expected the second token image, got %v", err)
+	}
+	collection := CollectionMetadata{}
+	if data, err = os.ReadFile(result.Contract); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &collection); err != nil || collection.Name != DefaultCollectionName || collection.Symbol != "DD" || collection.Image != token.Image {
+		t.Fatalf("unexpected collection %+v, %v", collection, err)
+	}
+
+	picked, err := engine.ExportTokens(TokenExportOptions{Series: first.Series, IDs: []string{second.Metadata.ImageID}, BaseURI: "ipfs://base", ImageBaseURI: "ipfs://images", Out: t.TempDir()})
+	if err != nil || len(picked.Tokens) != 1 || picked.Tokens[0].TokenID != 2 || picked.Tokens[0].URI != "ipfs://base/2" {
+		t.Fatalf("expected token 2 to keep its id, got %+v, %v", picked, err)
+	}
+
+	for name, options := range map[string]TokenExportOptions{
+		"no series": {},
+		"artifact":  {Series: first.Series, Artifact: "variant"},
+		"start":     {Series: first.Series, Start: -1},
+		"renumber":  {Series: first.Series, Start: 42},
+	} {
+		if _, err := engine.ExportTokens(options); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("%s: expected invalid input, got %v", name, err)
+		}
+	}
+}
+
+// Token ids are saved on the first export: an image listed before the
+// numbered ones takes a new id instead of shifting the minted tokens.
+func TestEngineExportTokensKeepsIDs(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	bravo, err := engine.Generate(GenerateRequest{Input: "bravo", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	charlie, err := engine.Generate(GenerateRequest{Input: "charlie", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if _, err := engine.ExportTokens(TokenExportOptions{Series: bravo.Series, Start: 10}); err != nil {
+		t.Fatalf("ExportTokens: %v", err)
+	}
+	alpha, err := engine.Generate(GenerateRequest{Input: "alpha", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	result, err := engine.ExportTokens(TokenExportOptions{Series: bravo.Series})
+	if err != nil {
+		t.Fatalf("ExportTokens: %v", err)
+	}
+	want := map[string]int{bravo.Metadata.ImageID: 10, charlie.Metadata.ImageID: 11, alpha.Metadata.ImageID: 12}
+	if len(result.Tokens) != 3 {
+		t.Fatalf("unexpected export %+v", result)
+	}
+	for _, token := range result.Tokens {
+		if want[token.ImageID] != token.TokenID {
+			t.Fatalf("image %s took token %d, want %d", token.ImageID, token.TokenID, want[token.ImageID])
+		}
+	}
+	packaged, err := engine.PackageCAR(CAROptions{Series: bravo.Series, IDs: []string{alpha.Metadata.ImageID}})
+	if err != nil || len(packaged.Tokens) != 1 || packaged.Tokens[0].TokenID != 12 {
+		t.Fatalf("expected the CAR to reuse token 12, got %+v, %v", packaged, err)
+	}
+}
@@ -0,0 +1,183 @@
+package dalle
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// VariantModeFit scales the image to fit inside the variant's box;
+	// VariantModeFill scales it to cover the box and crops the overflow from
+	// the center.
+	VariantModeFit  = "fit"
+	VariantModeFill = "fill"
+
+	DefaultVariantQuality = 85
+)
+
+var variantName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// VariantSpec describes one derived web size of an image. Variants are
+// JPEGs scaled from the annotated image, or from the generated image when
+// there is no annotation, written under output/<series>/variants/<name>/ so
+// that variant names never collide with the series' other folders.
+type VariantSpec struct {
+	Name    string `json:"name"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Mode    string `json:"mode,omitempty"`
+	Quality int    `json:"quality,omitempty"`
+}
+
+// DefaultVariants are made when neither Config.Variants nor variants.json
+// in the data directory say otherwise.
+func DefaultVariants() []VariantSpec {
+	return []VariantSpec{
+		{Name: "thumbnail", Width: 256, Height: 256, Mode: VariantModeFit},
+		{Name: "preview", Width: 512, Height: 512, Mode: VariantModeFit},
+		{Name: "social", Width: 1200, Height: 630, Mode: VariantModeFill},
+	}
+}
+
+func (spec VariantSpec) Validate() error {
+	if !variantName.MatchString(spec.Name) {
+		return NewError(ErrInvalidInput, fmt.Sprintf("variant name %q must be lowercase letters, digits and dashes", spec.Name))
+	}
+	if spec.Name == ArtifactGenerated || spec.Name == ArtifactAnnotated {
+		return NewError(ErrInvalidInput, fmt.Sprintf("variant name %q is reserved", spec.Name))
+	}
+	if spec.Width <= 0 || spec.Height <= 0 || spec.Width > 8192 || spec.Height > 8192 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("variant %s must be between 1x1 and 8192x8192", spec.Name))
+	}
+	switch spec.Mode {
+	case "", VariantModeFit, VariantModeFill:
+	default:
+		return NewError(ErrInvalidInput, fmt.Sprintf("variant %s: unknown mode %q (want fit or fill)", spec.Name, spec.Mode))
+	}
+	if spec.Quality < 0 || spec.Quality > 100 {
+		return NewError(ErrInvalidInput, fmt.Sprintf("variant %s: quality must be between 1 and 100", spec.Name))
+	}
+	return nil
+}
+
+// loadVariants returns the configured variants: configured when it is not
+// nil (an empty list turns variants off), else variants.json in the data
+// directory, else DefaultVariants.
+func loadVariants(dataDir string, configured []VariantSpec) ([]VariantSpec, error) {
+	specs := configured
+	if specs == nil {
+		data, err := os.ReadFile(filepath.Join(dataDir, "variants.json"))
+		switch {
+		case os.IsNotExist(err):
+			specs = DefaultVariants()
+		case err != nil:
+			return nil, WrapError(ErrInvalidInput, "read variants.json", err)
+		default:
+			specs = []VariantSpec{}
+			if err := json.Unmarshal(data, &specs); err != nil {
+				return nil, WrapError(ErrInvalidInput, "parse variants.json", err)
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[spec.Name] {
+			return nil, NewError(ErrInvalidInput, "duplicate variant "+spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+	return specs, nil
+}
+
+// writeVariants scales the image's annotated (or generated) artifact to
+// every configured variant and returns the files written. A variant is
+// skipped when the source is no larger than it in either dimension; such
+// images are already small enough to serve as they are. Empty placeholders
+// (written when no image provider key is set) have no variants; a source
+// that is missing or does not decode is an error.
+func (engine *Engine) writeVariants(set ArtifactSet, series, filename string) ([]NamedArtifact, error) {
+	source := set.Annotated
+	if source == "" {
+		source = set.Generated
+	}
+	if len(engine.variants) == 0 || source == "" {
+		return nil, nil
+	}
+	if info, err := os.Stat(source); err == nil && info.Size() == 0 {
+		return nil, nil
+	}
+	img, err := decodeImageFile(source)
+	if err != nil {
+		return nil, WrapError(ErrArtifactMissing, "read variant source", err)
+	}
+	bounds := img.Bounds()
+	written := []NamedArtifact{}
+	for _, spec := range engine.variants {
+		if bounds.Dx() <= spec.Width && bounds.Dy() <= spec.Height {
+			continue
+		}
+		path := filepath.Join(engine.dataDir, "output", safePathPart(series), "variants", spec.Name, filename+".jpg")
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return nil, WrapError(ErrArtifactMissing, "create "+spec.Name+" directory", err)
+		}
+		if err := writeJPEG(path, scaleVariant(img, spec), spec.Quality); err != nil {
+			return nil, WrapError(ErrArtifactMissing, "write "+spec.Name+" variant", err)
+		}
+		written = append(written, NamedArtifact{Name: spec.Name, Path: path})
+	}
+	if len(written) == 0 {
+		return nil, nil
+	}
+	return written, nil
+}
+
+// scaleVariant scales img to the variant's size with Catmull-Rom, on a white
+// background since JPEG has no alpha.
+func scaleVariant(img image.Image, spec VariantSpec) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	source, target := bounds, image.Rect(0, 0, spec.Width, spec.Height)
+	if spec.Mode == VariantModeFill {
+		// Crop the source to the variant's aspect ratio around its center.
+		aspect := float64(spec.Width) / float64(spec.Height)
+		cropWidth, cropHeight := width, width/aspect
+		if cropHeight > height {
+			cropWidth, cropHeight = height*aspect, height
+		}
+		x := bounds.Min.X + int((width-cropWidth)/2)
+		y := bounds.Min.Y + int((height-cropHeight)/2)
+		source = image.Rect(x, y, x+int(cropWidth+0.5), y+int(cropHeight+0.5))
+	} else {
+		scale := min(float64(spec.Width)/width, float64(spec.Height)/height)
+		target = image.Rect(0, 0, max(1, int(width*scale+0.5)), max(1, int(height*scale+0.5)))
+	}
+	scaled := image.NewRGBA(target)
+	draw.Draw(scaled, target, image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(scaled, target, img, source, draw.Over, nil)
+	return scaled
+}
+
+func writeJPEG(path string, img image.Image, quality int) error {
+	if quality == 0 {
+		quality = DefaultVariantQuality
+	}
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: quality}); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,151 @@
+package dalle
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// landscapeImages writes a 600x400 gradient PNG as both the generated and
+// the annotated image.
+func landscapeImages(request imageRequest) (imageResult, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 600; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / 600), G: uint8(y * 255 / 400), B: 0x80, A: 0xFF})
+		}
+	}
+	for _, path := range []string{request.generatedPath, request.annotatedPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return imageResult{}, err
+		}
+		if err := writePNG(path, img); err != nil {
+			return imageResult{}, err
+		}
+	}
+	return imageResult{generatedPath: request.generatedPath, annotatedPath: request.annotatedPath}, nil
+}
+
+func TestEngineGenerateWritesVariants(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	result, err := engine.Generate(GenerateRequest{Input: "Person Tour Coordinates", Image: true, Annotate: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	// The social card is larger than the source in both dimensions, so it is
+	// not made.
+	variants := result.Metadata.Artifacts.Variants
+	if len(variants) != 2 || variants[0].Name != "thumbnail" || variants[1].Name != "preview" {
+		t.Fatalf("unexpected variants %+v", variants)
+	}
+	for name, size := range map[string][2]int{"thumbnail": {256, 171}, "preview": {512, 341}} {
+		info := result.Metadata.Artifacts.Info[name]
+		if info.Width != size[0] || info.Height != size[1] || info.Size == 0 {
+			t.Fatalf("%s: unexpected info %+v", name, info)
+		}
+	}
+	if filepath.Ext(variants[0].Path) != ".jpg" || filepath.Base(filepath.Dir(variants[0].Path)) != "thumbnail" || filepath.Base(filepath.Dir(filepath.Dir(variants[0].Path))) != "variants" {
+		t.Fatalf("unexpected thumbnail path %s", variants[0].Path)
+	}
+
+	if err := engine.DeleteImage(result.Metadata.ImageID); err != nil {
+		t.Fatalf("DeleteImage: %v", err)
+	}
+	for _, variant := range variants {
+		if _, err := os.Stat(variant.Path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s archived, got %v", variant.Path, err)
+		}
+		archived := filepath.Join(engine.DataDir(), "archives", result.Series, "variants", variant.Name, filepath.Base(variant.Path))
+		if _, err := os.Stat(archived); err != nil {
+			t.Fatalf("expected archived %s, got %v", archived, err)
+		}
+	}
+}
+
+func TestEngineVariantsConfiguration(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{{Name: "square", Width: 100, Height: 100, Mode: VariantModeFill, Quality: 70}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	engine.requestImage = landscapeImages
+	result, err := engine.Generate(GenerateRequest{Input: "square", Image: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if info := result.Metadata.Artifacts.Info["square"]; len(result.Metadata.Artifacts.Variants) != 1 || info.Width != 100 || info.Height != 100 {
+		t.Fatalf("expected a cropped 100x100 square, got %+v", result.Metadata.Artifacts)
+	}
+
+	off, err := New(Config{DataDir: t.TempDir(), Variants: []VariantSpec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	off.requestImage = landscapeImages
+	if result, err = off.Generate(GenerateRequest{Input: "none", Image: true}); err != nil || len(result.Metadata.Artifacts.Variants) != 0 {
+		t.Fatalf("expected no variants when turned off, got %+v, %v", result.Metadata.Artifacts.Variants, err)
+	}
+
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "variants.json"), []byte(`[{"name":"tiny","width":32,"height":32}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	specs, err := loadVariants(dataDir, nil)
+	if err != nil || len(specs) != 1 || specs[0].Name != "tiny" {
+		t.Fatalf("expected variants.json to be read, got %+v, %v", specs, err)
+	}
+	for _, bad := range [][]VariantSpec{
+		{{Name: "annotated", Width: 10, Height: 10}},
+		{{Name: "Big Thumb", Width: 10, Height: 10}},
+		{{Name: "zero", Width: 0, Height: 10}},
+		{{Name: "odd", Width: 10, Height: 10, Mode: "stretch"}},
+		{{Name: "twice", Width: 10, Height: 10}, {Name: "twice", Width: 20, Height: 20}},
+	} {
+		if _, err := New(Config{DataDir: t.TempDir(), Variants: bad}); ErrorCodeOf(err) != ErrInvalidInput {
+			t.Errorf("expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestScaleVariantFlattensOntoWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	scaled := scaleVariant(img, VariantSpec{Name: "small", Width: 10, Height: 10})
+	if scaled.Bounds().Dx() != 10 || scaled.Bounds().Dy() != 5 {
+		t.Fatalf("expected the aspect ratio to be kept, got %v", scaled.Bounds())
+	}
+	if got := scaled.RGBAAt(5, 2); got != (color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}) {
+		t.Fatalf("expected transparent pixels to become white, got %v", got)
+	}
+}
+
+func TestWriteVariantsSkipsOnlyPlaceholders(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	dir := t.TempDir()
+	for name, test := range map[string]struct {
+		data []byte
+		want ErrorCode
+	}{
+		"placeholder.png": {nil, ""},
+		"corrupt.png":     {[]byte("png"), ErrArtifactMissing},
+		"missing.png":     {nil, ErrArtifactMissing},
+	} {
+		path := filepath.Join(dir, name)
+		if name != "missing.png" {
+			if err := os.WriteFile(path, test.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		written, err := engine.writeVariants(ArtifactSet{Generated: path}, "series", "image")
+		if ErrorCodeOf(err) != test.want || len(written) != 0 {
+			t.Errorf("%s: got %v, %v, want %q", name, written, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package dalle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	VariationModeStep   = "step"
+	VariationModeReseed = "reseed"
+
+	VariationNext     = "next"
+	VariationPrevious = "previous"
+	VariationReseed   = "reseed"
+
+	DefaultVariationCount = 6
+	MaxVariationCount     = 64
+)
+
+// VariationsRequest describes a neighborhood walk around an existing image.
+// Each variant changes exactly one attribute of the parent: in "step" mode to
+// the next or previous row of the series-filtered database, in "reseed" mode to
+// a row picked from a fresh hash of the parent seed. Attributes limits which
+// attributes are perturbed; it defaults to every attribute the parent selected.
+type VariationsRequest struct {
+	ID         string   `json:"id"`
+	Count      int      `json:"count,omitempty"`
+	Mode       string   `json:"mode,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+	Preview    bool     `json:"preview,omitempty"`
+	Enhance    bool     `json:"enhance,omitempty"`
+	Image      bool     `json:"image,omitempty"`
+	Annotate   bool     `json:"annotate,omitempty"`
+}
+
+type VariationsResult struct {
+	ParentImageID string           `json:"parentImageId"`
+	Variants      []GenerateResult `json:"variants"`
+}
+
+type variationCandidate struct {
+	attribute string
+	row       int
+	variation string
+}
+
+// Variations produces up to Count variants of an image, each stored with
+// lineage pointing back at the parent image id. With Preview set only prompts
+// and metadata are built; no provider calls are made.
+func (engine *Engine) Variations(request VariationsRequest) (VariationsResult, error) {
+	if engine == nil {
+		return VariationsResult{}, NewError(ErrInvalidInput, "engine is nil")
+	}
+	if request.Count == 0 {
+		request.Count = DefaultVariationCount
+	}
+	if request.Count < 0 || request.Count > MaxVariationCount {
+		return VariationsResult{}, NewError(ErrInvalidInput, fmt.Sprintf("variation count must be between 1 and %d", MaxVariationCount))
+	}
+	mode := strings.ToLower(strings.TrimSpace(request.Mode))
+	if mode == "" {
+		mode = VariationModeStep
+	}
+	if mode != VariationModeStep && mode != VariationModeReseed {
+		return VariationsResult{}, NewError(ErrInvalidInput, fmt.Sprintf("unknown variation mode %q", request.Mode))
+	}
+	parent, err := engine.GetImage(request.ID)
+	if err != nil {
+		return VariationsResult{}, err
+	}
+	metadata := parent.Metadata
+	ctx, err := engine.seriesContext(metadata.Series.Name)
+	if err != nil {
+		return VariationsResult{}, err
+	}
+	records, err := variationRecords(metadata.SelectedRecords, request.Attributes)
+	if err != nil {
+		return VariationsResult{}, err
+	}
+	sizes := make(map[string]int, len(records))
+	for _, rec := range records {
+		sizes[rec.Attribute] = len(ctx.Databases[rec.Database])
+	}
+	candidates := variationCandidates(metadata.Seed, mode, records, sizes, request.Count)
+	if len(candidates) == 0 {
+		return VariationsResult{}, NewError(ErrInvalidInput, "no attribute has an alternative row to vary")
+	}
+
+	result := VariationsResult{ParentImageID: metadata.ImageID}
+	for _, candidate := range candidates {
+		// The varied row is the engine's pick, not the user's, so it is a
+		// reseed; it replaces any pin the parent had on that attribute.
+		overrides := make(map[string]string, len(metadata.Overrides))
+		for name, value := range metadata.Overrides {
+			if name != candidate.attribute {
+				overrides[name] = value
+			}
+		}
+		reseeds := make(map[string]int, len(metadata.Reseeds)+1)
+		for name, row := range metadata.Reseeds {
+			reseeds[name] = row
+		}
+		reseeds[candidate.attribute] = candidate.row
+		generateRequest := GenerateRequest{
+			Input:      metadata.Input,
+			InputKind:  storedInputKind(metadata),
+			Seed:       metadata.Seed,
+			Series:     metadata.Series.Name,
+			Recipe:     metadata.Recipe.Name,
+			Backstyle:  backstyleOf(metadata),
+			Overrides:  overrides,
+			reseeds:    reseeds,
+			SeedScheme: metadata.Recipe.SeedSchemeReference(),
+			Enhance:    request.Enhance,
+			Image:      request.Image,
+			Annotate:   request.Annotate,
+		}
+		lineage := &MetadataLineage{
+			ParentImageID: metadata.ImageID,
+			Attribute:     candidate.attribute,
+			Variation:     candidate.variation,
+		}
+		var variant GenerateResult
+		if request.Preview {
+			variant, err = engine.preview(generateRequest, lineage)
+		} else {
+			variant, err = engine.generate(generateRequest, lineage)
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Variants = append(result.Variants, variant)
+	}
+	return result, nil
+}
+
+// variationRecords returns the parent's selected records that may be varied,
+// restricted to the requested attribute names when any are given.
+func variationRecords(selected []SelectedRecord, attributes []string) ([]SelectedRecord, error) {
+	eligible := make([]SelectedRecord, 0, len(selected))
+	for _, rec := range selected {
+		if _, ok := canonicalAttributeName(rec.Attribute); ok {
+			eligible = append(eligible, rec)
+		}
+	}
+	if len(attributes) == 0 {
+		return eligible, nil
+	}
+	records := make([]SelectedRecord, 0, len(attributes))
+	for _, name := range attributes {
+		canonical, ok := canonicalAttributeName(name)
+		if !ok {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("unknown variation attribute %q", name))
+		}
+		found := false
+		for _, rec := range eligible {
+			if rec.Attribute == canonical {
+				records = append(records, rec)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, NewError(ErrInvalidInput, fmt.Sprintf("attribute %s was not selected for this image", canonical))
+		}
+	}
+	return records, nil
+}
+
+// variationCandidates walks the attributes round-robin. In step mode round r
+// moves the attribute by +1, -1, +2, -2, ... rows; in reseed mode it hashes the
+// seed with the attribute name and round. Rows equal to the parent's, and rows
+// already proposed, are skipped so every candidate is a distinct image.
+func variationCandidates(seed, mode string, records []SelectedRecord, sizes map[string]int, count int) []variationCandidate {
+	candidates := make([]variationCandidate, 0, count)
+	seen := make(map[string]bool, count)
+	limit := count * len(records) * 4
+	for k := 0; len(candidates) < count && k < limit; k++ {
+		rec := records[k%len(records)]
+		size := sizes[rec.Attribute]
+		if size < 2 {
+			continue
+		}
+		round := k / len(records)
+		var candidate variationCandidate
+		if mode == VariationModeReseed {
+			candidate = variationCandidate{rec.Attribute, reseedRow(seed, rec.Attribute, round, size), VariationReseed}
+		} else {
+			offset := round/2 + 1
+			variation := VariationNext
+			if round%2 == 1 {
+				offset = -offset
+				variation = VariationPrevious
+			}
+			row := ((rec.RowIndex+offset)%size + size) % size
+			candidate = variationCandidate{rec.Attribute, row, variation}
+		}
+		key := candidate.attribute + "=" + strconv.Itoa(candidate.row)
+		if candidate.row == rec.RowIndex || seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// reseedRow picks a row the same way a seed chunk does (six hex digits scaled
+// into the database) but from a hash of the seed, attribute and round.
+func reseedRow(seed, attribute string, round, size int) int {
+	sum := sha256.Sum256([]byte(seed + "/" + attribute + "/" + strconv.Itoa(round)))
+	number, _ := strconv.ParseUint(hex.EncodeToString(sum[:3]), 16, 64)
+	return int(uint64(size) * number / (1 << 24))
+}
@@ -0,0 +1,124 @@
+package dalle
+
+import (
+	"testing"
+)
+
+func TestEngineVariationsChangeOneAttribute(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	parent, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates"})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+
+	for _, mode := range []string{VariationModeStep, VariationModeReseed} {
+		result, err := engine.Variations(VariationsRequest{ID: parent.Metadata.ImageID, Count: 5, Mode: mode, Preview: true})
+		if err != nil {
+			t.Fatalf("Variations %s: %v", mode, err)
+		}
+		if result.ParentImageID != parent.Metadata.ImageID || len(result.Variants) != 5 {
+			t.Fatalf("%s: expected 5 variants of %s, got %#v", mode, parent.Metadata.ImageID, result)
+		}
+		ids := map[string]bool{parent.Metadata.ImageID: true}
+		for _, variant := range result.Variants {
+			metadata := variant.Metadata
+			if ids[metadata.ImageID] {
+				t.Fatalf("%s: duplicate variant image id %s", mode, metadata.ImageID)
+			}
+			ids[metadata.ImageID] = true
+			if metadata.Lineage == nil || metadata.Lineage.ParentImageID != parent.Metadata.ImageID {
+				t.Fatalf("%s: variant missing lineage: %#v", mode, metadata.Lineage)
+			}
+			if mode == VariationModeReseed && metadata.Lineage.Variation != VariationReseed {
+				t.Fatalf("expected reseed variation, got %q", metadata.Lineage.Variation)
+			}
+			if _, ok := metadata.Reseeds[metadata.Lineage.Attribute]; !ok || len(metadata.Reseeds) != 1 || len(metadata.Overrides) != 0 {
+				t.Fatalf("%s: expected the varied row as a reseed: %v %v", mode, metadata.Overrides, metadata.Reseeds)
+			}
+			changed := 0
+			for index, record := range metadata.SelectedRecords {
+				if record.Record != parent.Metadata.SelectedRecords[index].Record {
+					changed++
+					if record.Attribute != metadata.Lineage.Attribute {
+						t.Fatalf("%s: %s changed but lineage names %s", mode, record.Attribute, metadata.Lineage.Attribute)
+					}
+				}
+				if record.Overridden {
+					t.Fatalf("%s: varied %s is marked as pinned", mode, record.Attribute)
+				}
+			}
+			if changed != 1 {
+				t.Fatalf("%s: expected exactly one changed attribute, got %d", mode, changed)
+			}
+			stored, err := engine.GetImage(metadata.ImageID)
+			if err != nil || stored.Metadata.Lineage == nil {
+				t.Fatalf("%s: variant not stored with lineage: %v", mode, err)
+			}
+		}
+	}
+
+	again, err := engine.GetImage(parent.Metadata.Seed)
+	if err != nil || again.Metadata.ImageID != parent.Metadata.ImageID {
+		t.Fatalf("seed lookup should still resolve the parent: %v %#v", err, again.Metadata.ImageID)
+	}
+}
+
+func TestEngineVariationsKeepOnlyTheUsersPins(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	parent, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates", Overrides: map[string]string{"emotion": "1"}})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	result, err := engine.Variations(VariationsRequest{ID: parent.Metadata.ImageID, Count: 2, Attributes: []string{"place"}, Preview: true})
+	if err != nil {
+		t.Fatalf("Variations: %v", err)
+	}
+	for _, variant := range result.Variants {
+		for _, record := range variant.Metadata.SelectedRecords {
+			if record.Overridden != (record.Attribute == "emotion") {
+				t.Fatalf("%s overridden=%v, want only the user's pin", record.Attribute, record.Overridden)
+			}
+		}
+	}
+}
+
+func TestVariationCandidatesStepWalksBothDirections(t *testing.T) {
+	records := []SelectedRecord{{Attribute: "noun", RowIndex: 0}}
+	candidates := variationCandidates("seed", VariationModeStep, records, map[string]int{"noun": 10}, 4)
+	want := []int{1, 9, 2, 8}
+	if len(candidates) != len(want) {
+		t.Fatalf("expected %d candidates, got %#v", len(want), candidates)
+	}
+	for index, candidate := range candidates {
+		if candidate.row != want[index] {
+			t.Fatalf("candidate %d: expected row %d, got %d", index, want[index], candidate.row)
+		}
+	}
+	if candidates[0].variation != VariationNext || candidates[1].variation != VariationPrevious {
+		t.Fatalf("unexpected directions: %#v", candidates)
+	}
+	if got := variationCandidates("seed", VariationModeStep, records, map[string]int{"noun": 1}, 4); len(got) != 0 {
+		t.Fatalf("single-row database cannot vary: %#v", got)
+	}
+}
+
+func TestEngineVariationsRejectsUnknownAttribute(t *testing.T) {
+	engine, err := New(Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	parent, err := engine.Preview(GenerateRequest{Input: "Person Tour Coordinates"})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	_, err = engine.Variations(VariationsRequest{ID: parent.Metadata.ImageID, Attributes: []string{"shoeSize"}, Preview: true})
+	if ErrorCodeOf(err) != ErrInvalidInput {
+		t.Fatalf("expected invalid input, got %v", err)
+	}
+}